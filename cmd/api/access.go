@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"desafiocotacaob3/internal/auth"
+	"desafiocotacaob3/internal/config"
+	"desafiocotacaob3/internal/ratelimit"
+)
+
+// access is the credential check and the client rate limits of the data
+// endpoints. The HTTP and gRPC APIs share one, so a client has the same quota
+// and limits whichever it calls.
+type access struct {
+	authn   *authenticator
+	limiter *clientLimiter
+}
+
+// newAccess checks bearer tokens with tokens, or rejects them when it is nil.
+func newAccess(repo apiRepository, tokens tokenVerifier, cfg *config.Config) *access {
+	var store ratelimit.Store = ratelimit.NewLimiter()
+	if cfg.RateLimitStore == "postgres" {
+		store = ratelimit.NewShared(repo)
+	}
+	return &access{
+		authn:   newAuthenticator(repo, tokens, cfg.AuthRequired, store),
+		limiter: newClientLimiter(store, cfg.RateLimit, cfg.RateLimitRoutes, cfg.ClientIPHeader),
+	}
+}
+
+// credentials are what a request presented: an API key secret and a bearer
+// token, either of which may be empty.
+type credentials struct {
+	secret string
+	token  string
+}
+
+// denial is a request refused by access.admit, reported as apiErr with
+// status. challenges are the WWW-Authenticate challenges of a 401 or 403, and
+// limited the bucket a 429 exhausted.
+type denial struct {
+	status     int
+	apiErr     apiError
+	challenges []string
+	limited    *ratelimit.Decision
+}
+
+func (d *denial) Error() string {
+	return d.apiErr.Message
+}
+
+// admit decides whether a request to route, made from o with creds, is
+// served. The route's rate limit of its address is checked first, so that
+// requests with bad credentials cannot each cost a key lookup once it is
+// exhausted; then its credential must grant scope. The request is counted
+// against the route's limit of the principal it was verified as, or of its
+// address without one, and last against the quota of its key. admit returns
+// ctx with the principal attached and the bucket the X-RateLimit headers
+// report: the key quota once checked, the route's limit otherwise, nil for
+// neither. A refused request is a *denial; other errors are failures to
+// check it.
+func (acc *access) admit(ctx context.Context, creds credentials, route, scope string, o origin) (context.Context, *ratelimit.Decision, error) {
+	if reported, err := acc.limiter.peek(ctx, route, o); err != nil {
+		return ctx, reported, err
+	}
+	ctx, quota, err := acc.authn.check(ctx, creds, scope)
+	client := acc.limiter.client(o)
+	p, verified := auth.FromContext(ctx)
+	if verified {
+		client = "sub:" + p.Subject
+	}
+	reported, limited := acc.limiter.take(ctx, route, client)
+	if limited != nil {
+		return ctx, reported, limited
+	}
+	if err != nil || quota == nil {
+		return ctx, reported, err
+	}
+	if d, err := acc.authn.takeQuota(ctx, p, *quota); d != nil || err != nil {
+		return ctx, d, err
+	}
+	return ctx, reported, nil
+}
+
+// guard serves next only to the requests to route, needing scope, that admit
+// lets through.
+func (acc *access) guard(route, scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		creds := credentials{secret: r.Header.Get(apiKeyHeader), token: bearerToken(r.Header.Get("Authorization"))}
+		ctx, reported, err := acc.admit(r.Context(), creds, route, scope, acc.limiter.originOf(r))
+		if reported != nil {
+			setRateLimitHeaders(w, *reported)
+		}
+		var d *denial
+		switch {
+		case errors.As(err, &d):
+			for _, c := range d.challenges {
+				w.Header().Add("WWW-Authenticate", c)
+			}
+			if d.limited != nil {
+				writeRateLimited(w, r, *d.limited)
+				return
+			}
+			writeError(w, r, d.status, d.apiErr)
+		case err != nil:
+			writeFailure(w, r, err)
+		default:
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}
+	})
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"desafiocotacaob3/internal/analytics"
+	"desafiocotacaob3/internal/repository"
+	"desafiocotacaob3/internal/util"
+)
+
+// analyticsDefaultDays is the lookback used when from is omitted: one trading year.
+const analyticsDefaultDays = analytics.TradingDaysPerYear
+
+var (
+	errInvalidRange     = apiError{ID: "ERR_INVALID_DATE", Message: "invalid from/to format"}
+	errInvalidDateRange = apiError{ID: "ERR_INVALID_DATE_RANGE", Message: "from must not be after to"}
+	errInvalidRiskFree  = apiError{ID: "ERR_INVALID_RISK_FREE", Message: "risk_free must be a number"}
+	errInsufficientData = apiError{ID: "ERR_INSUFFICIENT_DATA", Message: "at least two sessions are required in the requested range"}
+)
+
+type dailyBarsRepo interface {
+	DailyBars(ctx context.Context, ticker string, from, to time.Time) ([]repository.Bar, error)
+}
+
+type returnPoint struct {
+	Date      string  `json:"date"`
+	LogReturn float64 `json:"log_return"`
+}
+
+type drawdownResponse struct {
+	Value      float64 `json:"value"`
+	PeakDate   string  `json:"peak_date,omitempty"`
+	TroughDate string  `json:"trough_date,omitempty"`
+}
+
+type analyticsResponse struct {
+	Ticker               string           `json:"ticker"`
+	From                 string           `json:"from"`
+	To                   string           `json:"to"`
+	RiskFreeRate         float64          `json:"risk_free_rate"`
+	Returns              []returnPoint    `json:"returns"`
+	AnnualizedVolatility float64          `json:"annualized_volatility"`
+	MaxDrawdown          drawdownResponse `json:"max_drawdown"`
+	SharpeRatio          float64          `json:"sharpe_ratio"`
+}
+
+// parseDateRange reads the from/to query params. to defaults to today and from
+// defaults to defaultDays business days before to.
+func parseDateRange(r *http.Request, defaultDays int) (time.Time, time.Time, *apiError) {
+	q := r.URL.Query()
+	return dateRange(q.Get("from"), q.Get("to"), defaultDays)
+}
+
+// dateRange parses a from/to pair with the defaults of parseDateRange, which
+// empty strings select.
+func dateRange(fromStr, toStr string, defaultDays int) (time.Time, time.Time, *apiError) {
+	to := time.Now().UTC()
+	to = time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	if toStr != "" {
+		t, err := time.Parse("2006-01-02", toStr)
+		if err != nil {
+			return time.Time{}, time.Time{}, &errInvalidRange
+		}
+		to = t
+	}
+	from := util.BusinessDaysAgo(to, defaultDays)
+	if fromStr != "" {
+		t, err := time.Parse("2006-01-02", fromStr)
+		if err != nil {
+			return time.Time{}, time.Time{}, &errInvalidRange
+		}
+		from = t
+	}
+	if from.After(to) {
+		return time.Time{}, time.Time{}, &errInvalidDateRange
+	}
+	return from, to, nil
+}
+
+func quotesAnalyticsHandler(repo dailyBarsRepo, riskFree float64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ticker := strings.ToUpper(r.URL.Query().Get("ticker"))
+		if ticker == "" {
+			writeError(w, r, http.StatusBadRequest, errMissingTicker)
+			return
+		}
+		from, to, apiErr := parseDateRange(r, analyticsDefaultDays)
+		if apiErr != nil {
+			writeError(w, r, http.StatusBadRequest, *apiErr)
+			return
+		}
+		rf := riskFree
+		if s := r.URL.Query().Get("risk_free"); s != "" {
+			v, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				writeError(w, r, http.StatusBadRequest, errInvalidRiskFree)
+				return
+			}
+			rf = v
+		}
+
+		bars, err := repo.DailyBars(r.Context(), ticker, from, to)
+		if err != nil {
+			writeFailure(w, r, err)
+			return
+		}
+		if len(bars) == 0 {
+			writeError(w, r, http.StatusNotFound, errTickerNotFound)
+			return
+		}
+		if len(bars) < 2 {
+			writeError(w, r, http.StatusUnprocessableEntity, errInsufficientData)
+			return
+		}
+
+		series := make([]analytics.Point, len(bars))
+		for i, b := range bars {
+			series[i] = analytics.Point{Date: b.Time, Close: b.Close}
+		}
+		returns := analytics.LogReturns(series)
+		points := make([]returnPoint, len(returns))
+		for i, ret := range returns {
+			points[i] = returnPoint{Date: ret.Date.Format("2006-01-02"), LogReturn: ret.Value}
+		}
+		dd := analytics.MaxDrawdown(series)
+
+		resp := analyticsResponse{
+			Ticker:               ticker,
+			From:                 from.Format("2006-01-02"),
+			To:                   to.Format("2006-01-02"),
+			RiskFreeRate:         rf,
+			Returns:              points,
+			AnnualizedVolatility: analytics.AnnualizedVolatility(returns),
+			MaxDrawdown:          drawdownResponse{Value: dd.Value},
+			SharpeRatio:          analytics.SharpeRatio(returns, rf),
+		}
+		if dd.Value < 0 {
+			resp.MaxDrawdown.PeakDate = dd.Peak.Format("2006-01-02")
+			resp.MaxDrawdown.TroughDate = dd.Trough.Format("2006-01-02")
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"desafiocotacaob3/internal/repository"
+)
+
+type stubBarsRepo struct {
+	lastTicker string
+	lastFrom   time.Time
+	lastTo     time.Time
+	bars       []repository.Bar
+	err        error
+}
+
+func (s *stubBarsRepo) DailyBars(ctx context.Context, ticker string, from, to time.Time) ([]repository.Bar, error) {
+	s.lastTicker = ticker
+	s.lastFrom = from
+	s.lastTo = to
+	return s.bars, s.err
+}
+
+func dailyBar(day int, close float64) repository.Bar {
+	return repository.Bar{Time: time.Date(2024, 5, day, 0, 0, 0, 0, time.UTC), Close: close}
+}
+
+func TestQuotesAnalytics(t *testing.T) {
+	repo := &stubBarsRepo{bars: []repository.Bar{dailyBar(2, 100), dailyBar(3, 110), dailyBar(6, 99), dailyBar(7, 121)}}
+	srv := httptest.NewServer(quotesAnalyticsHandler(repo, 0.1))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/quotes/analytics?ticker=petr4&from=2024-05-01&to=2024-05-10")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	var a analyticsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&a); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if repo.lastTicker != "PETR4" {
+		t.Fatalf("unexpected ticker %s", repo.lastTicker)
+	}
+	if !repo.lastFrom.Equal(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)) || !repo.lastTo.Equal(time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected range %v - %v", repo.lastFrom, repo.lastTo)
+	}
+	if len(a.Returns) != 3 || a.Returns[0].Date != "2024-05-03" {
+		t.Fatalf("unexpected returns %+v", a.Returns)
+	}
+	if a.MaxDrawdown.PeakDate != "2024-05-03" || a.MaxDrawdown.TroughDate != "2024-05-06" {
+		t.Fatalf("unexpected drawdown %+v", a.MaxDrawdown)
+	}
+	if a.RiskFreeRate != 0.1 || a.AnnualizedVolatility == 0 || a.SharpeRatio == 0 {
+		t.Fatalf("unexpected stats %+v", a)
+	}
+}
+
+func TestQuotesAnalyticsInsufficientData(t *testing.T) {
+	repo := &stubBarsRepo{bars: []repository.Bar{dailyBar(2, 100)}}
+	srv := httptest.NewServer(quotesAnalyticsHandler(repo, 0))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/quotes/analytics?ticker=PETR4")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status 422, got %d", resp.StatusCode)
+	}
+	var e apiError
+	if err := json.NewDecoder(resp.Body).Decode(&e); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if e.ID != errInsufficientData.ID {
+		t.Fatalf("expected error %s, got %s", errInsufficientData.ID, e.ID)
+	}
+}
+
+func TestQuotesAnalyticsInvalidRange(t *testing.T) {
+	srv := httptest.NewServer(quotesAnalyticsHandler(nil, 0))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/quotes/analytics?ticker=PETR4&from=2024-05-10&to=2024-05-01")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", resp.StatusCode)
+	}
+	var e apiError
+	if err := json.NewDecoder(resp.Body).Decode(&e); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if e.ID != errInvalidDateRange.ID {
+		t.Fatalf("expected error %s, got %s", errInvalidDateRange.ID, e.ID)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"desafiocotacaob3/internal/auth"
+	"desafiocotacaob3/internal/cache"
+	"desafiocotacaob3/internal/ratelimit"
+	"desafiocotacaob3/internal/repository"
+)
+
+var (
+	errUnauthorized = apiError{ID: "ERR_UNAUTHORIZED", Message: "a valid API key in the X-API-Key header or bearer token is required"}
+	errForbidden    = apiError{ID: "ERR_FORBIDDEN", Message: "the credential is not granted the scope this endpoint requires"}
+)
+
+// apiKeyHeader carries the API key of a request.
+const apiKeyHeader = "X-API-Key"
+
+const (
+	// keyCacheTTL is how long lookups, failed ones included, are cached. It
+	// bounds how long a revoked key keeps working on an instance.
+	keyCacheTTL = 30 * time.Second
+	// keyCacheSize bounds the lookups cached, so that clients sending random
+	// keys evict each other's failures rather than growing the cache.
+	keyCacheSize = 10000
+)
+
+type apiKeyStore interface {
+	APIKeyByHash(ctx context.Context, hash []byte) (repository.APIKey, bool, error)
+}
+
+// tokenVerifier validates bearer tokens. auth.Verifier implements it.
+type tokenVerifier interface {
+	Verify(ctx context.Context, token string) (auth.Principal, error)
+}
+
+type cachedKey struct {
+	key repository.APIKey
+	ok  bool
+}
+
+// authenticator checks the credential of requests against the scopes routes
+// require and enforces the per-key quota.
+type authenticator struct {
+	keys     apiKeyStore
+	tokens   tokenVerifier
+	required bool
+	quotas   ratelimit.Store
+	cache    *cache.Cache[cachedKey]
+}
+
+// newAuthenticator returns an authenticator looking keys up in keys and
+// validating bearer tokens with tokens, which is nil when they are not
+// accepted. Key quotas are counted in quotas, the store of the client rate
+// limits. Unless required is set, requests without credentials are let
+// through anonymously.
+func newAuthenticator(keys apiKeyStore, tokens tokenVerifier, required bool, quotas ratelimit.Store) *authenticator {
+	return &authenticator{keys: keys, tokens: tokens, required: required, quotas: quotas, cache: cache.New[cachedKey](keyCacheSize, keyCacheTTL)}
+}
+
+// lookup returns the key stored under hash. Concurrent lookups of the same
+// hash share one query.
+func (a *authenticator) lookup(ctx context.Context, hash []byte) (repository.APIKey, bool, error) {
+	c, err := a.cache.Get(ctx, string(hash), func(ctx context.Context) (cachedKey, error) {
+		key, ok, err := a.keys.APIKeyByHash(ctx, hash)
+		return cachedKey{key: key, ok: ok}, err
+	})
+	return c.key, c.ok, err
+}
+
+// bearerToken returns the token of an Authorization: Bearer header, or of
+// the authorization metadata of an RPC.
+func bearerToken(authorization string) string {
+	scheme, token, ok := strings.Cut(authorization, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// rejection is a credential that was refused. bearerError is the RFC 6750
+// error code of a refused bearer token, and cause why it was refused, when
+// worth logging.
+type rejection struct {
+	bearerError string
+	cause       error
+}
+
+func (e *rejection) Error() string {
+	if e.cause != nil {
+		return e.cause.Error()
+	}
+	return "credential refused"
+}
+
+// authenticate resolves the principal behind an API key secret or a bearer
+// token. An API key takes precedence over a bearer token and comes with its
+// quota; tokens carry no quota of their own. anonymous is set when neither was
+// presented and credentials are optional. A refused credential is reported as
+// a *rejection, and lookups that failed as they are.
+func (a *authenticator) authenticate(ctx context.Context, secret, token string) (p auth.Principal, quota *ratelimit.Rate, anonymous bool, err error) {
+	switch {
+	case secret != "":
+		key, ok, err := a.lookup(ctx, auth.HashKey(secret))
+		if err != nil {
+			return p, nil, false, err
+		}
+		if !ok {
+			return p, nil, false, &rejection{}
+		}
+		rate := ratelimit.PerMinute(key.RatePerMinute, key.Burst)
+		return auth.Principal{Subject: key.Prefix, Scopes: key.Scopes}, &rate, false, nil
+	case token != "" && a.tokens != nil:
+		p, err = a.tokens.Verify(ctx, token)
+		if errors.Is(err, auth.ErrInvalidToken) {
+			return p, nil, false, &rejection{bearerError: "invalid_token", cause: err}
+		}
+		return p, nil, false, err
+	case token != "" || a.required:
+		return p, nil, false, &rejection{}
+	}
+	return p, nil, true, nil
+}
+
+// check admits requests whose credential grants scope. It returns ctx with
+// the principal attached, its subject added to the request's log lines, and
+// the quota of its key, which takeQuota counts the request against. A refused
+// request is a *denial.
+func (a *authenticator) check(ctx context.Context, creds credentials, scope string) (context.Context, *ratelimit.Rate, error) {
+	p, quota, anonymous, err := a.authenticate(ctx, creds.secret, creds.token)
+	var rej *rejection
+	switch {
+	case errors.As(err, &rej):
+		if rej.cause != nil {
+			logField(ctx, "auth_error", rej.cause.Error())
+		}
+		return ctx, nil, &denial{status: http.StatusUnauthorized, apiErr: errUnauthorized, challenges: a.challenges(rej.bearerError)}
+	case err != nil:
+		return ctx, nil, err
+	case anonymous:
+		return ctx, nil, nil
+	}
+
+	logField(ctx, "client", p.Subject)
+	if !p.Has(scope) {
+		d := &denial{status: http.StatusForbidden, apiErr: errForbidden}
+		if creds.token != "" && creds.secret == "" {
+			d.challenges = []string{`Bearer realm="quotes", error="insufficient_scope", scope="` + scope + `"`}
+		}
+		return ctx, nil, d
+	}
+	return auth.WithPrincipal(ctx, p), quota, nil
+}
+
+// takeQuota counts a request of p against quota, returning its bucket. A
+// request over quota is a *denial. Should the quota store fail, requests are
+// let through as clientLimiter.take lets them.
+func (a *authenticator) takeQuota(ctx context.Context, p auth.Principal, quota ratelimit.Rate) (*ratelimit.Decision, error) {
+	d, err := a.quotas.Take(ctx, "key:"+p.Subject, quota)
+	switch {
+	case err != nil:
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("rate limit store failed, key quota not enforced")
+		return nil, nil
+	case !d.Allowed:
+		return &d, &denial{status: http.StatusTooManyRequests, apiErr: errRateLimited, limited: &d}
+	}
+	return &d, nil
+}
+
+// challenges are the WWW-Authenticate challenges of every credential
+// accepted. bearerError is the RFC 6750 error code of a rejected bearer token.
+func (a *authenticator) challenges(bearerError string) []string {
+	challenges := []string{`ApiKey realm="quotes"`}
+	if a.tokens != nil {
+		challenge := `Bearer realm="quotes"`
+		if bearerError != "" {
+			challenge += `, error="` + bearerError + `"`
+		}
+		challenges = append(challenges, challenge)
+	}
+	return challenges
+}
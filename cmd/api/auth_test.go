@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"desafiocotacaob3/internal/auth"
+	"desafiocotacaob3/internal/cache"
+	"desafiocotacaob3/internal/ratelimit"
+	"desafiocotacaob3/internal/repository"
+)
+
+type stubKeyRepo struct {
+	keys    map[string]repository.APIKey
+	lookups int
+}
+
+func (s *stubKeyRepo) APIKeyByHash(ctx context.Context, hash []byte) (repository.APIKey, bool, error) {
+	s.lookups++
+	k, ok := s.keys[string(hash)]
+	return k, ok, nil
+}
+
+func newStubKeyRepo(keys map[string]repository.APIKey) *stubKeyRepo {
+	s := &stubKeyRepo{keys: make(map[string]repository.APIKey)}
+	for secret, k := range keys {
+		s.keys[string(auth.HashKey(secret))] = k
+	}
+	return s
+}
+
+var testKeys = map[string]repository.APIKey{
+	"qk_reader_secret": {Prefix: "qk_reader", Scopes: []string{auth.ReadQuotes}, RatePerMinute: 60, Burst: 2},
+	"qk_admin_secret":  {Prefix: "qk_admin", Scopes: []string{auth.AdminIngest}, RatePerMinute: 60, Burst: 2},
+}
+
+func authGet(t *testing.T, h http.Handler, key string) (*httptest.ResponseRecorder, apiError) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/quotes/summary?ticker=PETR4", nil)
+	if key != "" {
+		req.Header.Set(apiKeyHeader, key)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	var e apiError
+	if rec.Code >= 400 {
+		if err := json.NewDecoder(rec.Body).Decode(&e); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+	}
+	return rec, e
+}
+
+// guarded is next behind authn and limiter, as the router guards route. A nil
+// authn lets every request through anonymously and a nil limiter does not
+// limit them.
+func guarded(authn *authenticator, limiter *clientLimiter, route string, next http.Handler) http.Handler {
+	if authn == nil {
+		authn = newAuthenticator(newStubKeyRepo(nil), nil, false, ratelimit.NewLimiter())
+	}
+	if limiter == nil {
+		limiter = newClientLimiter(ratelimit.NewLimiter(), ratelimit.Rate{}, nil, "")
+	}
+	return (&access{authn: authn, limiter: limiter}).guard(route, auth.ReadQuotes, next)
+}
+
+func TestAuthenticatorAnonymous(t *testing.T) {
+	next := quotesSummaryHandler(&stubSummaryRepo{ok: true})
+
+	open := guarded(newAuthenticator(newStubKeyRepo(testKeys), nil, false, ratelimit.NewLimiter()), nil, "/quotes/summary", next)
+	if rec, _ := authGet(t, open, ""); rec.Code != http.StatusOK || rec.Header().Get("X-RateLimit-Limit") != "" {
+		t.Fatalf("expected anonymous access without quota headers, got %d", rec.Code)
+	}
+
+	closed := guarded(newAuthenticator(newStubKeyRepo(testKeys), nil, true, ratelimit.NewLimiter()), nil, "/quotes/summary", next)
+	rec, e := authGet(t, closed, "")
+	if rec.Code != http.StatusUnauthorized || e.ID != errUnauthorized.ID || rec.Header().Get("WWW-Authenticate") == "" {
+		t.Fatalf("expected 401 %s, got %d %s", errUnauthorized.ID, rec.Code, e.ID)
+	}
+}
+
+func TestAuthenticatorKeys(t *testing.T) {
+	var principal auth.Principal
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ = auth.FromContext(r.Context())
+	})
+	h := guarded(newAuthenticator(newStubKeyRepo(testKeys), nil, false, ratelimit.NewLimiter()), nil, "/quotes/summary", next)
+
+	if rec, e := authGet(t, h, "qk_unknown_secret"); rec.Code != http.StatusUnauthorized || e.ID != errUnauthorized.ID {
+		t.Fatalf("expected unknown key to be rejected, got %d %s", rec.Code, e.ID)
+	}
+	if rec, e := authGet(t, h, "qk_admin_secret"); rec.Code != http.StatusForbidden || e.ID != errForbidden.ID {
+		t.Fatalf("expected missing scope to be forbidden, got %d %s", rec.Code, e.ID)
+	}
+
+	rec, _ := authGet(t, h, "qk_reader_secret")
+	if rec.Code != http.StatusOK || principal.Subject != "qk_reader" {
+		t.Fatalf("expected the reader key to be accepted, got %d %+v", rec.Code, principal)
+	}
+	if rec.Header().Get("X-RateLimit-Limit") != "2" || rec.Header().Get("X-RateLimit-Remaining") != "1" || rec.Header().Get("X-RateLimit-Reset") != "1" {
+		t.Fatalf("unexpected quota headers %v", rec.Header())
+	}
+}
+
+func TestAuthenticatorQuota(t *testing.T) {
+	h := guarded(newAuthenticator(newStubKeyRepo(testKeys), nil, false, ratelimit.NewLimiter()), nil, "/quotes/summary", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	authGet(t, h, "qk_reader_secret")
+	authGet(t, h, "qk_reader_secret")
+
+	rec, e := authGet(t, h, "qk_reader_secret")
+	if rec.Code != http.StatusTooManyRequests || e.ID != errRateLimited.ID {
+		t.Fatalf("expected 429 %s, got %d %s", errRateLimited.ID, rec.Code, e.ID)
+	}
+	if rec.Header().Get("Retry-After") != "1" || rec.Header().Get("X-RateLimit-Remaining") != "0" {
+		t.Fatalf("unexpected throttling headers %v", rec.Header())
+	}
+}
+
+func TestAuthenticatorCachesLookups(t *testing.T) {
+	keys := newStubKeyRepo(testKeys)
+	a := newAuthenticator(keys, nil, false, ratelimit.NewLimiter())
+	a.cache = cache.New[cachedKey](keyCacheSize, 10*time.Millisecond)
+	h := guarded(a, nil, "/quotes/summary", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	authGet(t, h, "qk_reader_secret")
+	authGet(t, h, "qk_unknown_secret")
+	authGet(t, h, "qk_unknown_secret")
+	if keys.lookups != 2 {
+		t.Fatalf("expected 2 lookups, got %d", keys.lookups)
+	}
+
+	delete(keys.keys, string(auth.HashKey("qk_reader_secret")))
+	time.Sleep(20 * time.Millisecond)
+	if rec, _ := authGet(t, h, "qk_reader_secret"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("revoked key must be rejected once the cache expires, got %d", rec.Code)
+	}
+}
+
+// stubVerifier accepts the tokens it maps to a principal.
+type stubVerifier map[string]auth.Principal
+
+func (s stubVerifier) Verify(ctx context.Context, token string) (auth.Principal, error) {
+	if token == "jwks-down" {
+		return auth.Principal{}, errors.New("load JWKS: connection refused")
+	}
+	p, ok := s[token]
+	if !ok {
+		return auth.Principal{}, fmt.Errorf("%w: bad signature", auth.ErrInvalidToken)
+	}
+	return p, nil
+}
+
+func bearerGet(h http.Handler, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/quotes/summary?ticker=PETR4", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAuthenticatorBearerTokens(t *testing.T) {
+	var principal auth.Principal
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ = auth.FromContext(r.Context())
+	})
+	tokens := stubVerifier{
+		"reader": {Subject: "svc-risk", Scopes: []string{auth.ReadQuotes}},
+		"admin":  {Subject: "svc-ingest", Scopes: []string{auth.AdminIngest}},
+	}
+	h := guarded(newAuthenticator(newStubKeyRepo(testKeys), tokens, true, ratelimit.NewLimiter()), nil, "/quotes/summary", next)
+
+	rec := bearerGet(h, "reader")
+	if rec.Code != http.StatusOK || principal.Subject != "svc-risk" || rec.Header().Get("X-RateLimit-Limit") != "" {
+		t.Fatalf("expected the token to be accepted without a quota, got %d %+v", rec.Code, principal)
+	}
+
+	rec = bearerGet(h, "forged")
+	challenges := rec.Header().Values("WWW-Authenticate")
+	if rec.Code != http.StatusUnauthorized || len(challenges) != 2 || challenges[1] != `Bearer realm="quotes", error="invalid_token"` {
+		t.Fatalf("expected 401 with an invalid_token challenge, got %d %v", rec.Code, challenges)
+	}
+
+	rec = bearerGet(h, "admin")
+	if rec.Code != http.StatusForbidden || !strings.Contains(rec.Header().Get("WWW-Authenticate"), `error="insufficient_scope"`) {
+		t.Fatalf("expected 403 insufficient_scope, got %d %v", rec.Code, rec.Header())
+	}
+
+	if rec := bearerGet(h, "jwks-down"); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected an unavailable JWKS to be a server error, got %d", rec.Code)
+	}
+
+	disabled := guarded(newAuthenticator(newStubKeyRepo(testKeys), nil, false, ratelimit.NewLimiter()), nil, "/quotes/summary", next)
+	if rec := bearerGet(disabled, "reader"); rec.Code != http.StatusUnauthorized || len(rec.Header().Values("WWW-Authenticate")) != 1 {
+		t.Fatalf("expected bearer tokens to be rejected when no JWKS is configured, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"desafiocotacaob3/internal/repository"
+)
+
+type latestSessionRepo interface {
+	LatestSession(ctx context.Context) (time.Time, bool, error)
+}
+
+type generationRepo interface {
+	IngestGeneration(ctx context.Context, through time.Time) (repository.Generation, bool, error)
+}
+
+// windowEnd is the last day the query of r covers: its to or date param, or
+// today when it has neither, in which case the window is open: it covers
+// whatever is ingested next. ok is false when the param is invalid, which the
+// handler reports.
+func windowEnd(r *http.Request) (end time.Time, open, ok bool) {
+	q := r.URL.Query()
+	for _, param := range []string{"to", "date"} {
+		if s := q.Get(param); s != "" {
+			t, err := time.Parse("2006-01-02", s)
+			return t, false, err == nil
+		}
+	}
+	now := time.Now().UTC()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC), true, true
+}
+
+// cacheValidators are the caching headers of a response.
+type cacheValidators struct {
+	etag         string
+	lastModified time.Time
+	cacheControl string
+}
+
+func (v cacheValidators) set(h http.Header) {
+	h.Set("ETag", v.etag)
+	h.Set("Last-Modified", v.lastModified.Format(http.TimeFormat))
+	h.Set("Cache-Control", v.cacheControl)
+	// The scope of Cache-Control depends on the credential headers.
+	h.Add("Vary", "Accept, Authorization, X-API-Key")
+}
+
+// notModified evaluates the preconditions of r against v as RFC 9110 orders
+// them: If-Modified-Since is only considered without If-None-Match.
+func (v cacheValidators) notModified(r *http.Request) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(v.etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	return err == nil && !v.lastModified.After(since)
+}
+
+// conditional serves GET requests of data endpoints with validators derived
+// from the ingest generation of the sessions the query covers. Ingest loads
+// whole sessions and never rewrites a loaded one, so the generation, with the
+// request, identifies the response: it only changes when a session covered
+// by the window is ingested, including one loaded late, after later ones.
+// Requests whose validators match get 304 without querying anything else.
+//
+// Windows ending before today and on or before the latest session only
+// change when a missing session is backfilled, so they are cacheable for
+// maxAge; others, which include today or have no end, for recentMaxAge. Responses to requests carrying credentials
+// are only cacheable privately.
+func conditional(repo generationRepo, maxAge, recentMaxAge time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		end, open, ok := windowEnd(r)
+		if !ok || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		gen, ok, err := repo.IngestGeneration(r.Context(), end)
+		if err != nil {
+			zerolog.Ctx(r.Context()).Warn().Err(err).Msg("failed to read ingest generation, response not cacheable")
+		}
+		if err != nil || !ok || gen.Seq == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		age := recentMaxAge
+		if !open && end.Before(time.Now().UTC().Truncate(24*time.Hour)) && !end.After(gen.Latest) {
+			age = maxAge
+		}
+		scope := "public"
+		if r.Header.Get(apiKeyHeader) != "" || r.Header.Get("Authorization") != "" {
+			scope = "private"
+		}
+		sum := sha256.Sum256([]byte(r.URL.Path + "?" + r.URL.Query().Encode() + "\n" + r.Header.Get("Accept") + "\n" + strconv.FormatInt(gen.Seq, 10)))
+		v := cacheValidators{
+			// Weak, since the body is the same whatever its encoding.
+			etag:         `W/"` + hex.EncodeToString(sum[:12]) + `"`,
+			lastModified: gen.At.UTC().Truncate(time.Second),
+			cacheControl: fmt.Sprintf("%s, max-age=%d", scope, int(age.Seconds())),
+		}
+
+		if v.notModified(r) {
+			v.set(w.Header())
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		cw := &cacheWriter{ResponseWriter: w, validators: v}
+		next.ServeHTTP(cw, r)
+		if !cw.wroteHeader {
+			// An empty 200, sent once the handler returns.
+			v.set(w.Header())
+		}
+	})
+}
+
+// cacheWriter adds the caching headers to successful responses only, so
+// errors are never cached.
+type cacheWriter struct {
+	http.ResponseWriter
+	validators  cacheValidators
+	wroteHeader bool
+}
+
+func (c *cacheWriter) WriteHeader(status int) {
+	if !c.wroteHeader {
+		c.wroteHeader = true
+		if status == http.StatusOK {
+			c.validators.set(c.Header())
+		}
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *cacheWriter) Write(b []byte) (int, error) {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+	return c.ResponseWriter.Write(b)
+}
+
+func (c *cacheWriter) Flush() {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (c *cacheWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
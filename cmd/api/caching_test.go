@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"desafiocotacaob3/internal/repository"
+)
+
+func cachedGet(h http.Handler, target string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// stubIngestLog is the ingests table, one entry per committed session.
+type stubIngestLog struct {
+	mu      sync.Mutex
+	ingests []repository.Ingest
+	err     error
+	calls   int
+}
+
+// ingest appends day, committed at.
+func (s *stubIngestLog) ingest(day, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ingests = append(s.ingests, repository.Ingest{Seq: int64(len(s.ingests) + 1), Date: day, At: at})
+}
+
+func (s *stubIngestLog) IngestGeneration(ctx context.Context, through time.Time) (repository.Generation, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var gen repository.Generation
+	for _, in := range s.ingests {
+		if in.Date.After(gen.Latest) {
+			gen.Latest = in.Date
+		}
+		if !in.Date.After(through) {
+			gen.Seq, gen.At = in.Seq, in.At
+		}
+	}
+	return gen, len(s.ingests) > 0, s.err
+}
+
+func (s *stubIngestLog) IngestsAfter(ctx context.Context, seq int64) ([]repository.Ingest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	var ingests []repository.Ingest
+	for _, in := range s.ingests {
+		if in.Seq > seq {
+			ingests = append(ingests, in)
+		}
+	}
+	return ingests, s.err
+}
+
+func (s *stubIngestLog) LatestIngest(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return int64(len(s.ingests)), s.err
+}
+
+// ingestLogFixture ingested the sessions of May 2024 up to the 10th, each on
+// the evening of its day.
+func ingestLogFixture() *stubIngestLog {
+	log := &stubIngestLog{}
+	for _, d := range []int{6, 7, 8, 9, 10} {
+		day := time.Date(2024, 5, d, 0, 0, 0, 0, time.UTC)
+		log.ingest(day, day.Add(20*time.Hour))
+	}
+	return log
+}
+
+func TestConditionalHistoricalWindow(t *testing.T) {
+	calls := 0
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		_, _ = w.Write([]byte("{}"))
+	})
+	repo := ingestLogFixture()
+	h := conditional(repo, 24*time.Hour, time.Minute, next)
+	target := "/v1/quotes/analytics?ticker=PETR4&from=2024-05-01&to=2024-05-09"
+
+	rec := cachedGet(h, target, nil)
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag == "" || rec.Header().Get("Last-Modified") != "Thu, 09 May 2024 20:00:00 GMT" {
+		t.Fatalf("expected validators, got %d %v", rec.Code, rec.Header())
+	}
+	if cc := rec.Header().Get("Cache-Control"); cc != "public, max-age=86400" {
+		t.Fatalf("expected a long-lived cache for a past window, got %q", cc)
+	}
+	if vary := rec.Header().Get("Vary"); vary != "Accept, Authorization, X-API-Key" {
+		t.Fatalf("expected the response to vary with the credential, got %q", vary)
+	}
+
+	for _, hdr := range []map[string]string{
+		{"If-None-Match": etag},
+		{"If-None-Match": `"other", ` + etag[2:]},
+		{"If-Modified-Since": "Thu, 09 May 2024 20:00:00 GMT"},
+	} {
+		if rec := cachedGet(h, target, hdr); rec.Code != http.StatusNotModified || rec.Header().Get("ETag") != etag || rec.Body.Len() != 0 {
+			t.Fatalf("%v: expected 304, got %d", hdr, rec.Code)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("304 responses must not run the handler, ran %d times", calls)
+	}
+
+	// If-None-Match takes precedence over If-Modified-Since.
+	rec = cachedGet(h, target, map[string]string{"If-None-Match": `W/"stale"`, "If-Modified-Since": "Fri, 10 May 2024 00:00:00 GMT"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected a mismatching ETag to be served, got %d", rec.Code)
+	}
+
+	// Ingesting later sessions does not change a past window.
+	repo.ingest(time.Date(2024, 5, 13, 0, 0, 0, 0, time.UTC), time.Date(2024, 5, 13, 20, 0, 0, 0, time.UTC))
+	if rec := cachedGet(h, target, map[string]string{"If-None-Match": etag}); rec.Code != http.StatusNotModified {
+		t.Fatalf("expected the past window to stay valid, got %d", rec.Code)
+	}
+
+	// Backfilling a session it covers does, even after later sessions.
+	repo.ingest(time.Date(2024, 5, 3, 0, 0, 0, 0, time.UTC), time.Date(2024, 5, 14, 9, 0, 0, 0, time.UTC))
+	rec = cachedGet(h, target, map[string]string{"If-None-Match": etag})
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag || rec.Header().Get("Last-Modified") != "Tue, 14 May 2024 09:00:00 GMT" {
+		t.Fatalf("expected a backfilled session to change the window, got %d %v", rec.Code, rec.Header())
+	}
+}
+
+func TestConditionalOpenWindow(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	repo := ingestLogFixture()
+	h := conditional(repo, 24*time.Hour, time.Minute, next)
+	target := "/v1/quotes/summary?ticker=PETR4"
+
+	rec := cachedGet(h, target, map[string]string{apiKeyHeader: "qk_reader_secret"})
+	etag := rec.Header().Get("ETag")
+	if rec.Header().Get("Cache-Control") != "private, max-age=60" || rec.Header().Get("Last-Modified") != "Fri, 10 May 2024 20:00:00 GMT" {
+		t.Fatalf("expected a short private cache up to the latest session, got %v", rec.Header())
+	}
+
+	repo.ingest(time.Date(2024, 5, 13, 0, 0, 0, 0, time.UTC), time.Date(2024, 5, 13, 20, 0, 0, 0, time.UTC))
+	rec = cachedGet(h, target, map[string]string{"If-None-Match": etag})
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag {
+		t.Fatalf("expected a new session to change the response, got %d", rec.Code)
+	}
+}
+
+func TestConditionalWindowsIncludingToday(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	repo := ingestLogFixture()
+	repo.ingest(today, now)
+	h := conditional(repo, 24*time.Hour, time.Minute, next)
+
+	for _, target := range []string{
+		"/v1/quotes/summary?ticker=PETR4",
+		"/v1/quotes/analytics?ticker=PETR4&to=" + today.Format("2006-01-02"),
+	} {
+		if cc := cachedGet(h, target, nil).Header().Get("Cache-Control"); cc != "public, max-age=60" {
+			t.Fatalf("%s: expected a short cache once today is ingested, got %q", target, cc)
+		}
+	}
+	past := "/v1/quotes/analytics?ticker=PETR4&to=" + today.AddDate(0, 0, -1).Format("2006-01-02")
+	if cc := cachedGet(h, past, nil).Header().Get("Cache-Control"); cc != "public, max-age=86400" {
+		t.Fatalf("expected a long cache for a window ending yesterday, got %q", cc)
+	}
+}
+
+func TestConditionalSkipsErrors(t *testing.T) {
+	failing := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, r, http.StatusNotFound, errTickerNotFound)
+	})
+	repo := ingestLogFixture()
+	rec := cachedGet(conditional(repo, time.Hour, time.Minute, failing), "/v1/quotes/summary?ticker=XXXX", nil)
+	if rec.Code != http.StatusNotFound || rec.Header().Get("ETag") != "" || rec.Header().Get("Cache-Control") != "" {
+		t.Fatalf("errors must not carry validators, got %d %v", rec.Code, rec.Header())
+	}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for name, tt := range map[string]struct {
+		repo   *stubIngestLog
+		target string
+	}{
+		"no data":            {&stubIngestLog{}, "/v1/quotes/summary?ticker=PETR4"},
+		"db failure":         {&stubIngestLog{err: errors.New("connection refused")}, "/v1/quotes/summary?ticker=PETR4"},
+		"before any session": {repo, "/v1/quotes/analytics?ticker=PETR4&to=2024-01-31"},
+	} {
+		if rec := cachedGet(conditional(tt.repo, time.Hour, time.Minute, ok), tt.target, nil); rec.Code != http.StatusOK || rec.Header().Get("ETag") != "" {
+			t.Fatalf("%s: expected an uncached response, got %d %v", name, rec.Code, rec.Header())
+		}
+	}
+	if rec := cachedGet(conditional(repo, time.Hour, time.Minute, ok), "/v1/quotes/analytics?to=someday", nil); rec.Header().Get("ETag") != "" {
+		t.Fatalf("invalid windows must be left to the handler")
+	}
+}
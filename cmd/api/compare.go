@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"desafiocotacaob3/internal/analytics"
+)
+
+const maxCompareTickers = 20
+
+var (
+	errMissingTickers  = apiError{ID: "ERR_MISSING_TICKERS", Message: "tickers query param is required"}
+	errTooFewTickers   = apiError{ID: "ERR_TOO_FEW_TICKERS", Message: "at least two distinct tickers are required"}
+	errTooManyTickers  = apiError{ID: "ERR_TOO_MANY_TICKERS", Message: "at most 20 tickers are allowed"}
+	errTickersNotFound = apiError{ID: "ERR_TICKER_NOT_FOUND", Message: "no data for one or more tickers"}
+)
+
+type correlationResponse struct {
+	Tickers      []string            `json:"tickers"`
+	From         string              `json:"from"`
+	To           string              `json:"to"`
+	Matrix       [][]*float64        `json:"matrix"`
+	Observations [][]int             `json:"observations"`
+	Missing      map[string][]string `json:"missing"`
+}
+
+type compareResponse struct {
+	Tickers []string              `json:"tickers"`
+	From    string                `json:"from"`
+	To      string                `json:"to"`
+	Dates   []string              `json:"dates"`
+	Series  map[string][]*float64 `json:"series"`
+	Missing map[string][]string   `json:"missing"`
+}
+
+// parseTickers splits the comma-separated tickers param, upper-casing and
+// dropping duplicates while keeping the requested order.
+func parseTickers(r *http.Request) ([]string, *apiError) {
+	raw := r.URL.Query().Get("tickers")
+	if raw == "" {
+		return nil, &errMissingTickers
+	}
+	seen := make(map[string]struct{})
+	var tickers []string
+	for _, t := range strings.Split(raw, ",") {
+		t = strings.ToUpper(strings.TrimSpace(t))
+		if t == "" {
+			continue
+		}
+		if _, ok := seen[t]; ok {
+			continue
+		}
+		seen[t] = struct{}{}
+		tickers = append(tickers, t)
+	}
+	if len(tickers) == 0 {
+		return nil, &errMissingTickers
+	}
+	if len(tickers) > maxCompareTickers {
+		return nil, &errTooManyTickers
+	}
+	return tickers, nil
+}
+
+// loadAligned fetches the daily closes of every ticker and aligns them on the
+// union of their sessions. missing lists, per ticker, the sessions in that
+// union on which it did not trade.
+func loadAligned(w http.ResponseWriter, r *http.Request, repo dailyBarsRepo, tickers []string, from, to time.Time) (dates []time.Time, closes [][]float64, missing map[string][]string, ok bool) {
+	series := make([][]analytics.Point, len(tickers))
+	for i, ticker := range tickers {
+		bars, err := repo.DailyBars(r.Context(), ticker, from, to)
+		if err != nil {
+			writeFailure(w, r, err)
+			return nil, nil, nil, false
+		}
+		if len(bars) == 0 {
+			writeError(w, r, http.StatusNotFound, errTickersNotFound)
+			return nil, nil, nil, false
+		}
+		series[i] = make([]analytics.Point, len(bars))
+		for j, b := range bars {
+			series[i][j] = analytics.Point{Date: b.Time, Close: b.Close}
+		}
+	}
+
+	dates, closes = analytics.Align(series)
+	missing = make(map[string][]string, len(tickers))
+	for i, ticker := range tickers {
+		missing[ticker] = []string{}
+		for j, c := range closes[i] {
+			if math.IsNaN(c) {
+				missing[ticker] = append(missing[ticker], dates[j].Format("2006-01-02"))
+			}
+		}
+	}
+	return dates, closes, missing, true
+}
+
+func nullableFloat(v float64) *float64 {
+	if math.IsNaN(v) {
+		return nil
+	}
+	return &v
+}
+
+func quotesCorrelationHandler(repo dailyBarsRepo) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tickers, apiErr := parseTickers(r)
+		if apiErr != nil {
+			writeError(w, r, http.StatusBadRequest, *apiErr)
+			return
+		}
+		if len(tickers) < 2 {
+			writeError(w, r, http.StatusBadRequest, errTooFewTickers)
+			return
+		}
+		from, to, apiErr := parseDateRange(r, analyticsDefaultDays)
+		if apiErr != nil {
+			writeError(w, r, http.StatusBadRequest, *apiErr)
+			return
+		}
+
+		_, closes, missing, ok := loadAligned(w, r, repo, tickers, from, to)
+		if !ok {
+			return
+		}
+		returns := make([][]float64, len(closes))
+		for i, c := range closes {
+			returns[i] = analytics.AlignedLogReturns(c)
+		}
+
+		resp := correlationResponse{
+			Tickers:      tickers,
+			From:         from.Format("2006-01-02"),
+			To:           to.Format("2006-01-02"),
+			Matrix:       make([][]*float64, len(tickers)),
+			Observations: make([][]int, len(tickers)),
+			Missing:      missing,
+		}
+		for i := range tickers {
+			resp.Matrix[i] = make([]*float64, len(tickers))
+			resp.Observations[i] = make([]int, len(tickers))
+		}
+		for i := range tickers {
+			for j := i; j < len(tickers); j++ {
+				c, n := analytics.Correlation(returns[i], returns[j])
+				resp.Matrix[i][j], resp.Matrix[j][i] = nullableFloat(c), nullableFloat(c)
+				resp.Observations[i][j], resp.Observations[j][i] = n, n
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func quotesCompareHandler(repo dailyBarsRepo) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tickers, apiErr := parseTickers(r)
+		if apiErr != nil {
+			writeError(w, r, http.StatusBadRequest, *apiErr)
+			return
+		}
+		from, to, apiErr := parseDateRange(r, analyticsDefaultDays)
+		if apiErr != nil {
+			writeError(w, r, http.StatusBadRequest, *apiErr)
+			return
+		}
+
+		dates, closes, missing, ok := loadAligned(w, r, repo, tickers, from, to)
+		if !ok {
+			return
+		}
+
+		resp := compareResponse{
+			Tickers: tickers,
+			From:    from.Format("2006-01-02"),
+			To:      to.Format("2006-01-02"),
+			Dates:   make([]string, len(dates)),
+			Series:  make(map[string][]*float64, len(tickers)),
+			Missing: missing,
+		}
+		for i, d := range dates {
+			resp.Dates[i] = d.Format("2006-01-02")
+		}
+		for i, ticker := range tickers {
+			rebased := analytics.Rebase(closes[i], 100)
+			values := make([]*float64, len(rebased))
+			for j, v := range rebased {
+				values[j] = nullableFloat(v)
+			}
+			resp.Series[ticker] = values
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
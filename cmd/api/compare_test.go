@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"desafiocotacaob3/internal/repository"
+)
+
+type stubMultiBarsRepo map[string][]repository.Bar
+
+func (s stubMultiBarsRepo) DailyBars(ctx context.Context, ticker string, from, to time.Time) ([]repository.Bar, error) {
+	return s[ticker], nil
+}
+
+var compareFixture = stubMultiBarsRepo{
+	"PETR4": {dailyBar(2, 10), dailyBar(3, 11), dailyBar(6, 12), dailyBar(7, 13)},
+	"VALE3": {dailyBar(2, 20), dailyBar(3, 22), dailyBar(7, 26)},
+}
+
+func TestQuotesCorrelation(t *testing.T) {
+	srv := httptest.NewServer(quotesCorrelationHandler(compareFixture))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/quotes/correlation?tickers=petr4,VALE3,PETR4&from=2024-05-01&to=2024-05-10")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	var c correlationResponse
+	if err := json.NewDecoder(resp.Body).Decode(&c); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(c.Tickers) != 2 {
+		t.Fatalf("expected duplicate tickers to be dropped, got %v", c.Tickers)
+	}
+	if c.Matrix[0][0] == nil || *c.Matrix[0][0] != 1 {
+		t.Fatalf("expected unit diagonal, got %+v", c.Matrix)
+	}
+	// VALE3 has no session on 2024-05-06, so only the 05-03 return overlaps.
+	if c.Observations[0][1] != 1 || c.Matrix[0][1] != nil {
+		t.Fatalf("expected a single overlapping return and no correlation, got %+v %+v", c.Observations, c.Matrix)
+	}
+	if len(c.Missing["VALE3"]) != 1 || c.Missing["VALE3"][0] != "2024-05-06" {
+		t.Fatalf("unexpected missing sessions %+v", c.Missing)
+	}
+}
+
+func TestQuotesCorrelationTooFewTickers(t *testing.T) {
+	srv := httptest.NewServer(quotesCorrelationHandler(compareFixture))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/quotes/correlation?tickers=PETR4")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", resp.StatusCode)
+	}
+	var e apiError
+	if err := json.NewDecoder(resp.Body).Decode(&e); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if e.ID != errTooFewTickers.ID {
+		t.Fatalf("expected error %s, got %s", errTooFewTickers.ID, e.ID)
+	}
+}
+
+func TestQuotesCompare(t *testing.T) {
+	srv := httptest.NewServer(quotesCompareHandler(compareFixture))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/quotes/compare?tickers=PETR4,VALE3&from=2024-05-01&to=2024-05-10")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	var c compareResponse
+	if err := json.NewDecoder(resp.Body).Decode(&c); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(c.Dates) != 4 {
+		t.Fatalf("expected 4 aligned dates, got %v", c.Dates)
+	}
+	vale := c.Series["VALE3"]
+	if *vale[0] != 100 || vale[2] != nil || *vale[3] != 130 {
+		t.Fatalf("unexpected VALE3 series %v", vale)
+	}
+	if *c.Series["PETR4"][3] != 130 {
+		t.Fatalf("unexpected PETR4 series %v", c.Series["PETR4"])
+	}
+}
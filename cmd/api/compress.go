@@ -0,0 +1,226 @@
+package main
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// encoder is a reusable compressor of response bodies.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// codec is a content coding with a pool of its encoders.
+type codec struct {
+	name string
+	pool sync.Pool
+}
+
+func newCodec(name string, newEncoder func() encoder) *codec {
+	return &codec{name: name, pool: sync.Pool{New: func() any { return newEncoder() }}}
+}
+
+// codecs are the content codings offered, in order of preference when the
+// client accepts several equally. Levels favor speed: responses are
+// compressed on every request, not once ahead of time.
+var codecs = []*codec{
+	newCodec("zstd", func() encoder {
+		// Single-threaded, since one encoder serves one response at a time.
+		e, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithEncoderConcurrency(1))
+		return e
+	}),
+	newCodec("br", func() encoder { return brotli.NewWriterLevel(nil, 4) }),
+	newCodec("gzip", func() encoder {
+		e, _ := gzip.NewWriterLevel(nil, gzip.DefaultCompression)
+		return e
+	}),
+}
+
+// incompressible are media types that are compressed already.
+var incompressible = map[string]bool{
+	"application/vnd.apache.parquet": true,
+	"application/zip":                true,
+	"application/gzip":               true,
+	"application/zstd":               true,
+}
+
+// negotiateEncoding picks the codec r accepts with the highest quality, or
+// nil for identity.
+func negotiateEncoding(r *http.Request) *codec {
+	accepted := make(map[string]float64)
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		if k, v, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(k) == "q" {
+			if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				q = f
+			}
+		}
+		accepted[name] = q
+	}
+	var best *codec
+	bestQ := 0.0
+	for _, c := range codecs {
+		q, ok := accepted[c.name]
+		if !ok {
+			q, ok = accepted["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = c, q
+		}
+	}
+	return best
+}
+
+// compress encodes response bodies of at least minSize bytes with the best
+// coding the client accepts. Smaller bodies are sent as they are, since
+// compressing them costs more than it saves. Flushing a response, as the
+// streaming exports do, starts compressing it right away whatever its size.
+// Protocol upgrades are left alone.
+func compress(next http.Handler, minSize int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		c := negotiateEncoding(r)
+		if c == nil || r.Method == http.MethodHead || r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, codec: c, minSize: minSize}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// compressWriter buffers the start of a body until it knows whether the
+// body is worth compressing.
+type compressWriter struct {
+	http.ResponseWriter
+	codec   *codec
+	minSize int
+
+	status  int
+	buf     []byte
+	started bool
+	enc     encoder
+}
+
+func (c *compressWriter) WriteHeader(status int) {
+	if c.started || c.status != 0 {
+		return
+	}
+	if status < http.StatusOK {
+		c.ResponseWriter.WriteHeader(status)
+		return
+	}
+	c.status = status
+	if status == http.StatusNoContent || status == http.StatusNotModified {
+		c.start(false)
+	}
+}
+
+func (c *compressWriter) Write(b []byte) (int, error) {
+	if c.started {
+		if c.enc != nil {
+			return c.enc.Write(b)
+		}
+		return c.ResponseWriter.Write(b)
+	}
+	c.buf = append(c.buf, b...)
+	if len(c.buf) >= c.minSize {
+		if err := c.start(c.compressible()); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+func (c *compressWriter) Flush() {
+	if !c.started {
+		if err := c.start(c.compressible()); err != nil {
+			return
+		}
+	}
+	if c.enc != nil {
+		if err := c.enc.Flush(); err != nil {
+			return
+		}
+	}
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (c *compressWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// compressible reports whether the response may be encoded: it is not
+// encoded already and its media type does not compress.
+func (c *compressWriter) compressible() bool {
+	h := c.Header()
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	return !incompressible[mediaType] && !strings.HasPrefix(mediaType, "image/")
+}
+
+// start sends the headers, encoded if enc, and the buffered body.
+func (c *compressWriter) start(enc bool) error {
+	c.started = true
+	if enc {
+		h := c.Header()
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", c.codec.name)
+		c.enc = c.codec.pool.Get().(encoder)
+		c.enc.Reset(c.ResponseWriter)
+	}
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	c.ResponseWriter.WriteHeader(c.status)
+	if len(c.buf) == 0 {
+		return nil
+	}
+	var err error
+	if c.enc != nil {
+		_, err = c.enc.Write(c.buf)
+	} else {
+		_, err = c.ResponseWriter.Write(c.buf)
+	}
+	c.buf = nil
+	return err
+}
+
+// close sends whatever is still buffered, uncompressed since it is below
+// minSize, or terminates the encoded stream.
+func (c *compressWriter) close() {
+	if !c.started {
+		if c.status == 0 && len(c.buf) == 0 {
+			// Nothing was written: let net/http send its empty 200.
+			return
+		}
+		_ = c.start(false)
+		return
+	}
+	if c.enc != nil {
+		_ = c.enc.Close()
+		c.enc.Reset(io.Discard)
+		c.codec.pool.Put(c.enc)
+		c.enc = nil
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+func decode(t *testing.T, encoding string, body io.Reader) string {
+	t.Helper()
+	var r io.Reader
+	switch encoding {
+	case "gzip":
+		gr, err := gzip.NewReader(body)
+		if err != nil {
+			t.Fatalf("gzip: %v", err)
+		}
+		r = gr
+	case "zstd":
+		zr, err := zstd.NewReader(body)
+		if err != nil {
+			t.Fatalf("zstd: %v", err)
+		}
+		defer zr.Close()
+		r = zr
+	case "br":
+		r = brotli.NewReader(body)
+	default:
+		r = body
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("decode %s: %v", encoding, err)
+	}
+	return string(b)
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	for accept, want := range map[string]string{
+		"":                           "",
+		"identity":                   "",
+		"gzip":                       "gzip",
+		"gzip, deflate, br":          "br",
+		"gzip, br, zstd":             "zstd",
+		"zstd;q=0.5, gzip":           "gzip",
+		"BR;q=0.8, gzip;q=0.9":       "gzip",
+		"*":                          "zstd",
+		"*;q=0.5, zstd;q=0, gzip":    "gzip",
+		"gzip;q=0, br;q=0, zstd;q=0": "",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Encoding", accept)
+		got := ""
+		if c := negotiateEncoding(req); c != nil {
+			got = c.name
+		}
+		if got != want {
+			t.Errorf("Accept-Encoding %q: expected %q, got %q", accept, want, got)
+		}
+	}
+}
+
+func TestCompressLargeBodies(t *testing.T) {
+	body := strings.Repeat(`{"ticker":"PETR4","price":38.12},`, 100)
+	h := compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Length", "3300")
+		for i := 0; i < 100; i++ {
+			_, _ = io.WriteString(w, `{"ticker":"PETR4","price":38.12},`)
+		}
+	}), 1024)
+
+	for _, encoding := range []string{"gzip", "br", "zstd"} {
+		rec := cachedGet(h, "/", map[string]string{"Accept-Encoding": encoding})
+		if got := rec.Header().Get("Content-Encoding"); got != encoding {
+			t.Fatalf("expected %s, got %q", encoding, got)
+		}
+		if rec.Header().Get("Content-Length") != "" {
+			t.Fatalf("a compressed response must not keep the original Content-Length")
+		}
+		if rec.Header().Get("Vary") != "Accept-Encoding" {
+			t.Fatalf("expected Vary: Accept-Encoding, got %v", rec.Header()["Vary"])
+		}
+		if rec.Body.Len() >= len(body) {
+			t.Fatalf("%s did not shrink the body: %d bytes", encoding, rec.Body.Len())
+		}
+		if got := decode(t, encoding, rec.Body); got != body {
+			t.Fatalf("%s round trip mismatch", encoding)
+		}
+	}
+}
+
+func TestCompressSkips(t *testing.T) {
+	large := strings.Repeat("x", 2048)
+	cases := map[string]http.HandlerFunc{
+		"small body": func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, r, http.StatusNotFound, errTickersNotFound)
+		},
+		"no content": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		},
+		"not modified": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotModified)
+		},
+		"empty": func(w http.ResponseWriter, r *http.Request) {},
+		"compressed type": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/vnd.apache.parquet")
+			_, _ = io.WriteString(w, large)
+		},
+		"already encoded": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Encoding", "identity")
+			_, _ = io.WriteString(w, large)
+		},
+	}
+	for name, next := range cases {
+		rec := cachedGet(compress(next, 1024), "/", map[string]string{"Accept-Encoding": "gzip"})
+		if got := rec.Header().Get("Content-Encoding"); got == "gzip" {
+			t.Errorf("%s: expected no compression", name)
+		}
+		if rec.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("%s: expected Vary: Accept-Encoding even when not compressing", name)
+		}
+	}
+
+	rec := cachedGet(compress(cases["small body"], 1024), "/", map[string]string{"Accept-Encoding": "gzip"})
+	if rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), errTickersNotFound.ID) {
+		t.Fatalf("expected the error body as is, got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestCompressFlushesStreams(t *testing.T) {
+	next := make(chan struct{})
+	h := compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		for i := 0; i < 2; i++ {
+			_, _ = io.WriteString(w, "{\"n\":1}\n")
+			http.NewResponseController(w).Flush()
+			<-next
+		}
+	}), 1024)
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected a flushed stream to be compressed, got %v", resp.Header)
+	}
+	gr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	// The first line arrives before the handler writes the second.
+	line, err := bufio.NewReader(gr).ReadString('\n')
+	if err != nil || line != "{\"n\":1}\n" {
+		t.Fatalf("expected the flushed line, got %q, %v", line, err)
+	}
+	close(next)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	"desafiocotacaob3/internal/repository"
+)
+
+var (
+	errInternal    = apiError{ID: "ERR_INTERNAL", Message: "unexpected server error, quote the request_id when reporting it"}
+	errTimeout     = apiError{ID: "ERR_TIMEOUT", Message: "the query took too long, try a narrower range"}
+	errUnavailable = apiError{ID: "ERR_UNAVAILABLE", Message: "the database is temporarily unavailable"}
+)
+
+// statusClientClosedRequest is the non-standard status, borrowed from nginx,
+// logged for requests the client abandoned before a response was written.
+const statusClientClosedRequest = 499
+
+// domainErrors maps the errors returned by lower layers to what clients see.
+// Anything not listed is an internal error, whose detail is only logged.
+var domainErrors = []struct {
+	err    error
+	status int
+	apiErr apiError
+}{
+	{repository.ErrTimeout, http.StatusGatewayTimeout, errTimeout},
+	{repository.ErrUnavailable, http.StatusServiceUnavailable, errUnavailable},
+}
+
+// problemJSON is the RFC 7807 media type, sent when the client accepts it.
+const problemJSON = "application/problem+json"
+
+// problem is an RFC 7807 problem detail. id and request_id are extension
+// members carrying the same values as apiError.
+type problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail"`
+	Instance  string `json:"instance,omitempty"`
+	ID        string `json:"id"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// wantsProblem reports whether the Accept header of r lists problemJSON.
+func wantsProblem(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err == nil && mt == problemJSON && params["q"] != "0" {
+			return true
+		}
+	}
+	return false
+}
+
+// writeError sends e with status, as application/problem+json when the
+// client asks for it and as a plain apiError otherwise.
+func writeError(w http.ResponseWriter, r *http.Request, status int, e apiError) {
+	e.RequestID = requestID(w)
+	if wantsProblem(r) {
+		w.Header().Set("Content-Type", problemJSON)
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(problem{
+			Type:      "about:blank",
+			Title:     http.StatusText(status),
+			Status:    status,
+			Detail:    e.Message,
+			Instance:  r.URL.Path,
+			ID:        e.ID,
+			RequestID: e.RequestID,
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(e)
+}
+
+// writeFailure answers a request that failed with err. Domain errors get
+// their own ID and status; anything else is logged with its detail and
+// reported as an opaque ERR_INTERNAL that support can find by request_id.
+func writeFailure(w http.ResponseWriter, r *http.Request, err error) {
+	err = repository.Classify(err)
+	logger := zerolog.Ctx(r.Context())
+	if errors.Is(err, context.Canceled) && r.Context().Err() != nil {
+		logger.Info().Err(err).Str("path", r.URL.Path).Msg("client went away")
+		w.WriteHeader(statusClientClosedRequest)
+		return
+	}
+	for _, d := range domainErrors {
+		if errors.Is(err, d.err) {
+			logger.Warn().Err(err).Str("path", r.URL.Path).Str("error_id", d.apiErr.ID).Msg("request failed")
+			writeError(w, r, d.status, d.apiErr)
+			return
+		}
+	}
+	logger.Error().Err(err).Str("path", r.URL.Path).Msg("request failed")
+	writeError(w, r, http.StatusInternalServerError, errInternal)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestInternalErrorIsOpaque(t *testing.T) {
+	captureLog(t)
+	repo := &stubSummaryRepo{err: errors.New(`pq: password authentication failed for user "postgres"`)}
+	h := requestLogger(quotesSummaryHandler(repo))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/quotes/summary?ticker=PETR4", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status 500, got %d", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), "postgres") {
+		t.Fatalf("internal error leaked: %s", rec.Body)
+	}
+	var e apiError
+	if err := json.NewDecoder(rec.Body).Decode(&e); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if e != (apiError{ID: errInternal.ID, Message: errInternal.Message, RequestID: rec.Header().Get(requestIDHeader)}) || e.RequestID == "" {
+		t.Fatalf("unexpected error %+v", e)
+	}
+}
+
+func TestDomainErrorsMapped(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		id     string
+	}{
+		{fmt.Errorf("query: %w", context.DeadlineExceeded), http.StatusGatewayTimeout, errTimeout.ID},
+		{errors.New("driver: bad connection"), http.StatusInternalServerError, errInternal.ID},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		quotesSummaryHandler(&stubSummaryRepo{err: tt.err})(rec, httptest.NewRequest(http.MethodGet, "/quotes/summary?ticker=PETR4", nil))
+		var e apiError
+		if err := json.NewDecoder(rec.Body).Decode(&e); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if rec.Code != tt.status || e.ID != tt.id {
+			t.Fatalf("%v: expected %d %s, got %d %s", tt.err, tt.status, tt.id, rec.Code, e.ID)
+		}
+	}
+}
+
+func TestProblemJSON(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/quotes/summary", nil)
+	req.Header.Set("Accept", "application/problem+json, application/json;q=0.9")
+	rec := httptest.NewRecorder()
+	quotesSummaryHandler(&stubSummaryRepo{})(rec, req)
+
+	if ct := rec.Header().Get("Content-Type"); ct != problemJSON {
+		t.Fatalf("expected %s, got %s", problemJSON, ct)
+	}
+	var p problem
+	if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	want := problem{Type: "about:blank", Title: "Bad Request", Status: http.StatusBadRequest, Detail: errMissingTicker.Message, Instance: "/quotes/summary", ID: errMissingTicker.ID}
+	if p != want {
+		t.Fatalf("unexpected problem %+v", p)
+	}
+}
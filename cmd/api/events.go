@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"desafiocotacaob3/internal/cache"
+	"desafiocotacaob3/internal/repository"
+)
+
+const (
+	// eventHeartbeat is how often an idle event stream sends a comment, so
+	// proxies do not close it and clients notice a dead connection.
+	eventHeartbeat = 15 * time.Second
+	// eventRetry is the reconnection delay suggested to clients, in
+	// milliseconds.
+	eventRetry = 3000
+	// eventMaxReplay is how many ingests back a stream may resume, so a
+	// forged or ancient Last-Event-ID cannot replay the whole history.
+	eventMaxReplay = 30
+)
+
+var errInvalidEventID = apiError{ID: "ERR_INVALID_EVENT_ID", Message: "Last-Event-ID must be an event id as sent by the stream"}
+
+type quoteEventsRepo interface {
+	sessionStatsRepo
+	IngestsAfter(ctx context.Context, seq int64) ([]repository.Ingest, error)
+	LatestIngest(ctx context.Context) (int64, error)
+}
+
+// barEvent is the daily bar of a subscribed ticker in a newly ingested
+// session.
+type barEvent struct {
+	Ticker    string  `json:"ticker"`
+	Date      string  `json:"date"`
+	Open      float64 `json:"open"`
+	High      float64 `json:"high"`
+	Low       float64 `json:"low"`
+	Close     float64 `json:"close"`
+	PrevClose float64 `json:"prev_close,omitempty"`
+	Volume    int64   `json:"volume"`
+	Notional  float64 `json:"notional"`
+	Trades    int64   `json:"trades"`
+}
+
+// ingestedEvent closes the events of a session, after its bars.
+type ingestedEvent struct {
+	Date    string `json:"date"`
+	Tickers int    `json:"tickers"`
+}
+
+// quoteEvents wakes the event streams when ingest commits a session. Streams
+// then read the ingests after the last one they sent, in commit order, so a
+// session loaded late is sent too, a notification carries no data and a
+// missed one costs nothing but latency. Queries are shared between streams:
+// most wait at the same ingest and all of them read the same new ones.
+type quoteEvents struct {
+	repo    quoteEventsRepo
+	ingests *cache.Cache[[]repository.Ingest]
+	stats   *cache.Cache[[]repository.SessionStats]
+
+	mu      sync.Mutex
+	subs    map[chan struct{}]struct{}
+	closed  bool
+	closing chan struct{}
+}
+
+func newQuoteEvents(repo quoteEventsRepo) *quoteEvents {
+	return &quoteEvents{
+		repo: repo,
+		// Purged on every notification.
+		ingests: cache.New[[]repository.Ingest](64, time.Hour),
+		// Ingested sessions are never rewritten.
+		stats:   cache.New[[]repository.SessionStats](8, time.Hour),
+		subs:    make(map[chan struct{}]struct{}),
+		closing: make(chan struct{}),
+	}
+}
+
+// notify wakes every stream. It is called with the day of a committed
+// session, or an empty day when notifications may have been missed.
+func (e *quoteEvents) notify(day string) {
+	e.ingests.Purge()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for ch := range e.subs {
+		select {
+		case ch <- struct{}{}:
+		default:
+			// Already woken.
+		}
+	}
+}
+
+// close ends every stream, so the server can shut down without waiting for
+// clients that would never leave.
+func (e *quoteEvents) close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return
+	}
+	e.closed = true
+	close(e.closing)
+	for ch := range e.subs {
+		close(ch)
+		delete(e.subs, ch)
+	}
+}
+
+// done is closed on shutdown, for streams that are not woken by ingest.
+func (e *quoteEvents) done() <-chan struct{} {
+	return e.closing
+}
+
+// subscribe returns a channel that receives after every notification and is
+// closed on shutdown, or false if the server is shutting down already.
+func (e *quoteEvents) subscribe() (<-chan struct{}, func(), bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return nil, nil, false
+	}
+	ch := make(chan struct{}, 1)
+	e.subs[ch] = struct{}{}
+	return ch, func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if _, ok := e.subs[ch]; ok {
+			delete(e.subs, ch)
+			close(ch)
+		}
+	}, true
+}
+
+// ingestsAfter lists the ingests committed after seq.
+func (e *quoteEvents) ingestsAfter(ctx context.Context, seq int64) ([]repository.Ingest, error) {
+	return e.ingests.Get(ctx, strconv.FormatInt(seq, 10), func(ctx context.Context) ([]repository.Ingest, error) {
+		return e.repo.IngestsAfter(ctx, seq)
+	})
+}
+
+// resumeFrom is the ingest a stream whose client last got the event id
+// resumes after, bounded to the last eventMaxReplay ingests before latest.
+// ok is false when id is not an event id.
+func resumeFrom(id string, latest int64) (seq int64, ok bool) {
+	seq, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || seq < 0 {
+		return 0, false
+	}
+	return min(max(seq, latest-eventMaxReplay), latest), true
+}
+
+func (e *quoteEvents) sessionStats(ctx context.Context, day time.Time) ([]repository.SessionStats, error) {
+	return e.stats.Get(ctx, day.Format("2006-01-02"), func(ctx context.Context) ([]repository.SessionStats, error) {
+		return e.repo.SessionStats(ctx, day)
+	})
+}
+
+// writeEvent sends one event; an empty id leaves the client's last event id
+// as it was.
+func writeEvent(w http.ResponseWriter, id, event string, data any) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+	return err
+}
+
+// quoteStreamHandler pushes, as Server-Sent Events, a bar event for each
+// subscribed ticker traded in every session ingested while the client is
+// connected, followed by an ingested event whose id is the sequence number of
+// the ingest. Reconnecting with that id in Last-Event-ID replays the ingests
+// committed since, up to eventMaxReplay; without it the stream starts after
+// the latest ingest. Each catch-up is bounded by queryTimeout, while the
+// stream itself lasts until the client or the server leaves.
+func quoteStreamHandler(events *quoteEvents, queryTimeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tickers, apiErr := parseTickers(r)
+		if apiErr != nil {
+			writeError(w, r, http.StatusBadRequest, *apiErr)
+			return
+		}
+		cursor, err := events.repo.LatestIngest(r.Context())
+		if err != nil {
+			writeFailure(w, r, err)
+			return
+		}
+		if id := r.Header.Get("Last-Event-ID"); id != "" {
+			var ok bool
+			if cursor, ok = resumeFrom(id, cursor); !ok {
+				writeError(w, r, http.StatusBadRequest, errInvalidEventID)
+				return
+			}
+		}
+		wake, unsubscribe, ok := events.subscribe()
+		if !ok {
+			writeError(w, r, http.StatusServiceUnavailable, errUnavailable)
+			return
+		}
+		defer unsubscribe()
+
+		logger := zerolog.Ctx(r.Context())
+		rc := http.NewResponseController(w)
+		if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			logger.Warn().Err(err).Msg("failed to clear write deadline")
+		}
+		h := w.Header()
+		h.Set("Content-Type", "text/event-stream")
+		h.Set("Cache-Control", "no-store")
+		h.Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "retry: %d\n\n", eventRetry)
+		_ = rc.Flush()
+
+		catchUp := func() error {
+			ctx := r.Context()
+			if queryTimeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, queryTimeout)
+				defer cancel()
+			}
+			ingests, err := events.ingestsAfter(ctx, cursor)
+			if err != nil {
+				return err
+			}
+			for _, in := range ingests {
+				stats, err := events.sessionStats(ctx, in.Date)
+				if err != nil {
+					return err
+				}
+				date := in.Date.Format("2006-01-02")
+				for _, s := range stats {
+					if !slices.Contains(tickers, s.Ticker) {
+						continue
+					}
+					bar := barEvent{Ticker: s.Ticker, Date: date, Open: s.Open, High: s.High, Low: s.Low, Close: s.Close,
+						PrevClose: s.PrevClose, Volume: s.Volume, Notional: s.Notional, Trades: s.Trades}
+					if err := writeEvent(w, "", "bar", bar); err != nil {
+						return err
+					}
+				}
+				if err := writeEvent(w, strconv.FormatInt(in.Seq, 10), "ingested", ingestedEvent{Date: date, Tickers: len(stats)}); err != nil {
+					return err
+				}
+				if err := rc.Flush(); err != nil {
+					return err
+				}
+				cursor = in.Seq
+			}
+			return nil
+		}
+
+		// wait blocks until the next notification, sending heartbeats
+		// meanwhile. It reports false once the stream is over.
+		heartbeat := time.NewTicker(eventHeartbeat)
+		defer heartbeat.Stop()
+		wait := func() bool {
+			for {
+				select {
+				case <-r.Context().Done():
+					return false
+				case _, ok := <-wake:
+					return ok
+				case <-heartbeat.C:
+					if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+						return false
+					}
+					if err := rc.Flush(); err != nil {
+						return false
+					}
+				}
+			}
+		}
+
+		for {
+			if err := catchUp(); err != nil {
+				if r.Context().Err() == nil {
+					// The client resumes from the last ingest it got.
+					logger.Error().Err(repository.Classify(err)).Msg("quote stream aborted")
+				}
+				return
+			}
+			if !wait() {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type stubSessionsRepo struct {
+	mu    sync.Mutex
+	days  []time.Time
+	calls int
+}
+
+func (s *stubSessionsRepo) Sessions(ctx context.Context, from, to time.Time) ([]time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	var days []time.Time
+	for _, d := range s.days {
+		if !d.Before(from) && !d.After(to) {
+			days = append(days, d)
+		}
+	}
+	return days, nil
+}
+
+func (s *stubSessionsRepo) add(day time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.days = append(s.days, day)
+}
+
+type stubEventsRepo struct {
+	*stubSessionRepo
+	*stubIngestLog
+}
+
+func sessionDay(d int) time.Time {
+	return time.Date(2024, 5, d, 0, 0, 0, 0, time.UTC)
+}
+
+// newStubEventsRepo ingested days, in that order.
+func newStubEventsRepo(days ...time.Time) *stubEventsRepo {
+	repo := &stubEventsRepo{stubSessionRepo: &stubSessionRepo{stats: sessionFixture}, stubIngestLog: &stubIngestLog{}}
+	for _, day := range days {
+		repo.ingest(day, day.Add(20*time.Hour))
+	}
+	return repo
+}
+
+type sseEvent struct {
+	id, event, data string
+}
+
+// openStream connects to a quote stream and returns its events as they
+// arrive.
+func openStream(t *testing.T, srv *httptest.Server, target, lastEventID string) (*http.Response, <-chan sseEvent) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+target, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	events := make(chan sseEvent, 16)
+	go func() {
+		defer close(events)
+		var ev sseEvent
+		sc := bufio.NewScanner(resp.Body)
+		for sc.Scan() {
+			field, value, _ := strings.Cut(sc.Text(), ": ")
+			switch field {
+			case "id":
+				ev.id = value
+			case "event":
+				ev.event = value
+			case "data":
+				ev.data = value
+			case "":
+				if ev.event != "" {
+					events <- ev
+				}
+				ev = sseEvent{}
+			}
+		}
+	}()
+	return resp, events
+}
+
+func nextEvent(t *testing.T, events <-chan sseEvent) sseEvent {
+	t.Helper()
+	select {
+	case ev, ok := <-events:
+		if !ok {
+			t.Fatalf("stream ended")
+		}
+		return ev
+	case <-time.After(2 * time.Second):
+		t.Fatalf("no event")
+	}
+	return sseEvent{}
+}
+
+func TestQuoteStreamResumesFromLastEventID(t *testing.T) {
+	events := newQuoteEvents(newStubEventsRepo(sessionDay(8), sessionDay(9), sessionDay(10)))
+	srv := httptest.NewServer(quoteStreamHandler(events, time.Second))
+	defer srv.Close()
+	defer events.close()
+
+	resp, stream := openStream(t, srv, "/stream/quotes?tickers=petr4,ITUB4", "1")
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %d %v", resp.StatusCode, resp.Header)
+	}
+	for i, day := range []string{"2024-05-09", "2024-05-10"} {
+		for _, ticker := range []string{"PETR4", "ITUB4"} {
+			ev := nextEvent(t, stream)
+			var bar barEvent
+			if err := json.Unmarshal([]byte(ev.data), &bar); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if ev.event != "bar" || ev.id != "" || bar.Ticker != ticker || bar.Date != day {
+				t.Fatalf("expected the %s bar of %s without id, got %+v", day, ticker, ev)
+			}
+		}
+		ev := nextEvent(t, stream)
+		if ev.event != "ingested" || ev.id != strconv.Itoa(i+2) || ev.data != `{"date":"`+day+`","tickers":4}` {
+			t.Fatalf("expected the ingested event of %s, got %+v", day, ev)
+		}
+	}
+}
+
+func TestQuoteStreamBoundsReplay(t *testing.T) {
+	var days []time.Time
+	for i := 0; i < eventMaxReplay+5; i++ {
+		days = append(days, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, i))
+	}
+	events := newQuoteEvents(newStubEventsRepo(days...))
+	srv := httptest.NewServer(quoteStreamHandler(events, time.Second))
+	defer srv.Close()
+	defer events.close()
+
+	for lastEventID, first := range map[string]string{
+		"0":    "6",
+		"1000": "",
+	} {
+		resp, stream := openStream(t, srv, "/stream/quotes?tickers=VALE3", lastEventID)
+		if first != "" {
+			nextEvent(t, stream)
+			if ev := nextEvent(t, stream); ev.event != "ingested" || ev.id != first {
+				t.Fatalf("%s: expected the replay to start at ingest %s, got %+v", lastEventID, first, ev)
+			}
+		} else {
+			select {
+			case ev := <-stream:
+				t.Fatalf("%s: expected nothing to replay, got %+v", lastEventID, ev)
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+		resp.Body.Close()
+	}
+}
+
+func TestQuoteStreamPushesNewSessions(t *testing.T) {
+	repo := newStubEventsRepo(sessionDay(9))
+	events := newQuoteEvents(repo)
+	srv := httptest.NewServer(quoteStreamHandler(events, time.Second))
+	defer srv.Close()
+	defer events.close()
+
+	_, stream := openStream(t, srv, "/stream/quotes?tickers=VALE3", "")
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		events.mu.Lock()
+		n := len(events.subs)
+		events.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the stream did not subscribe")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	repo.ingest(sessionDay(10), sessionDay(10).Add(20*time.Hour))
+	events.notify("2024-05-10")
+	if ev := nextEvent(t, stream); ev.event != "bar" || !strings.Contains(ev.data, `"ticker":"VALE3","date":"2024-05-10"`) {
+		t.Fatalf("expected the new bar, got %+v", ev)
+	}
+	if ev := nextEvent(t, stream); ev.event != "ingested" || ev.id != "2" {
+		t.Fatalf("expected the ingested event, got %+v", ev)
+	}
+
+	// A session loaded after later ones is sent too.
+	repo.ingest(sessionDay(8), sessionDay(11))
+	events.notify("2024-05-08")
+	if ev := nextEvent(t, stream); ev.event != "bar" || !strings.Contains(ev.data, `"ticker":"VALE3","date":"2024-05-08"`) {
+		t.Fatalf("expected the backfilled bar, got %+v", ev)
+	}
+	if ev := nextEvent(t, stream); ev.event != "ingested" || ev.id != "3" {
+		t.Fatalf("expected the backfilled ingested event, got %+v", ev)
+	}
+
+	events.close()
+	select {
+	case _, ok := <-stream:
+		if ok {
+			t.Fatalf("expected no more events after shutdown")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("shutdown did not end the stream")
+	}
+}
+
+func TestQuoteStreamSharesQueries(t *testing.T) {
+	repo := newStubEventsRepo(sessionDay(9), sessionDay(10))
+	events := newQuoteEvents(repo)
+	for i := 0; i < 3; i++ {
+		if _, err := events.ingestsAfter(context.Background(), 1); err != nil {
+			t.Fatalf("ingests: %v", err)
+		}
+	}
+	if repo.calls != 1 {
+		t.Fatalf("expected streams at the same ingest to share a query, got %d", repo.calls)
+	}
+	events.notify("2024-05-11")
+	events.ingestsAfter(context.Background(), 1)
+	if repo.calls != 2 {
+		t.Fatalf("expected a notification to invalidate the sessions, got %d queries", repo.calls)
+	}
+}
+
+func TestQuoteStreamRejectsInvalidRequests(t *testing.T) {
+	h := quoteStreamHandler(newQuoteEvents(newStubEventsRepo(sessionDay(10))), time.Second)
+	for target, lastEventID := range map[string]string{
+		"/stream/quotes":                "",
+		"/stream/quotes?tickers=PETR4,": "yesterday",
+	} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", target, rec.Code)
+		}
+	}
+	for _, lastEventID := range []string{"2024-05-08", "-1", "yesterday"} {
+		req := httptest.NewRequest(http.MethodGet, "/stream/quotes?tickers=PETR4", nil)
+		req.Header.Set("Last-Event-ID", lastEventID)
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), errInvalidEventID.ID) {
+			t.Fatalf("%s: expected %s, got %d %s", lastEventID, errInvalidEventID.ID, rec.Code, rec.Body)
+		}
+	}
+
+	events := newQuoteEvents(newStubEventsRepo(sessionDay(10)))
+	events.close()
+	rec := httptest.NewRecorder()
+	quoteStreamHandler(events, time.Second)(rec, httptest.NewRequest(http.MethodGet, "/stream/quotes?tickers=PETR4", nil))
+	if body, _ := io.ReadAll(rec.Body); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 while shutting down, got %d %s", rec.Code, body)
+	}
+}
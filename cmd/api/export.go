@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"desafiocotacaob3/internal/export"
+	"desafiocotacaob3/internal/repository"
+)
+
+var (
+	errInvalidFormat = apiError{ID: "ERR_INVALID_FORMAT", Message: "format must be one of json, csv, ndjson, parquet"}
+	errNotAcceptable = apiError{ID: "ERR_NOT_ACCEPTABLE", Message: "Accept must allow application/json, text/csv, application/x-ndjson or application/vnd.apache.parquet"}
+)
+
+type tradesStreamer interface {
+	StreamTrades(ctx context.Context, ticker string, from, to time.Time, fn func(repository.Trade) error) error
+}
+
+type candlesStreamer interface {
+	StreamCandles(ctx context.Context, ticker string, interval time.Duration, from, to time.Time, warmup int, fn func(repository.Bar) error) error
+}
+
+// streamExport negotiates the response format and streams the records that
+// source emits straight to the client. Headers are only sent with the first
+// record, so a source that fails or yields nothing still gets a regular error
+// response; a failure mid-stream aborts the connection instead of leaving the
+// client with a truncated document that looks complete.
+func streamExport[T export.Record](w http.ResponseWriter, r *http.Request, filename string, source func(emit func(T) error) error) {
+	format, err := export.Negotiate(r)
+	if err != nil {
+		if r.URL.Query().Get("format") != "" {
+			writeError(w, r, http.StatusBadRequest, errInvalidFormat)
+		} else {
+			writeError(w, r, http.StatusNotAcceptable, errNotAcceptable)
+		}
+		return
+	}
+	out, err := export.NewWriter[T](format, w)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, errInvalidFormat)
+		return
+	}
+
+	var rows int
+	err = source(func(rec T) error {
+		if rows == 0 {
+			w.Header().Set("Content-Type", format.ContentType())
+			if format == export.CSV || format == export.Parquet {
+				w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+"."+string(format)))
+			}
+		}
+		rows++
+		return out.Write(rec)
+	})
+	if err == nil && rows > 0 {
+		err = out.Close()
+	}
+	switch {
+	case err != nil && rows == 0:
+		writeFailure(w, r, err)
+	case err != nil:
+		zerolog.Ctx(r.Context()).Error().Err(err).Int("rows", rows).Msgf("export of %s aborted", r.URL.Path)
+		panic(http.ErrAbortHandler)
+	case rows == 0:
+		writeError(w, r, http.StatusNotFound, errTickerNotFound)
+	}
+}
+
+func quotesTradesHandler(repo tradesStreamer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ticker := strings.ToUpper(r.URL.Query().Get("ticker"))
+		if ticker == "" {
+			writeError(w, r, http.StatusBadRequest, errMissingTicker)
+			return
+		}
+		from, to, apiErr := parseDateRange(r, 1)
+		if apiErr != nil {
+			writeError(w, r, http.StatusBadRequest, *apiErr)
+			return
+		}
+
+		filename := fmt.Sprintf("trades_%s_%s_%s", ticker, from.Format("20060102"), to.Format("20060102"))
+		streamExport(w, r, filename, func(emit func(export.TradeRecord) error) error {
+			return repo.StreamTrades(r.Context(), ticker, from, to, func(t repository.Trade) error {
+				return emit(export.NewTradeRecord(t))
+			})
+		})
+	}
+}
+
+func quotesCandlesHandler(repo candlesStreamer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ticker := strings.ToUpper(r.URL.Query().Get("ticker"))
+		if ticker == "" {
+			writeError(w, r, http.StatusBadRequest, errMissingTicker)
+			return
+		}
+		intervalName := r.URL.Query().Get("interval")
+		if intervalName == "" {
+			intervalName = "1d"
+		}
+		interval, ok := repository.Intervals[intervalName]
+		if !ok {
+			writeError(w, r, http.StatusBadRequest, errInvalidInterval)
+			return
+		}
+		from, to, apiErr := parseDateRange(r, 7)
+		if apiErr != nil {
+			writeError(w, r, http.StatusBadRequest, *apiErr)
+			return
+		}
+
+		filename := fmt.Sprintf("candles_%s_%s_%s_%s", ticker, intervalName, from.Format("20060102"), to.Format("20060102"))
+		streamExport(w, r, filename, func(emit func(export.BarRecord) error) error {
+			return repo.StreamCandles(r.Context(), ticker, interval, from, to, 0, func(b repository.Bar) error {
+				return emit(export.NewBarRecord(ticker, b))
+			})
+		})
+	}
+}
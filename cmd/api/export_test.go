@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"desafiocotacaob3/internal/repository"
+)
+
+type stubStreamRepo struct {
+	trades []repository.Trade
+	bars   []repository.Bar
+}
+
+func (s *stubStreamRepo) StreamTrades(ctx context.Context, ticker string, from, to time.Time, fn func(repository.Trade) error) error {
+	for _, t := range s.trades {
+		if err := fn(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *stubStreamRepo) StreamCandles(ctx context.Context, ticker string, interval time.Duration, from, to time.Time, warmup int, fn func(repository.Bar) error) error {
+	for _, b := range s.bars {
+		if err := fn(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestQuotesTradesCSV(t *testing.T) {
+	repo := &stubStreamRepo{trades: []repository.Trade{
+		{ID: "1", Ticker: "PETR4", Time: time.Date(2024, 5, 10, 10, 0, 0, 0, time.UTC), Price: 10.5, Quantity: 100},
+	}}
+	srv := httptest.NewServer(quotesTradesHandler(repo))
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/quotes/trades?ticker=PETR4&from=2024-05-10&to=2024-05-10", nil)
+	req.Header.Set("Accept", "text/csv")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/csv" {
+		t.Fatalf("unexpected content type %s", ct)
+	}
+	if cd := resp.Header.Get("Content-Disposition"); !strings.Contains(cd, "trades_PETR4_20240510_20240510.csv") {
+		t.Fatalf("unexpected content disposition %s", cd)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	want := "id,ticker,time,price,quantity\n1,PETR4,2024-05-10T10:00:00Z,10.5,100\n"
+	if string(body) != want {
+		t.Fatalf("unexpected body:\n%s", body)
+	}
+}
+
+func TestQuotesCandlesNDJSONFormatParam(t *testing.T) {
+	repo := &stubStreamRepo{bars: []repository.Bar{dailyBar(9, 10), dailyBar(10, 11)}}
+	srv := httptest.NewServer(quotesCandlesHandler(repo))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/quotes/candles?ticker=PETR4&format=ndjson")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Fatalf("unexpected content type %s", ct)
+	}
+	dec := json.NewDecoder(resp.Body)
+	var closes []float64
+	for dec.More() {
+		var bar struct {
+			Ticker string  `json:"ticker"`
+			Close  float64 `json:"close"`
+		}
+		if err := dec.Decode(&bar); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		closes = append(closes, bar.Close)
+	}
+	if len(closes) != 2 || closes[1] != 11 {
+		t.Fatalf("unexpected candles %v", closes)
+	}
+}
+
+func TestQuotesTradesEmpty(t *testing.T) {
+	srv := httptest.NewServer(quotesTradesHandler(&stubStreamRepo{}))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/quotes/trades?ticker=XXXX")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", resp.StatusCode)
+	}
+	var e apiError
+	if err := json.NewDecoder(resp.Body).Decode(&e); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if e.ID != errTickerNotFound.ID {
+		t.Fatalf("expected error %s, got %s", errTickerNotFound.ID, e.ID)
+	}
+}
+
+func TestQuotesTradesNotAcceptable(t *testing.T) {
+	srv := httptest.NewServer(quotesTradesHandler(&stubStreamRepo{}))
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/quotes/trades?ticker=PETR4", nil)
+	req.Header.Set("Accept", "application/xml")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotAcceptable {
+		t.Fatalf("expected status 406, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,818 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/location"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/rs/zerolog"
+
+	"desafiocotacaob3/internal/instrument"
+	"desafiocotacaob3/internal/repository"
+	"desafiocotacaob3/internal/util"
+)
+
+const (
+	// graphqlMaxBody bounds the JSON body of a POSTed query.
+	graphqlMaxBody = 64 << 10
+	// graphqlDefaultLimit is how many bars, trades or session tickers a list
+	// field returns when no limit is given; moversMaxLimit is the most any
+	// returns.
+	graphqlDefaultLimit = 100
+	// graphqlMaxListSize caps the size complexity assumes for a list field,
+	// far beyond what any limit allows, so that costs cannot overflow.
+	graphqlMaxListSize = 1 << 16
+	// graphqlQueryCost is what complexity charges for a database query, in
+	// objects: aggregating a session costs far more than returning a row.
+	graphqlQueryCost = 50
+)
+
+var (
+	errInvalidQuery    = apiError{ID: "ERR_INVALID_QUERY", Message: "the GraphQL request is malformed or does not match the schema"}
+	errQueryTooComplex = apiError{ID: "ERR_QUERY_TOO_COMPLEX", Message: "the query may run too many database queries or return too many objects, request fewer fields, tickers or smaller limits"}
+)
+
+type quoteBatchRepo interface {
+	QuoteSummaries(ctx context.Context, tickers []string, startDate time.Time) (map[string]repository.Summary, error)
+	LatestCandles(ctx context.Context, tickers []string, interval time.Duration, from, to time.Time, limit int) (map[string][]repository.Bar, error)
+	LatestTrades(ctx context.Context, tickers []string, day time.Time, limit int) (map[string][]repository.Trade, error)
+}
+
+// graphqlRepository is everything the GraphQL schema reads from storage.
+type graphqlRepository interface {
+	quoteBatchRepo
+	sessionStatsRepo
+	latestSessionRepo
+}
+
+// fieldError is an apiError raised while resolving a field, with the status
+// the response is sent with.
+type fieldError struct {
+	status int
+	apiErr apiError
+}
+
+func (e fieldError) Error() string {
+	return e.apiErr.Message
+}
+
+func invalidArgument(e apiError) error {
+	return fieldError{status: http.StatusBadRequest, apiErr: e}
+}
+
+// fieldFailure is writeFailure for fields: the error is logged and reported
+// by its domain ID, or as ERR_INTERNAL.
+func fieldFailure(ctx context.Context, err error) error {
+	err = repository.Classify(err)
+	logger := zerolog.Ctx(ctx)
+	if errors.Is(err, context.Canceled) && ctx.Err() != nil {
+		logger.Info().Err(err).Msg("client went away")
+		return fieldError{status: statusClientClosedRequest, apiErr: errInternal}
+	}
+	for _, d := range domainErrors {
+		if errors.Is(err, d.err) {
+			logger.Warn().Err(err).Str("error_id", d.apiErr.ID).Msg("graphql field failed")
+			return fieldError{status: d.status, apiErr: d.apiErr}
+		}
+	}
+	logger.Error().Err(err).Msg("graphql field failed")
+	return fieldError{status: http.StatusInternalServerError, apiErr: errInternal}
+}
+
+// batch is one repository call shared by every ticker requested with the
+// same arguments before the first of them is needed.
+type batch[V any] struct {
+	tickers []string
+	results map[string]V
+	err     error
+	done    bool
+}
+
+// loader batches the per-ticker fields of a query. Resolvers only register
+// their ticker and return a thunk; graphql-go forces thunks a level at a
+// time, so the siblings of a list are all registered by the time the first
+// is forced and fetch runs once for all of them. Results are kept for the
+// rest of the request. Execution is sequential, so no locking is needed.
+type loader[A comparable, V any] struct {
+	fetch   func(ctx context.Context, args A, tickers []string) (map[string]V, error)
+	batches map[A][]*batch[V]
+}
+
+func newLoader[A comparable, V any](fetch func(ctx context.Context, args A, tickers []string) (map[string]V, error)) *loader[A, V] {
+	return &loader[A, V]{fetch: fetch, batches: make(map[A][]*batch[V])}
+}
+
+// load returns a thunk of ticker's value for args. A ticker without data
+// gets the zero V.
+func (l *loader[A, V]) load(ctx context.Context, args A, ticker string) func() (any, error) {
+	batches := l.batches[args]
+	var b *batch[V]
+	for _, prev := range batches {
+		if slices.Contains(prev.tickers, ticker) {
+			b = prev
+			break
+		}
+	}
+	if b == nil {
+		if n := len(batches); n > 0 && !batches[n-1].done {
+			b = batches[n-1]
+		} else {
+			b = &batch[V]{}
+			l.batches[args] = append(batches, b)
+		}
+		b.tickers = append(b.tickers, ticker)
+	}
+	return func() (any, error) {
+		if !b.done {
+			b.results, b.err = l.fetch(ctx, args, b.tickers)
+			b.done = true
+			if b.err != nil {
+				b.err = fieldFailure(ctx, b.err)
+			}
+		}
+		return b.results[ticker], b.err
+	}
+}
+
+type barsArgs struct {
+	interval time.Duration
+	from, to time.Time
+	limit    int
+}
+
+type tradesArgs struct {
+	day   time.Time
+	limit int
+}
+
+// graphqlLoaders are the loaders and memoized queries of one request.
+type graphqlLoaders struct {
+	repo      graphqlRepository
+	summaries *loader[time.Time, repository.Summary]
+	bars      *loader[barsArgs, []repository.Bar]
+	trades    *loader[tradesArgs, []repository.Trade]
+	latest    *time.Time
+	sessions  map[time.Time][]repository.SessionStats
+}
+
+func newGraphQLLoaders(repo graphqlRepository) *graphqlLoaders {
+	return &graphqlLoaders{
+		repo: repo,
+		summaries: newLoader(func(ctx context.Context, start time.Time, tickers []string) (map[string]repository.Summary, error) {
+			return repo.QuoteSummaries(ctx, tickers, start)
+		}),
+		bars: newLoader(func(ctx context.Context, a barsArgs, tickers []string) (map[string][]repository.Bar, error) {
+			return repo.LatestCandles(ctx, tickers, a.interval, a.from, a.to, a.limit)
+		}),
+		trades: newLoader(func(ctx context.Context, a tradesArgs, tickers []string) (map[string][]repository.Trade, error) {
+			return repo.LatestTrades(ctx, tickers, a.day, a.limit)
+		}),
+		sessions: make(map[time.Time][]repository.SessionStats),
+	}
+}
+
+// latestSession is LatestSession, queried once per request. ok is false
+// when nothing was ingested yet.
+func (l *graphqlLoaders) latestSession(ctx context.Context) (day time.Time, ok bool, err error) {
+	if l.latest == nil {
+		day, ok, err := l.repo.LatestSession(ctx)
+		if err != nil {
+			return time.Time{}, false, fieldFailure(ctx, err)
+		}
+		if !ok {
+			return time.Time{}, false, nil
+		}
+		l.latest = &day
+	}
+	return *l.latest, true, nil
+}
+
+// sessionStats is SessionStats, queried once per request and day.
+func (l *graphqlLoaders) sessionStats(ctx context.Context, day time.Time) ([]repository.SessionStats, error) {
+	if stats, ok := l.sessions[day]; ok {
+		return stats, nil
+	}
+	stats, err := l.repo.SessionStats(ctx, day)
+	if err != nil {
+		return nil, fieldFailure(ctx, err)
+	}
+	l.sessions[day] = stats
+	return stats, nil
+}
+
+type graphqlLoadersKey struct{}
+
+func loadersOf(ctx context.Context) *graphqlLoaders {
+	return ctx.Value(graphqlLoadersKey{}).(*graphqlLoaders)
+}
+
+// tickerRef is the source of a Ticker: its fields are loaded on demand.
+type tickerRef string
+
+// session is the source of a Session.
+type session struct {
+	day   time.Time
+	stats []repository.SessionStats
+}
+
+// prop is a field resolved from its source of type S by get.
+func prop[S any](t graphql.Output, get func(S) any) *graphql.Field {
+	return &graphql.Field{Type: t, Resolve: func(p graphql.ResolveParams) (any, error) {
+		return get(p.Source.(S)), nil
+	}}
+}
+
+// today is midnight UTC of the current day, as dateRange computes it.
+func today() time.Time {
+	now := time.Now().UTC()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// optionalDate parses the date argument name of p, returning ok false when it
+// is absent.
+func optionalDate(p graphql.ResolveParams, name string, invalid apiError) (day time.Time, ok bool, err error) {
+	s, _ := p.Args[name].(string)
+	if s == "" {
+		return time.Time{}, false, nil
+	}
+	day, perr := time.Parse("2006-01-02", s)
+	if perr != nil {
+		return time.Time{}, false, invalidArgument(invalid)
+	}
+	return day, true, nil
+}
+
+// limitArg is the limit argument of p, which the schema defaults.
+func limitArg(p graphql.ResolveParams) (int, error) {
+	limit, _ := p.Args["limit"].(int)
+	if limit < 1 || limit > moversMaxLimit {
+		return 0, invalidArgument(errInvalidLimit)
+	}
+	return limit, nil
+}
+
+// longType is a 64-bit integer, since GraphQL's Int is limited to 32 bits
+// and volumes exceed it.
+var longType = graphql.NewScalar(graphql.ScalarConfig{
+	Name:        "Long",
+	Description: "A 64-bit integer.",
+	Serialize: func(v any) any {
+		if n, ok := v.(int64); ok {
+			return n
+		}
+		return nil
+	},
+})
+
+var nonNull = graphql.NewNonNull
+
+func newGraphQLSchema() (graphql.Schema, error) {
+	summaryType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Summary",
+		Description: "The highest price and the largest daily volume since a start date, as GET /v1/quotes/summary.",
+		Fields: graphql.Fields{
+			"maxRangeValue":  prop(nonNull(graphql.Float), func(s repository.Summary) any { return s.MaxPrice }),
+			"maxDailyVolume": prop(nonNull(longType), func(s repository.Summary) any { return s.MaxDailyVolume }),
+		},
+	})
+	barType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Bar",
+		Description: "An OHLCV bar, as GET /v1/quotes/candles.",
+		Fields: graphql.Fields{
+			"time":   prop(nonNull(graphql.DateTime), func(b repository.Bar) any { return b.Time }),
+			"open":   prop(nonNull(graphql.Float), func(b repository.Bar) any { return b.Open }),
+			"high":   prop(nonNull(graphql.Float), func(b repository.Bar) any { return b.High }),
+			"low":    prop(nonNull(graphql.Float), func(b repository.Bar) any { return b.Low }),
+			"close":  prop(nonNull(graphql.Float), func(b repository.Bar) any { return b.Close }),
+			"volume": prop(nonNull(longType), func(b repository.Bar) any { return b.Volume }),
+			"trades": prop(nonNull(longType), func(b repository.Bar) any { return b.Trades }),
+		},
+	})
+	tradeType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Trade",
+		Description: "A trade, as GET /v1/quotes/trades.",
+		Fields: graphql.Fields{
+			"id":       prop(nonNull(graphql.ID), func(t repository.Trade) any { return t.ID }),
+			"time":     prop(nonNull(graphql.DateTime), func(t repository.Trade) any { return t.Time }),
+			"price":    prop(nonNull(graphql.Float), func(t repository.Trade) any { return t.Price }),
+			"quantity": prop(nonNull(graphql.Float), func(t repository.Trade) any { return t.Quantity }),
+		},
+	})
+	tickerType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Ticker",
+		Description: "A ticker and its quotes. Tickers that never traded have no summary and no bars or trades.",
+		Fields: graphql.Fields{
+			"symbol": prop(nonNull(graphql.String), func(t tickerRef) any { return string(t) }),
+			"class":  prop(nonNull(graphql.String), func(t tickerRef) any { return string(instrument.Classify(string(t))) }),
+			"summary": &graphql.Field{
+				Type: summaryType,
+				Args: graphql.FieldConfigArgument{
+					"dateStart": {Type: graphql.String, Description: "YYYY-MM-DD, seven business days ago by default."},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					start, ok, err := optionalDate(p, "dateStart", errInvalidDate)
+					if err != nil {
+						return nil, err
+					}
+					if !ok {
+						start = util.BusinessDaysAgo(today(), 7)
+					}
+					load := loadersOf(p.Context).summaries.load(p.Context, start, string(p.Source.(tickerRef)))
+					return func() (any, error) {
+						v, err := load()
+						if err != nil || v.(repository.Summary) == (repository.Summary{}) {
+							return nil, err
+						}
+						return v, nil
+					}, nil
+				},
+			},
+			"bars": &graphql.Field{
+				Type:        nonNull(graphql.NewList(nonNull(barType))),
+				Description: "The last limit bars between from and to.",
+				Args: graphql.FieldConfigArgument{
+					"interval": {Type: graphql.String, DefaultValue: "1d", Description: "One of 1m, 5m, 15m, 30m, 1h or 1d."},
+					"from":     {Type: graphql.String, Description: "YYYY-MM-DD, seven business days before to by default."},
+					"to":       {Type: graphql.String, Description: "YYYY-MM-DD, today by default."},
+					"limit":    {Type: graphql.Int, DefaultValue: graphqlDefaultLimit},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					interval, ok := repository.Intervals[p.Args["interval"].(string)]
+					if !ok {
+						return nil, invalidArgument(errInvalidInterval)
+					}
+					fromStr, _ := p.Args["from"].(string)
+					toStr, _ := p.Args["to"].(string)
+					from, to, apiErr := dateRange(fromStr, toStr, 7)
+					if apiErr != nil {
+						return nil, invalidArgument(*apiErr)
+					}
+					limit, err := limitArg(p)
+					if err != nil {
+						return nil, err
+					}
+					args := barsArgs{interval: interval, from: from, to: to, limit: limit}
+					return nonNilList[repository.Bar](loadersOf(p.Context).bars.load(p.Context, args, string(p.Source.(tickerRef)))), nil
+				},
+			},
+			"trades": &graphql.Field{
+				Type:        nonNull(graphql.NewList(nonNull(tradeType))),
+				Description: "The last limit trades of a session.",
+				Args: graphql.FieldConfigArgument{
+					"date":  {Type: graphql.String, Description: "YYYY-MM-DD, the latest ingested session by default."},
+					"limit": {Type: graphql.Int, DefaultValue: graphqlDefaultLimit},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					day, ok, err := optionalDate(p, "date", errInvalidDay)
+					if err != nil {
+						return nil, err
+					}
+					limit, err := limitArg(p)
+					if err != nil {
+						return nil, err
+					}
+					loaders := loadersOf(p.Context)
+					if !ok {
+						if day, ok, err = loaders.latestSession(p.Context); err != nil || !ok {
+							return []repository.Trade{}, err
+						}
+					}
+					args := tradesArgs{day: day, limit: limit}
+					return nonNilList[repository.Trade](loaders.trades.load(p.Context, args, string(p.Source.(tickerRef)))), nil
+				},
+			},
+		},
+	})
+	sessionTickerType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "SessionTicker",
+		Description: "A ticker's trading in a session, as GET /v1/market/movers.",
+		Fields: graphql.Fields{
+			"ticker": prop(nonNull(tickerType), func(s repository.SessionStats) any { return tickerRef(s.Ticker) }),
+			"open":   prop(nonNull(graphql.Float), func(s repository.SessionStats) any { return s.Open }),
+			"high":   prop(nonNull(graphql.Float), func(s repository.SessionStats) any { return s.High }),
+			"low":    prop(nonNull(graphql.Float), func(s repository.SessionStats) any { return s.Low }),
+			"close":  prop(nonNull(graphql.Float), func(s repository.SessionStats) any { return s.Close }),
+			"prevClose": prop(graphql.Float, func(s repository.SessionStats) any {
+				if s.PrevClose <= 0 {
+					return nil
+				}
+				return s.PrevClose
+			}),
+			"change": prop(graphql.Float, func(s repository.SessionStats) any {
+				if s.PrevClose <= 0 {
+					return nil
+				}
+				return s.Close/s.PrevClose - 1
+			}),
+			"volume":   prop(nonNull(longType), func(s repository.SessionStats) any { return s.Volume }),
+			"notional": prop(nonNull(graphql.Float), func(s repository.SessionStats) any { return s.Notional }),
+			"trades":   prop(nonNull(longType), func(s repository.SessionStats) any { return s.Trades }),
+		},
+	})
+	sessionType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Session",
+		Description: "A trading session with ingested trades.",
+		Fields: graphql.Fields{
+			"date": prop(nonNull(graphql.String), func(s session) any { return s.day.Format("2006-01-02") }),
+			"tickers": &graphql.Field{
+				Type:        nonNull(graphql.NewList(nonNull(sessionTickerType))),
+				Description: "The tickers traded in the session, by symbol.",
+				Args: graphql.FieldConfigArgument{
+					"class": {Type: graphql.String, Description: "One of stock, unit, bdr, fractional, option, future or other; every class by default."},
+					"limit": {Type: graphql.Int, DefaultValue: graphqlDefaultLimit},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					var class instrument.Class
+					if cs, _ := p.Args["class"].(string); cs != "" {
+						var ok bool
+						if class, ok = instrument.ParseClass(cs); !ok {
+							return nil, invalidArgument(errInvalidClass)
+						}
+					}
+					limit, err := limitArg(p)
+					if err != nil {
+						return nil, err
+					}
+					tickers := []repository.SessionStats{}
+					for _, st := range p.Source.(session).stats {
+						if class == "" || instrument.Classify(st.Ticker) == class {
+							tickers = append(tickers, st)
+						}
+					}
+					slices.SortFunc(tickers, func(a, b repository.SessionStats) int {
+						return strings.Compare(a.Ticker, b.Ticker)
+					})
+					return tickers[:min(limit, len(tickers))], nil
+				},
+			},
+		},
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"tickers": &graphql.Field{
+				Type:        nonNull(graphql.NewList(nonNull(tickerType))),
+				Description: "Up to 20 tickers, in the order given.",
+				Args: graphql.FieldConfigArgument{
+					"symbols": {Type: nonNull(graphql.NewList(nonNull(graphql.String)))},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					tickers := []any{}
+					for _, s := range p.Args["symbols"].([]any) {
+						ticker := tickerRef(strings.ToUpper(strings.TrimSpace(s.(string))))
+						if ticker != "" && !slices.Contains(tickers, any(ticker)) {
+							tickers = append(tickers, ticker)
+						}
+					}
+					if len(tickers) > maxCompareTickers {
+						return nil, invalidArgument(errTooManyTickers)
+					}
+					return tickers, nil
+				},
+			},
+			"ticker": &graphql.Field{
+				Type: nonNull(tickerType),
+				Args: graphql.FieldConfigArgument{
+					"symbol": {Type: nonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					ticker := strings.ToUpper(strings.TrimSpace(p.Args["symbol"].(string)))
+					if ticker == "" {
+						return nil, invalidArgument(errMissingTicker)
+					}
+					return tickerRef(ticker), nil
+				},
+			},
+			"session": &graphql.Field{
+				Type:        sessionType,
+				Description: "A session, or null when it has no trades.",
+				Args: graphql.FieldConfigArgument{
+					"date": {Type: graphql.String, Description: "YYYY-MM-DD, the latest ingested session by default."},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					loaders := loadersOf(p.Context)
+					day, ok, err := optionalDate(p, "date", errInvalidDay)
+					if err != nil {
+						return nil, err
+					}
+					if !ok {
+						if day, ok, err = loaders.latestSession(p.Context); err != nil || !ok {
+							return nil, err
+						}
+					}
+					stats, err := loaders.sessionStats(p.Context, day)
+					if err != nil || len(stats) == 0 {
+						return nil, err
+					}
+					return session{day: day, stats: stats}, nil
+				},
+			},
+		},
+	})
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query})
+}
+
+// nonNilList turns the zero value a loader returns for tickers without data
+// into an empty list.
+func nonNilList[V any](load func() (any, error)) func() (any, error) {
+	return func() (any, error) {
+		v, err := load()
+		if err != nil {
+			return nil, err
+		}
+		if list := v.([]V); list != nil {
+			return list, nil
+		}
+		return []V{}, nil
+	}
+}
+
+// queryFields are the fields whose resolvers query the database, by type
+// and name. The siblings of a list share the query, but every occurrence of
+// the field in the document, such as an alias, may run its own.
+var queryFields = map[string]bool{
+	"Query.session":  true,
+	"Ticker.summary": true,
+	"Ticker.bars":    true,
+	"Ticker.trades":  true,
+}
+
+// complexity estimates what running an operation costs: every object
+// field costs one per object it may return, plus the cost of its selections
+// for each of them. A list field may return as many objects as its limit
+// argument, or as the symbols it is given. Every occurrence of a field of
+// queryFields also costs graphqlQueryCost, once whatever the size of the
+// lists above it, since loaders batch them. Scalars and introspection are
+// free, since they never reach the database.
+type complexity struct {
+	schema    *graphql.Schema
+	fragments map[string]*ast.FragmentDefinition
+	vars      map[string]any
+	queries   *int
+}
+
+// queryComplexity is the complexity of the operation of doc named
+// operationName, or its only one, run with vars. doc must be valid.
+func queryComplexity(schema *graphql.Schema, doc *ast.Document, operationName string, vars map[string]any) int {
+	c := complexity{schema: schema, fragments: make(map[string]*ast.FragmentDefinition), vars: maps.Clone(vars), queries: new(int)}
+	var op *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		switch d := def.(type) {
+		case *ast.FragmentDefinition:
+			c.fragments[d.Name.Value] = d
+		case *ast.OperationDefinition:
+			if operationName == "" || (d.Name != nil && d.Name.Value == operationName) {
+				op = d
+			}
+		}
+	}
+	if op == nil {
+		return 0
+	}
+	if c.vars == nil {
+		c.vars = make(map[string]any)
+	}
+	for _, vd := range op.VariableDefinitions {
+		if _, ok := c.vars[vd.Variable.Name.Value]; !ok && vd.DefaultValue != nil {
+			c.vars[vd.Variable.Name.Value] = c.value(vd.DefaultValue)
+		}
+	}
+	objects := c.selections(schema.QueryType(), op.SelectionSet)
+	return objects + *c.queries*graphqlQueryCost
+}
+
+func (c complexity) selections(parent *graphql.Object, set *ast.SelectionSet) int {
+	if parent == nil || set == nil {
+		return 0
+	}
+	cost := 0
+	for _, sel := range set.Selections {
+		switch s := sel.(type) {
+		case *ast.Field:
+			cost += c.field(parent, s)
+		case *ast.InlineFragment:
+			cost += c.selections(c.condition(parent, s.TypeCondition), s.SelectionSet)
+		case *ast.FragmentSpread:
+			if f, ok := c.fragments[s.Name.Value]; ok {
+				cost += c.selections(c.condition(parent, f.TypeCondition), f.SelectionSet)
+			}
+		}
+	}
+	return cost
+}
+
+// condition is the type a fragment with the type condition applies to.
+func (c complexity) condition(parent *graphql.Object, cond *ast.Named) *graphql.Object {
+	if cond == nil {
+		return parent
+	}
+	obj, _ := c.schema.Type(cond.Name.Value).(*graphql.Object)
+	return obj
+}
+
+func (c complexity) field(parent *graphql.Object, f *ast.Field) int {
+	def, ok := parent.Fields()[f.Name.Value]
+	if !ok || strings.HasPrefix(f.Name.Value, "__") {
+		return 0
+	}
+	obj, ok := graphql.GetNamed(def.Type).(*graphql.Object)
+	if !ok {
+		return 0
+	}
+	if queryFields[parent.Name()+"."+f.Name.Value] {
+		*c.queries++
+	}
+	n := 1
+	if _, ok := graphql.GetNullable(def.Type).(*graphql.List); ok {
+		n = c.listSize(def, f)
+	}
+	return n * (1 + c.selections(obj, f.SelectionSet))
+}
+
+// listSize is how many objects the list field f may return.
+func (c complexity) listSize(def *graphql.FieldDefinition, f *ast.Field) int {
+	for _, arg := range def.Args {
+		if arg.Name() != "limit" && arg.Name() != "symbols" {
+			continue
+		}
+		v := arg.DefaultValue
+		for _, a := range f.Arguments {
+			if a.Name.Value == arg.Name() {
+				v = c.value(a.Value)
+			}
+		}
+		switch v := v.(type) {
+		case int:
+			return min(max(v, 0), graphqlMaxListSize)
+		case float64:
+			return int(min(max(v, 0), graphqlMaxListSize))
+		case []any:
+			return min(len(v), graphqlMaxListSize)
+		}
+	}
+	return 1
+}
+
+// value is the part of an argument value complexity needs: integers, and
+// lists of which only the length matters.
+func (c complexity) value(v ast.Value) any {
+	switch v := v.(type) {
+	case *ast.Variable:
+		return c.vars[v.Name.Value]
+	case *ast.IntValue:
+		n, _ := strconv.Atoi(v.Value)
+		return n
+	case *ast.ListValue:
+		return make([]any, len(v.Values))
+	}
+	return nil
+}
+
+// graphqlRequest is a GraphQL-over-HTTP request, POSTed as JSON or sent as
+// GET query params.
+type graphqlRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+type graphqlExtensions struct {
+	ID            string `json:"id"`
+	RequestID     string `json:"request_id,omitempty"`
+	Complexity    int    `json:"complexity,omitempty"`
+	MaxComplexity int    `json:"max_complexity,omitempty"`
+}
+
+type graphqlError struct {
+	Message    string                    `json:"message"`
+	Locations  []location.SourceLocation `json:"locations,omitempty"`
+	Path       []any                     `json:"path,omitempty"`
+	Extensions graphqlExtensions         `json:"extensions"`
+}
+
+type graphqlResponse struct {
+	Data   any            `json:"data,omitempty"`
+	Errors []graphqlError `json:"errors,omitempty"`
+}
+
+// fieldErrorOf finds the fieldError err was raised with, through the
+// wrapping graphql-go adds.
+func fieldErrorOf(err error) (fieldError, bool) {
+	for err != nil {
+		switch e := err.(type) {
+		case fieldError:
+			return e, true
+		case *gqlerrors.Error:
+			err = e.OriginalError
+		case gqlerrors.FormattedError:
+			err = e.OriginalError()
+		default:
+			return fieldError{}, false
+		}
+	}
+	return fieldError{}, false
+}
+
+// writeGraphQL sends data and errs as a GraphQL response. Errors carry the ID
+// and request ID of an apiError in their extensions; those graphql-go raised
+// itself are ERR_INVALID_QUERY. The status is 200 only without errors, and
+// otherwise the most severe of theirs, so that failures are never cached.
+func writeGraphQL(w http.ResponseWriter, data any, errs []gqlerrors.FormattedError) {
+	resp := graphqlResponse{Data: data}
+	status := http.StatusOK
+	for _, e := range errs {
+		fe, ok := fieldErrorOf(e)
+		if !ok {
+			fe = fieldError{status: http.StatusBadRequest, apiErr: errInvalidQuery}
+		}
+		status = max(status, fe.status)
+		resp.Errors = append(resp.Errors, graphqlError{
+			Message:    e.Message,
+			Locations:  e.Locations,
+			Path:       e.Path,
+			Extensions: graphqlExtensions{ID: fe.apiErr.ID, RequestID: requestID(w)},
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// readGraphQLRequest reads the query of r from its JSON body when POSTed, and
+// from its query params otherwise.
+func readGraphQLRequest(w http.ResponseWriter, r *http.Request) (graphqlRequest, error) {
+	var req graphqlRequest
+	if r.Method == http.MethodPost {
+		err := json.NewDecoder(http.MaxBytesReader(w, r.Body, graphqlMaxBody)).Decode(&req)
+		return req, err
+	}
+	q := r.URL.Query()
+	req.Query, req.OperationName = q.Get("query"), q.Get("operationName")
+	if vs := q.Get("variables"); vs != "" {
+		if err := json.Unmarshal([]byte(vs), &req.Variables); err != nil {
+			return req, err
+		}
+	}
+	return req, nil
+}
+
+// graphqlHandler serves the GraphQL schema over repo. Queries are parsed,
+// validated and checked against maxComplexity before anything is queried;
+// zero disables the check. Per-ticker fields are batched into one query per
+// set of arguments, whatever the number of tickers.
+func graphqlHandler(repo graphqlRepository, maxComplexity int) http.HandlerFunc {
+	schema, err := newGraphQLSchema()
+	if err != nil {
+		panic(fmt.Sprintf("graphql schema: %v", err))
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, err := readGraphQLRequest(w, r)
+		if err != nil {
+			writeGraphQL(w, nil, gqlerrors.FormatErrors(fmt.Errorf("invalid request: %w", err)))
+			return
+		}
+		doc, err := parser.Parse(parser.ParseParams{Source: req.Query})
+		if err != nil {
+			writeGraphQL(w, nil, gqlerrors.FormatErrors(err))
+			return
+		}
+		if res := graphql.ValidateDocument(&schema, doc, nil); !res.IsValid {
+			writeGraphQL(w, nil, res.Errors)
+			return
+		}
+		if cost := queryComplexity(&schema, doc, req.OperationName, req.Variables); maxComplexity > 0 && cost > maxComplexity {
+			e := errQueryTooComplex
+			e.RequestID = requestID(w)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(graphqlResponse{Errors: []graphqlError{{
+				Message:    e.Message,
+				Extensions: graphqlExtensions{ID: e.ID, RequestID: e.RequestID, Complexity: cost, MaxComplexity: maxComplexity},
+			}}})
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), graphqlLoadersKey{}, newGraphQLLoaders(repo))
+		res := graphql.Execute(graphql.ExecuteParams{
+			Schema:        schema,
+			AST:           doc,
+			OperationName: req.OperationName,
+			Args:          req.Variables,
+			Context:       ctx,
+		})
+		writeGraphQL(w, res.Data, res.Errors)
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/graphql-go/graphql/language/parser"
+
+	"desafiocotacaob3/internal/repository"
+)
+
+// stubBatchRepo serves the batch queries from per-ticker fixtures, recording
+// the tickers of every call.
+type stubBatchRepo struct {
+	summaries map[string]repository.Summary
+	bars      map[string][]repository.Bar
+	trades    map[string][]repository.Trade
+	err       error
+	calls     map[string][][]string
+	tradesDay time.Time
+}
+
+func (s *stubBatchRepo) record(method string, tickers []string) {
+	if s.calls == nil {
+		s.calls = make(map[string][][]string)
+	}
+	s.calls[method] = append(s.calls[method], slices.Clone(tickers))
+}
+
+func (s *stubBatchRepo) QuoteSummaries(ctx context.Context, tickers []string, startDate time.Time) (map[string]repository.Summary, error) {
+	s.record("summaries", tickers)
+	out := make(map[string]repository.Summary)
+	for _, t := range tickers {
+		if v, ok := s.summaries[t]; ok {
+			out[t] = v
+		}
+	}
+	return out, s.err
+}
+
+func (s *stubBatchRepo) LatestCandles(ctx context.Context, tickers []string, interval time.Duration, from, to time.Time, limit int) (map[string][]repository.Bar, error) {
+	s.record("candles", tickers)
+	out := make(map[string][]repository.Bar)
+	for _, t := range tickers {
+		if bars := s.bars[t]; len(bars) > 0 {
+			out[t] = bars[max(0, len(bars)-limit):]
+		}
+	}
+	return out, s.err
+}
+
+func (s *stubBatchRepo) LatestTrades(ctx context.Context, tickers []string, day time.Time, limit int) (map[string][]repository.Trade, error) {
+	s.record("trades", tickers)
+	s.tradesDay = day
+	out := make(map[string][]repository.Trade)
+	for _, t := range tickers {
+		if trades := s.trades[t]; len(trades) > 0 {
+			out[t] = trades[max(0, len(trades)-limit):]
+		}
+	}
+	return out, s.err
+}
+
+var batchFixture = &stubBatchRepo{
+	summaries: map[string]repository.Summary{
+		"PETR4": {MaxPrice: 10.5, MaxDailyVolume: 1000},
+		"VALE3": {MaxPrice: 61.2, MaxDailyVolume: 3_000_000_000},
+	},
+	bars: map[string][]repository.Bar{
+		"PETR4": {dailyBar(8, 10), dailyBar(9, 11), dailyBar(10, 12)},
+		"VALE3": {dailyBar(10, 60)},
+	},
+	trades: map[string][]repository.Trade{
+		"PETR4": {
+			{ID: "1", Ticker: "PETR4", Time: time.Date(2024, 5, 10, 10, 0, 0, 0, time.UTC), Price: 12, Quantity: 100},
+			{ID: "2", Ticker: "PETR4", Time: time.Date(2024, 5, 10, 11, 0, 0, 0, time.UTC), Price: 12.5, Quantity: 200},
+		},
+	},
+}
+
+type stubGraphQLRepo struct {
+	*stubBatchRepo
+	*stubSessionRepo
+	*stubHealthRepo
+}
+
+func newStubGraphQLRepo() *stubGraphQLRepo {
+	batch := *batchFixture
+	batch.calls = nil
+	return &stubGraphQLRepo{
+		stubBatchRepo:   &batch,
+		stubSessionRepo: &stubSessionRepo{stats: sessionFixture},
+		stubHealthRepo:  &stubHealthRepo{latest: sessionDay(10), hasData: true},
+	}
+}
+
+type graphqlResult struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors []graphqlError             `json:"errors"`
+}
+
+// postGraphQL runs query with vars through the handler.
+func postGraphQL(t *testing.T, h http.Handler, query string, vars map[string]any) (int, graphqlResult) {
+	t.Helper()
+	body, _ := json.Marshal(graphqlRequest{Query: query, Variables: vars})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/graphql", strings.NewReader(string(body))))
+	var res graphqlResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+	return rec.Code, res
+}
+
+func TestGraphQLBatchesTickers(t *testing.T) {
+	repo := newStubGraphQLRepo()
+	h := requestLogger(graphqlHandler(repo, 0))
+	code, res := postGraphQL(t, h, `query($symbols: [String!]!) {
+		tickers(symbols: $symbols) {
+			symbol
+			class
+			summary { maxRangeValue maxDailyVolume }
+			since: summary(dateStart: "2024-05-01") { maxRangeValue }
+			bars(limit: 2) { close }
+			...latest
+		}
+	}
+	fragment latest on Ticker { trades(limit: 1) { id price } }`, map[string]any{"symbols": []string{"petr4", "VALE3", "ITUB4", "PETR4"}})
+	if code != http.StatusOK || len(res.Errors) != 0 {
+		t.Fatalf("expected 200 without errors, got %d %v", code, res.Errors)
+	}
+
+	want := `[
+		{"symbol":"PETR4","class":"stock","summary":{"maxRangeValue":10.5,"maxDailyVolume":1000},"since":{"maxRangeValue":10.5},"bars":[{"close":11},{"close":12}],"trades":[{"id":"2","price":12.5}]},
+		{"symbol":"VALE3","class":"stock","summary":{"maxRangeValue":61.2,"maxDailyVolume":3000000000},"since":{"maxRangeValue":61.2},"bars":[{"close":60}],"trades":[]},
+		{"symbol":"ITUB4","class":"stock","summary":null,"since":null,"bars":[],"trades":[]}
+	]`
+	if !sameJSON(res.Data["tickers"], want) {
+		t.Fatalf("unexpected tickers\n got %s\nwant %s", res.Data["tickers"], want)
+	}
+
+	all := []string{"PETR4", "VALE3", "ITUB4"}
+	// One query per set of arguments, whatever the number of tickers.
+	for method, calls := range map[string]int{"summaries": 2, "candles": 1, "trades": 1} {
+		if len(repo.calls[method]) != calls {
+			t.Fatalf("expected %d %s queries, got %v", calls, method, repo.calls[method])
+		}
+		for _, tickers := range repo.calls[method] {
+			if !slices.Equal(tickers, all) {
+				t.Fatalf("expected %s to be batched for %v, got %v", method, all, tickers)
+			}
+		}
+	}
+	if !repo.tradesDay.Equal(sessionDay(10)) {
+		t.Fatalf("expected trades of the latest session, got %s", repo.tradesDay)
+	}
+}
+
+// sameJSON reports whether got encodes the same value as want, since
+// graphql-go does not keep the order of the selections.
+func sameJSON(got json.RawMessage, want string) bool {
+	var g, w any
+	if json.Unmarshal(got, &g) != nil || json.Unmarshal([]byte(want), &w) != nil {
+		return false
+	}
+	return reflect.DeepEqual(g, w)
+}
+
+func TestGraphQLSession(t *testing.T) {
+	repo := newStubGraphQLRepo()
+	h := requestLogger(graphqlHandler(repo, 0))
+	code, res := postGraphQL(t, h, `{
+		session(date: "2024-05-10") {
+			date
+			tickers(class: "stock", limit: 2) { ticker { symbol summary { maxRangeValue } } close prevClose change }
+		}
+	}`, nil)
+	if code != http.StatusOK || len(res.Errors) != 0 {
+		t.Fatalf("expected 200 without errors, got %d %v", code, res.Errors)
+	}
+	want := `{"date":"2024-05-10","tickers":[` +
+		`{"ticker":{"symbol":"ITUB4","summary":null},"close":20,"prevClose":null,"change":null},` +
+		`{"ticker":{"symbol":"PETR4","summary":{"maxRangeValue":10.5}},"close":11,"prevClose":10,"change":0.10000000000000009}]}`
+	if !sameJSON(res.Data["session"], want) {
+		t.Fatalf("unexpected session\n got %s\nwant %s", res.Data["session"], want)
+	}
+	if len(repo.calls["summaries"]) != 1 {
+		t.Fatalf("expected the summaries of the session's tickers to be batched, got %v", repo.calls["summaries"])
+	}
+
+	repo.stubSessionRepo.stats = nil
+	if _, res := postGraphQL(t, h, `{ session { date } }`, nil); string(res.Data["session"]) != "null" {
+		t.Fatalf("expected no session without trades, got %s", res.Data["session"])
+	}
+}
+
+func TestQueryComplexity(t *testing.T) {
+	schema, err := newGraphQLSchema()
+	if err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+	for query, want := range map[string]int{
+		`{ ticker(symbol: "PETR4") { symbol class } }`:                                                                       1,
+		`{ ticker(symbol: "PETR4") { summary { maxRangeValue } } }`:                                                          52,
+		`{ tickers(symbols: ["PETR4", "VALE3"]) { summary { maxRangeValue } } }`:                                             54,
+		`{ tickers(symbols: ["PETR4", "VALE3"]) { bars(limit: 30) { close } } }`:                                             112,
+		`{ tickers(symbols: ["PETR4", "VALE3"]) { bars { close } trades { price } } }`:                                       502,
+		`query($n: Int = 10) { ticker(symbol: "PETR4") { ...t } } fragment t on Ticker { bars(limit: $n) { close } }`:        61,
+		`{ session { tickers(limit: 5) { ticker { summary { maxRangeValue } } } } }`:                                         116,
+		`{ a: session(date: "2024-05-09") { date } b: session(date: "2024-05-10") { date } }`:                                102,
+		`{ ticker(symbol: "PETR4") { a: summary(dateStart: "2024-05-01") { maxRangeValue } b: summary { maxRangeValue } } }`: 103,
+		`{ __schema { types { name fields { name } } } }`:                                                                    0,
+	} {
+		doc, err := parser.Parse(parser.ParseParams{Source: query})
+		if err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		if got := queryComplexity(&schema, doc, "", nil); got != want {
+			t.Errorf("%s: expected %d, got %d", query, want, got)
+		}
+	}
+
+	doc, _ := parser.Parse(parser.ParseParams{Source: `query($s: [String!]!, $n: Int) { tickers(symbols: $s) { bars(limit: $n) { close } } }`})
+	if got := queryComplexity(&schema, doc, "", map[string]any{"s": []any{"A", "B", "C"}, "n": 9.0}); got != 80 {
+		t.Errorf("expected variables to be counted, got %d", got)
+	}
+}
+
+func TestGraphQLRejectsComplexQueries(t *testing.T) {
+	repo := newStubGraphQLRepo()
+	h := requestLogger(graphqlHandler(repo, 150))
+	code, res := postGraphQL(t, h, `{ tickers(symbols: ["PETR4", "VALE3"]) { bars(limit: 60) { close } } }`, nil)
+	if code != http.StatusBadRequest || len(res.Errors) != 1 {
+		t.Fatalf("expected 400 with one error, got %d %v", code, res.Errors)
+	}
+	if ext := res.Errors[0].Extensions; ext.ID != errQueryTooComplex.ID || ext.Complexity != 172 || ext.MaxComplexity != 150 || ext.RequestID == "" {
+		t.Fatalf("unexpected error %+v", res.Errors[0])
+	}
+	if len(repo.calls) != 0 {
+		t.Fatalf("expected nothing to be queried, got %v", repo.calls)
+	}
+	if code, _ := postGraphQL(t, h, `{ tickers(symbols: ["PETR4", "VALE3"]) { bars(limit: 49) { close } } }`, nil); code != http.StatusOK {
+		t.Fatalf("expected queries within the limit to run, got %d", code)
+	}
+}
+
+func TestGraphQLErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		err    error
+		status int
+		id     string
+		data   string
+	}{
+		{name: "syntax", query: `{ ticker(symbol: "PETR4") {`, status: http.StatusBadRequest, id: errInvalidQuery.ID},
+		{name: "unknown field", query: `{ ticker(symbol: "PETR4") { isin } }`, status: http.StatusBadRequest, id: errInvalidQuery.ID},
+		{name: "interval", query: `{ ticker(symbol: "PETR4") { symbol bars(interval: "2h") { close } } }`, status: http.StatusBadRequest, id: errInvalidInterval.ID},
+		{name: "date", query: `{ ticker(symbol: "PETR4") { symbol summary(dateStart: "10/05/2024") { maxRangeValue } } }`, status: http.StatusBadRequest, id: errInvalidDate.ID, data: `{"symbol":"PETR4","summary":null}`},
+		{name: "limit", query: `{ session { tickers(limit: 0) { close } } }`, status: http.StatusBadRequest, id: errInvalidLimit.ID},
+		{name: "too many", query: `{ tickers(symbols: ["A1","A2","A3","A4","A5","A6","A7","A8","A9","A10","A11","A12","A13","A14","A15","A16","A17","A18","A19","A20","A21"]) { symbol } }`, status: http.StatusBadRequest, id: errTooManyTickers.ID},
+		{name: "timeout", query: `{ ticker(symbol: "PETR4") { symbol summary { maxRangeValue } } }`, err: repository.ErrTimeout, status: http.StatusGatewayTimeout, id: errTimeout.ID, data: `{"symbol":"PETR4","summary":null}`},
+	}
+	for _, tt := range tests {
+		repo := newStubGraphQLRepo()
+		repo.stubBatchRepo.err = tt.err
+		code, res := postGraphQL(t, requestLogger(graphqlHandler(repo, 0)), tt.query, nil)
+		if code != tt.status || len(res.Errors) == 0 {
+			t.Errorf("%s: expected %d with errors, got %d %v", tt.name, tt.status, code, res.Errors)
+			continue
+		}
+		if ext := res.Errors[0].Extensions; ext.ID != tt.id || ext.RequestID == "" {
+			t.Errorf("%s: expected %s with a request ID, got %+v", tt.name, tt.id, res.Errors[0])
+		}
+		if tt.data != "" && !sameJSON(res.Data["ticker"], tt.data) {
+			t.Errorf("%s: expected the other fields to resolve, got %s", tt.name, res.Data["ticker"])
+		}
+	}
+}
+
+func TestGraphQLOverGET(t *testing.T) {
+	h := requestLogger(graphqlHandler(newStubGraphQLRepo(), 0))
+	q := url.Values{
+		"query":     {`query($s: String!) { ticker(symbol: $s) { symbol } }`},
+		"variables": {`{"s": "vale3"}`},
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/graphql?"+q.Encode(), nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != `{"data":{"ticker":{"symbol":"VALE3"}}}`+"\n" {
+		t.Fatalf("unexpected response %d %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"desafiocotacaob3/internal/auth"
+	"desafiocotacaob3/internal/config"
+	"desafiocotacaob3/internal/instrument"
+	"desafiocotacaob3/internal/repository"
+	"desafiocotacaob3/internal/util"
+	quotesv1 "desafiocotacaob3/proto/quotes/v1"
+)
+
+// grpcErrorDomain is the domain of the google.rpc.ErrorInfo gRPC errors carry.
+const grpcErrorDomain = "quotes"
+
+// requestIDMetadata is the gRPC counterpart of the X-Request-ID header.
+const requestIDMetadata = "x-request-id"
+
+// grpcRoutes maps every RPC to the HTTP route it mirrors. An RPC is rate
+// limited as its route and counted in the same bucket, so a client gets no
+// more by switching API. ListTickers runs the query of /market/movers.
+var grpcRoutes = map[string]string{
+	quotesv1.QuotesService_GetSummary_FullMethodName:    "/quotes/summary",
+	quotesv1.QuotesService_StreamCandles_FullMethodName: "/quotes/candles",
+	quotesv1.QuotesService_StreamTrades_FullMethodName:  "/quotes/trades",
+	quotesv1.QuotesService_ListTickers_FullMethodName:   "/market/movers",
+}
+
+// grpcCodes maps the HTTP statuses apiErrors are sent with to the gRPC codes
+// that report them.
+var grpcCodes = map[int]codes.Code{
+	http.StatusBadRequest:          codes.InvalidArgument,
+	http.StatusUnauthorized:        codes.Unauthenticated,
+	http.StatusForbidden:           codes.PermissionDenied,
+	http.StatusNotFound:            codes.NotFound,
+	http.StatusTooManyRequests:     codes.ResourceExhausted,
+	http.StatusInternalServerError: codes.Internal,
+	http.StatusServiceUnavailable:  codes.Unavailable,
+	http.StatusGatewayTimeout:      codes.DeadlineExceeded,
+}
+
+// grpcRepository is everything the gRPC service reads from storage.
+type grpcRepository interface {
+	quoteSummaryRepo
+	candlesStreamer
+	tradesStreamer
+	sessionStatsRepo
+	latestSessionRepo
+}
+
+type grpcRequestIDKey struct{}
+
+// grpcError is writeError for RPCs: e is reported with the code matching
+// httpStatus, and its ID and the request ID in an ErrorInfo, followed by
+// details.
+func grpcError(ctx context.Context, httpStatus int, e apiError, details ...protoadapt.MessageV1) error {
+	info := &errdetails.ErrorInfo{Reason: e.ID, Domain: grpcErrorDomain}
+	if id, ok := ctx.Value(grpcRequestIDKey{}).(string); ok {
+		info.Metadata = map[string]string{"request_id": id}
+	}
+	st, err := status.New(grpcCodes[httpStatus], e.Message).WithDetails(append([]protoadapt.MessageV1{info}, details...)...)
+	if err != nil {
+		return status.Error(grpcCodes[httpStatus], e.Message)
+	}
+	return st.Err()
+}
+
+// grpcFailure is writeFailure for RPCs.
+func grpcFailure(ctx context.Context, err error) error {
+	err = repository.Classify(err)
+	logger := zerolog.Ctx(ctx)
+	method, _ := grpc.Method(ctx)
+	if errors.Is(ctx.Err(), context.Canceled) {
+		logger.Info().Err(err).Str("method", method).Msg("client went away")
+		return status.FromContextError(ctx.Err()).Err()
+	}
+	for _, d := range domainErrors {
+		if errors.Is(err, d.err) {
+			logger.Warn().Err(err).Str("method", method).Str("error_id", d.apiErr.ID).Msg("request failed")
+			return grpcError(ctx, d.status, d.apiErr)
+		}
+	}
+	logger.Error().Err(err).Str("method", method).Msg("request failed")
+	return grpcError(ctx, http.StatusInternalServerError, errInternal)
+}
+
+// quotesService serves the gRPC API from the repository the HTTP handlers
+// read, with the same parameters, defaults and errors.
+type quotesService struct {
+	quotesv1.UnimplementedQuotesServiceServer
+	repo grpcRepository
+}
+
+func (s *quotesService) GetSummary(ctx context.Context, req *quotesv1.GetSummaryRequest) (*quotesv1.Summary, error) {
+	ticker := strings.ToUpper(req.GetTicker())
+	if ticker == "" {
+		return nil, grpcError(ctx, http.StatusBadRequest, errMissingTicker)
+	}
+	startDate := util.BusinessDaysAgo(time.Now().UTC(), 7)
+	if ds := req.GetDateStart(); ds != "" {
+		var err error
+		startDate, err = time.Parse("2006-01-02", ds)
+		if err != nil {
+			return nil, grpcError(ctx, http.StatusBadRequest, errInvalidDate)
+		}
+	}
+
+	maxPrice, maxVolume, ok, err := s.repo.QuoteSummary(ctx, ticker, startDate)
+	if err != nil {
+		return nil, grpcFailure(ctx, err)
+	}
+	if !ok {
+		return nil, grpcError(ctx, http.StatusNotFound, errTickerNotFound)
+	}
+	return &quotesv1.Summary{Ticker: ticker, MaxRangeValue: maxPrice, MaxDailyVolume: maxVolume}, nil
+}
+
+func (s *quotesService) StreamCandles(req *quotesv1.StreamCandlesRequest, stream grpc.ServerStreamingServer[quotesv1.Candle]) error {
+	ctx := stream.Context()
+	ticker := strings.ToUpper(req.GetTicker())
+	if ticker == "" {
+		return grpcError(ctx, http.StatusBadRequest, errMissingTicker)
+	}
+	intervalName := req.GetInterval()
+	if intervalName == "" {
+		intervalName = "1d"
+	}
+	interval, ok := repository.Intervals[intervalName]
+	if !ok {
+		return grpcError(ctx, http.StatusBadRequest, errInvalidInterval)
+	}
+	from, to, apiErr := dateRange(req.GetFrom(), req.GetTo(), 7)
+	if apiErr != nil {
+		return grpcError(ctx, http.StatusBadRequest, *apiErr)
+	}
+
+	var sent int
+	err := s.repo.StreamCandles(ctx, ticker, interval, from, to, 0, func(b repository.Bar) error {
+		sent++
+		return stream.Send(&quotesv1.Candle{
+			Ticker: ticker,
+			Time:   timestamppb.New(b.Time),
+			Open:   b.Open,
+			High:   b.High,
+			Low:    b.Low,
+			Close:  b.Close,
+			Volume: b.Volume,
+			Trades: b.Trades,
+		})
+	})
+	return streamEnd(ctx, sent, err)
+}
+
+func (s *quotesService) StreamTrades(req *quotesv1.StreamTradesRequest, stream grpc.ServerStreamingServer[quotesv1.Trade]) error {
+	ctx := stream.Context()
+	ticker := strings.ToUpper(req.GetTicker())
+	if ticker == "" {
+		return grpcError(ctx, http.StatusBadRequest, errMissingTicker)
+	}
+	from, to, apiErr := dateRange(req.GetFrom(), req.GetTo(), 1)
+	if apiErr != nil {
+		return grpcError(ctx, http.StatusBadRequest, *apiErr)
+	}
+
+	var sent int
+	err := s.repo.StreamTrades(ctx, ticker, from, to, func(t repository.Trade) error {
+		sent++
+		return stream.Send(&quotesv1.Trade{
+			Id:       t.ID,
+			Ticker:   t.Ticker,
+			Time:     timestamppb.New(t.Time),
+			Price:    t.Price,
+			Quantity: t.Quantity,
+		})
+	})
+	return streamEnd(ctx, sent, err)
+}
+
+// streamEnd reports how a stream that sent n messages ended. As with the
+// HTTP exports, a stream that found nothing is a ticker not found; once
+// messages were sent, a failure ends the stream with an error status the
+// client cannot mistake for its end.
+func streamEnd(ctx context.Context, n int, err error) error {
+	switch {
+	case err != nil:
+		return grpcFailure(ctx, err)
+	case n == 0:
+		return grpcError(ctx, http.StatusNotFound, errTickerNotFound)
+	}
+	return nil
+}
+
+func (s *quotesService) ListTickers(ctx context.Context, req *quotesv1.ListTickersRequest) (*quotesv1.ListTickersResponse, error) {
+	var day time.Time
+	if ds := req.GetDate(); ds != "" {
+		var err error
+		day, err = time.Parse("2006-01-02", ds)
+		if err != nil {
+			return nil, grpcError(ctx, http.StatusBadRequest, errInvalidDay)
+		}
+	} else {
+		latest, ok, err := s.repo.LatestSession(ctx)
+		if err != nil {
+			return nil, grpcFailure(ctx, err)
+		}
+		if !ok {
+			return nil, grpcError(ctx, http.StatusNotFound, errNoSessionData)
+		}
+		day = latest
+	}
+	var class instrument.Class
+	if c := req.GetClass(); c != "" {
+		var ok bool
+		if class, ok = instrument.ParseClass(c); !ok {
+			return nil, grpcError(ctx, http.StatusBadRequest, errInvalidClass)
+		}
+	}
+
+	stats, err := s.repo.SessionStats(ctx, day)
+	if err != nil {
+		return nil, grpcFailure(ctx, err)
+	}
+	if len(stats) == 0 {
+		return nil, grpcError(ctx, http.StatusNotFound, errNoSessionData)
+	}
+	resp := &quotesv1.ListTickersResponse{Date: day.Format("2006-01-02"), Tickers: []*quotesv1.Ticker{}}
+	for _, st := range stats {
+		c := instrument.Classify(st.Ticker)
+		if class != "" && c != class {
+			continue
+		}
+		resp.Tickers = append(resp.Tickers, &quotesv1.Ticker{
+			Ticker: st.Ticker,
+			Class:  string(c),
+			Close:  st.Close,
+			Volume: st.Volume,
+			Trades: st.Trades,
+		})
+	}
+	slices.SortFunc(resp.Tickers, func(a, b *quotesv1.Ticker) int {
+		return strings.Compare(a.Ticker, b.Ticker)
+	})
+	return resp, nil
+}
+
+// grpcGate runs RPCs the way the HTTP middleware runs data routes: logged
+// with a request ID, instrumented, checked against the caller's credential,
+// quota and rate limit, and bounded by QueryTimeout, or ExportTimeout for
+// streams.
+type grpcGate struct {
+	acc           *access
+	metrics       *grpcMetrics
+	queryTimeout  time.Duration
+	exportTimeout time.Duration
+}
+
+// newGRPCServer returns the gRPC API over repo, guarded by acc and
+// instrumented on reg. Server reflection is enabled, so tools such as grpcurl
+// need no copy of the protobuf definitions.
+func newGRPCServer(repo grpcRepository, cfg *config.Config, reg prometheus.Registerer, acc *access) *grpc.Server {
+	g := &grpcGate{acc: acc, metrics: newGRPCMetrics(reg), queryTimeout: cfg.QueryTimeout, exportTimeout: cfg.ExportTimeout}
+	srv := grpc.NewServer(grpc.UnaryInterceptor(g.unary), grpc.StreamInterceptor(g.stream))
+	quotesv1.RegisterQuotesServiceServer(srv, &quotesService{repo: repo})
+	reflection.Register(srv)
+	return srv
+}
+
+func (g *grpcGate) unary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	err = g.call(ctx, info.FullMethod, g.queryTimeout, func(ctx context.Context) error {
+		var err error
+		resp, err = handler(ctx, req)
+		return err
+	})
+	return resp, err
+}
+
+func (g *grpcGate) stream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return g.call(ss.Context(), info.FullMethod, g.exportTimeout, func(ctx context.Context) error {
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	})
+}
+
+// serverStream is a grpc.ServerStream running on the context of its gate.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// call runs the RPC method with handler. Panics are recovered and reported
+// as internal errors, since grpc-go would let them crash the process.
+func (g *grpcGate) call(ctx context.Context, method string, timeout time.Duration, handler func(context.Context) error) (err error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	id := firstMetadata(md, requestIDMetadata)
+	if !validRequestID(id) {
+		id = uuid.NewString()
+	}
+	_ = grpc.SetHeader(ctx, metadata.Pairs(requestIDMetadata, id))
+	ctx = log.With().Str("request_id", id).Logger().WithContext(ctx)
+	logger := zerolog.Ctx(ctx)
+	ctx = context.WithValue(ctx, requestLoggerKey{}, logger)
+	ctx = context.WithValue(ctx, grpcRequestIDKey{}, id)
+	var remote string
+	if p, ok := peer.FromContext(ctx); ok {
+		remote = p.Addr.String()
+	}
+
+	start := time.Now()
+	defer func() {
+		p := recover()
+		if p != nil {
+			logger.Error().Interface("panic", p).Str("method", method).Msg("request panicked")
+			err = grpcError(ctx, http.StatusInternalServerError, errInternal)
+		}
+		code := status.Code(err)
+		g.metrics.observe(method, code, time.Since(start))
+		event := logger.Info()
+		switch code {
+		case codes.Internal, codes.Unknown, codes.Unavailable, codes.DeadlineExceeded:
+			event = logger.Error()
+		}
+		event.Str("method", method).
+			Str("code", code.String()).
+			Dur("latency", time.Since(start)).
+			Str("remote", remote).
+			Str("user_agent", firstMetadata(md, "user-agent")).
+			Msg("rpc")
+	}()
+
+	if route, ok := grpcRoutes[method]; ok {
+		if ctx, err = g.admit(ctx, md, route, remote); err != nil {
+			return err
+		}
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+	}
+	return handler(ctx)
+}
+
+// admit is access.guard for an RPC mirroring route, called from remote with
+// metadata md. Credentials are sent in the x-api-key and authorization
+// metadata, as the HTTP headers are.
+func (g *grpcGate) admit(ctx context.Context, md metadata.MD, route, remote string) (context.Context, error) {
+	creds := credentials{secret: firstMetadata(md, strings.ToLower(apiKeyHeader)), token: bearerToken(firstMetadata(md, "authorization"))}
+	o := origin{addr: remote}
+	if h := g.acc.limiter.ipHeader; h != "" {
+		o.forwarded = firstMetadata(md, strings.ToLower(h))
+	}
+	ctx, _, err := g.acc.admit(ctx, creds, route, auth.ReadQuotes, o)
+	var d *denial
+	switch {
+	case errors.As(err, &d):
+		if d.limited != nil {
+			return ctx, grpcRateLimited(ctx, d.limited.RetryAfter)
+		}
+		return ctx, grpcError(ctx, d.status, d.apiErr)
+	case err != nil:
+		return ctx, grpcFailure(ctx, err)
+	}
+	return ctx, nil
+}
+
+// grpcRateLimited is writeRateLimited for RPCs: the delay to retry after
+// is sent as a google.rpc.RetryInfo.
+func grpcRateLimited(ctx context.Context, retryAfter time.Duration) error {
+	delay := time.Duration(max(ceilSeconds(retryAfter), 1)) * time.Second
+	return grpcError(ctx, http.StatusTooManyRequests, errRateLimited, &errdetails.RetryInfo{RetryDelay: durationpb.New(delay)})
+}
+
+// firstMetadata returns the first value of key in md, or "".
+func firstMetadata(md metadata.MD, key string) string {
+	if v := md.Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
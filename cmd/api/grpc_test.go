@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"desafiocotacaob3/internal/config"
+	"desafiocotacaob3/internal/ratelimit"
+	quotesv1 "desafiocotacaob3/proto/quotes/v1"
+)
+
+// startAPI serves repo over HTTP and gRPC on one port, as main does by
+// default, and returns a gRPC client of it and the base URL of its HTTP API.
+func startAPI(t *testing.T, repo *fakeRepo, cfg *config.Config) (quotesv1.QuotesServiceClient, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	httpLn, grpcLn := splitGRPC(ln, time.Second)
+	acc := newAccess(repo, nil, cfg)
+	reg := prometheus.NewRegistry()
+	srv := newServer(cfg, newRouter(repo, cfg, reg, newQuoteEvents(repo), acc))
+	grpcSrv := newGRPCServer(repo, cfg, reg, acc)
+	go srv.Serve(httpLn)
+	go grpcSrv.Serve(grpcLn)
+	t.Cleanup(func() {
+		grpcSrv.Stop()
+		srv.Close()
+		ln.Close()
+	})
+
+	conn, err := grpc.NewClient(ln.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return quotesv1.NewQuotesServiceClient(conn), "http://" + ln.Addr().String()
+}
+
+// errorInfo returns the code of err and its ErrorInfo.
+func errorInfo(t *testing.T, err error) (codes.Code, *errdetails.ErrorInfo) {
+	t.Helper()
+	st := status.Convert(err)
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok {
+			return st.Code(), info
+		}
+	}
+	t.Fatalf("no ErrorInfo in %v", err)
+	return 0, nil
+}
+
+// recvAll reads a stream to its end.
+func recvAll[T any](stream grpc.ServerStreamingClient[T]) ([]*T, error) {
+	var msgs []*T
+	for {
+		msg, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return msgs, nil
+		}
+		if err != nil {
+			return msgs, err
+		}
+		msgs = append(msgs, msg)
+	}
+}
+
+func TestGRPCSharesPortWithHTTP(t *testing.T) {
+	client, baseURL := startAPI(t, newFakeRepo(), &config.Config{})
+
+	resp, err := http.Get(baseURL + "/v1/quotes/summary?ticker=PETR4")
+	if err != nil {
+		t.Fatalf("http: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected HTTP 200, got %d", resp.StatusCode)
+	}
+
+	var header metadata.MD
+	summary, err := client.GetSummary(context.Background(), &quotesv1.GetSummaryRequest{Ticker: "petr4"}, grpc.Header(&header))
+	if err != nil {
+		t.Fatalf("GetSummary: %v", err)
+	}
+	if summary.Ticker != "PETR4" || summary.MaxRangeValue != 10.5 || summary.MaxDailyVolume != 1000 {
+		t.Fatalf("unexpected summary %v", summary)
+	}
+	if len(header.Get(requestIDMetadata)) != 1 {
+		t.Fatalf("expected a request ID, got %v", header)
+	}
+}
+
+func TestGRPCStreams(t *testing.T) {
+	repo := newFakeRepo()
+	client, _ := startAPI(t, repo, &config.Config{})
+	ctx := context.Background()
+
+	stream, err := client.StreamTrades(ctx, &quotesv1.StreamTradesRequest{Ticker: "PETR4", From: "2024-05-10", To: "2024-05-10"})
+	if err != nil {
+		t.Fatalf("StreamTrades: %v", err)
+	}
+	trades, err := recvAll(stream)
+	if err != nil || len(trades) != 1 {
+		t.Fatalf("expected one trade, got %v %v", trades, err)
+	}
+	if tr := trades[0]; tr.Ticker != "PETR4" || tr.Price != 10.5 || !tr.Time.AsTime().Equal(time.Date(2024, 5, 10, 10, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected trade %v", tr)
+	}
+
+	candleStream, err := client.StreamCandles(ctx, &quotesv1.StreamCandlesRequest{Ticker: "PETR4", Interval: "1d"})
+	if err != nil {
+		t.Fatalf("StreamCandles: %v", err)
+	}
+	if candles, err := recvAll(candleStream); err != nil || len(candles) != 1 || candles[0].Close != 10 {
+		t.Fatalf("expected one candle, got %v %v", candles, err)
+	}
+
+	repo.stubStreamRepo.trades = nil
+	stream, _ = client.StreamTrades(ctx, &quotesv1.StreamTradesRequest{Ticker: "PETR4"})
+	_, err = recvAll(stream)
+	if code, info := errorInfo(t, err); code != codes.NotFound || info.Reason != errTickerNotFound.ID {
+		t.Fatalf("expected NotFound %s, got %s %s", errTickerNotFound.ID, code, info.Reason)
+	}
+}
+
+func TestGRPCListTickers(t *testing.T) {
+	client, _ := startAPI(t, newFakeRepo(), &config.Config{})
+
+	resp, err := client.ListTickers(context.Background(), &quotesv1.ListTickersRequest{Class: "stock"})
+	if err != nil {
+		t.Fatalf("ListTickers: %v", err)
+	}
+	if resp.Date != "2024-05-10" || len(resp.Tickers) != 3 {
+		t.Fatalf("expected the three stocks of the latest session, got %v", resp)
+	}
+	for i, want := range []string{"ITUB4", "PETR4", "VALE3"} {
+		if tk := resp.Tickers[i]; tk.Ticker != want || tk.Class != "stock" {
+			t.Fatalf("expected %s at %d, got %v", want, i, tk)
+		}
+	}
+}
+
+func TestGRPCRejectsInvalidRequests(t *testing.T) {
+	client, _ := startAPI(t, newFakeRepo(), &config.Config{})
+	ctx := context.Background()
+
+	for name, call := range map[string]func() error{
+		errMissingTicker.ID: func() error {
+			_, err := client.GetSummary(ctx, &quotesv1.GetSummaryRequest{})
+			return err
+		},
+		errInvalidDate.ID: func() error {
+			_, err := client.GetSummary(ctx, &quotesv1.GetSummaryRequest{Ticker: "PETR4", DateStart: "10/05/2024"})
+			return err
+		},
+		errInvalidInterval.ID: func() error {
+			stream, _ := client.StreamCandles(ctx, &quotesv1.StreamCandlesRequest{Ticker: "PETR4", Interval: "2h"})
+			_, err := recvAll(stream)
+			return err
+		},
+		errInvalidDateRange.ID: func() error {
+			stream, _ := client.StreamTrades(ctx, &quotesv1.StreamTradesRequest{Ticker: "PETR4", From: "2024-05-10", To: "2024-05-09"})
+			_, err := recvAll(stream)
+			return err
+		},
+		errInvalidClass.ID: func() error {
+			_, err := client.ListTickers(ctx, &quotesv1.ListTickersRequest{Class: "bond"})
+			return err
+		},
+	} {
+		code, info := errorInfo(t, call())
+		if code != codes.InvalidArgument || info.Reason != name || info.Domain != grpcErrorDomain || info.Metadata["request_id"] == "" {
+			t.Errorf("%s: expected InvalidArgument with a request ID, got %s %v", name, code, info)
+		}
+	}
+}
+
+func TestGRPCAuthentication(t *testing.T) {
+	client, _ := startAPI(t, newFakeRepo(), &config.Config{AuthRequired: true})
+	call := func(key string) error {
+		ctx := context.Background()
+		if key != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, "x-api-key", key)
+		}
+		_, err := client.GetSummary(ctx, &quotesv1.GetSummaryRequest{Ticker: "PETR4"})
+		return err
+	}
+
+	if code, info := errorInfo(t, call("")); code != codes.Unauthenticated || info.Reason != errUnauthorized.ID {
+		t.Fatalf("expected Unauthenticated without a key, got %s %s", code, info.Reason)
+	}
+	if code, info := errorInfo(t, call("qk_admin_secret")); code != codes.PermissionDenied || info.Reason != errForbidden.ID {
+		t.Fatalf("expected PermissionDenied without the scope, got %s %s", code, info.Reason)
+	}
+	// The reader key has a burst of two.
+	for i := 0; i < 2; i++ {
+		if err := call("qk_reader_secret"); err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+	}
+	err := call("qk_reader_secret")
+	if code, info := errorInfo(t, err); code != codes.ResourceExhausted || info.Reason != errRateLimited.ID {
+		t.Fatalf("expected the key quota to be enforced, got %s %s", code, info.Reason)
+	}
+	var retry *errdetails.RetryInfo
+	for _, d := range status.Convert(err).Details() {
+		if r, ok := d.(*errdetails.RetryInfo); ok {
+			retry = r
+		}
+	}
+	if retry == nil || retry.RetryDelay.AsDuration() < time.Second {
+		t.Fatalf("expected a retry delay, got %v", retry)
+	}
+}
+
+func TestGRPCSharesRateLimitsWithHTTP(t *testing.T) {
+	cfg := &config.Config{RateLimitRoutes: map[string]ratelimit.Rate{"/quotes/summary": ratelimit.PerMinute(60, 1)}}
+	client, baseURL := startAPI(t, newFakeRepo(), cfg)
+
+	resp, err := http.Get(baseURL + "/v1/quotes/summary?ticker=PETR4")
+	if err != nil {
+		t.Fatalf("http: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected HTTP 200, got %d", resp.StatusCode)
+	}
+	_, err = client.GetSummary(context.Background(), &quotesv1.GetSummaryRequest{Ticker: "PETR4"})
+	if code, info := errorInfo(t, err); code != codes.ResourceExhausted || info.Reason != errRateLimited.ID {
+		t.Fatalf("expected the HTTP request to count against the RPC, got %s %s", code, info.Reason)
+	}
+	if _, err := client.ListTickers(context.Background(), &quotesv1.ListTickersRequest{}); err != nil {
+		t.Fatalf("expected other routes not to be limited, got %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"desafiocotacaob3/internal/repository"
+	"desafiocotacaob3/internal/util"
+)
+
+// Check and overall statuses reported by /readyz. Stale data is reported as
+// degraded but keeps the instance ready: a late ingest should not take the API
+// out of rotation while it can still serve every earlier session.
+const (
+	statusOK          = "ok"
+	statusStale       = "stale"
+	statusDown        = "down"
+	statusDegraded    = "degraded"
+	statusUnavailable = "unavailable"
+)
+
+// Errors reported by a failed /readyz check. The cause is only logged, since
+// the probe is unauthenticated and driver errors name hosts and users.
+const (
+	checkTimedOut = "timed out"
+	checkFailed   = "failed"
+)
+
+// checkError logs why check failed and returns what /readyz reports of it.
+func checkError(ctx context.Context, check string, err error) string {
+	zerolog.Ctx(ctx).Warn().Err(err).Str("check", check).Msg("readiness check failed")
+	if errors.Is(err, context.DeadlineExceeded) {
+		return checkTimedOut
+	}
+	return checkFailed
+}
+
+type readinessRepo interface {
+	Ping(ctx context.Context) error
+	MigrationVersion(ctx context.Context) (int, error)
+	LatestSession(ctx context.Context) (time.Time, bool, error)
+}
+
+type dependencyCheck struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type migrationsCheck struct {
+	Status   string `json:"status"`
+	Version  int    `json:"version"`
+	Expected int    `json:"expected"`
+	Error    string `json:"error,omitempty"`
+}
+
+type freshnessCheck struct {
+	Status        string  `json:"status"`
+	LatestSession *string `json:"latest_session"`
+	StaleAfter    string  `json:"stale_after"`
+	Error         string  `json:"error,omitempty"`
+}
+
+type readinessChecks struct {
+	Database   dependencyCheck `json:"database"`
+	Migrations migrationsCheck `json:"migrations"`
+	Data       freshnessCheck  `json:"data"`
+}
+
+type readinessResponse struct {
+	Status string          `json:"status"`
+	Checks readinessChecks `json:"checks"`
+}
+
+// writeHealth sends a probe response, which must never be served from a cache.
+func writeHealth(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// healthzHandler reports that the process is serving requests. It does not
+// touch dependencies so a database outage does not get the API restarted.
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, map[string]string{"status": statusOK})
+}
+
+// readyzHandler reports whether the instance can serve queries: the database
+// answers within timeout and its schema is at the version this build expects.
+// The latest ingested session is reported alongside, flagged as stale once it
+// is more than staleAfterDays business days old.
+func readyzHandler(repo readinessRepo, timeout time.Duration, staleAfterDays int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		var resp readinessResponse
+		start := time.Now()
+		err := repo.Ping(ctx)
+		resp.Checks.Database = dependencyCheck{Status: statusOK, LatencyMS: float64(time.Since(start).Microseconds()) / 1000}
+		if err != nil {
+			resp.Checks.Database.Status = statusDown
+			resp.Checks.Database.Error = checkError(r.Context(), "database", err)
+		}
+
+		resp.Checks.Migrations = migrationsCheck{Status: statusOK, Expected: repository.SchemaVersion}
+		if v, err := repo.MigrationVersion(ctx); err != nil {
+			resp.Checks.Migrations.Status = statusDown
+			resp.Checks.Migrations.Error = checkError(r.Context(), "migrations", err)
+		} else if resp.Checks.Migrations.Version = v; v < repository.SchemaVersion {
+			resp.Checks.Migrations.Status = statusStale
+		}
+
+		staleAfter := util.BusinessDaysAgo(time.Now().UTC(), staleAfterDays)
+		resp.Checks.Data = freshnessCheck{Status: statusOK, StaleAfter: staleAfter.Format("2006-01-02")}
+		if day, ok, err := repo.LatestSession(ctx); err != nil {
+			resp.Checks.Data.Status = statusDown
+			resp.Checks.Data.Error = checkError(r.Context(), "data", err)
+		} else {
+			if ok {
+				s := day.Format("2006-01-02")
+				resp.Checks.Data.LatestSession = &s
+			}
+			if !ok || day.Before(staleAfter) {
+				resp.Checks.Data.Status = statusStale
+			}
+		}
+
+		status := http.StatusOK
+		switch {
+		case resp.Checks.Database.Status != statusOK || resp.Checks.Migrations.Status != statusOK:
+			resp.Status = statusUnavailable
+			status = http.StatusServiceUnavailable
+		case resp.Checks.Data.Status != statusOK:
+			resp.Status = statusDegraded
+		default:
+			resp.Status = statusOK
+		}
+		writeHealth(w, status, resp)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"desafiocotacaob3/internal/repository"
+)
+
+type stubHealthRepo struct {
+	pingErr   error
+	version   int
+	latest    time.Time
+	hasData   bool
+	latestErr error
+	deadline  bool
+}
+
+func (s *stubHealthRepo) Ping(ctx context.Context) error {
+	_, s.deadline = ctx.Deadline()
+	return s.pingErr
+}
+
+func (s *stubHealthRepo) MigrationVersion(ctx context.Context) (int, error) {
+	return s.version, nil
+}
+
+func (s *stubHealthRepo) LatestSession(ctx context.Context) (time.Time, bool, error) {
+	return s.latest, s.hasData, s.latestErr
+}
+
+func getReadiness(t *testing.T, repo readinessRepo) (int, readinessResponse) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	readyzHandler(repo, time.Second, 3)(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var resp readinessResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return rec.Code, resp
+}
+
+func TestHealthz(t *testing.T) {
+	rec := httptest.NewRecorder()
+	healthzHandler(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	if rec.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("probe responses must not be cached")
+	}
+}
+
+func TestReadyzOK(t *testing.T) {
+	repo := &stubHealthRepo{version: repository.SchemaVersion, latest: time.Now().UTC(), hasData: true}
+	status, resp := getReadiness(t, repo)
+	if status != http.StatusOK || resp.Status != statusOK {
+		t.Fatalf("expected ready, got %d %+v", status, resp)
+	}
+	if !repo.deadline {
+		t.Fatalf("checks must run with a timeout")
+	}
+	if resp.Checks.Data.LatestSession == nil || *resp.Checks.Data.LatestSession != time.Now().UTC().Format("2006-01-02") {
+		t.Fatalf("unexpected freshness %+v", resp.Checks.Data)
+	}
+}
+
+func TestReadyzStaleDataIsDegraded(t *testing.T) {
+	repo := &stubHealthRepo{version: repository.SchemaVersion, latest: time.Now().UTC().AddDate(0, 0, -30), hasData: true}
+	status, resp := getReadiness(t, repo)
+	if status != http.StatusOK || resp.Status != statusDegraded || resp.Checks.Data.Status != statusStale {
+		t.Fatalf("expected degraded, got %d %+v", status, resp)
+	}
+
+	status, resp = getReadiness(t, &stubHealthRepo{version: repository.SchemaVersion})
+	if status != http.StatusOK || resp.Checks.Data.Status != statusStale || resp.Checks.Data.LatestSession != nil {
+		t.Fatalf("empty table must be reported as stale, got %d %+v", status, resp)
+	}
+}
+
+func TestReadyzUnavailable(t *testing.T) {
+	status, resp := getReadiness(t, &stubHealthRepo{pingErr: errors.New(`dial tcp 10.0.0.5:5432: connect: connection refused`), version: repository.SchemaVersion})
+	if status != http.StatusServiceUnavailable || resp.Checks.Database.Status != statusDown || resp.Checks.Database.Error != checkFailed {
+		t.Fatalf("expected database down without the cause, got %d %+v", status, resp)
+	}
+
+	status, resp = getReadiness(t, &stubHealthRepo{version: repository.SchemaVersion, latestErr: fmt.Errorf("latest session: %w", context.DeadlineExceeded)})
+	if status != http.StatusOK || resp.Checks.Data.Status != statusDown || resp.Checks.Data.Error != checkTimedOut {
+		t.Fatalf("expected the data check to time out, got %d %+v", status, resp)
+	}
+
+	status, resp = getReadiness(t, &stubHealthRepo{version: repository.SchemaVersion - 1})
+	if status != http.StatusServiceUnavailable || resp.Checks.Migrations.Status != statusStale {
+		t.Fatalf("expected pending migrations, got %d %+v", status, resp)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"desafiocotacaob3/internal/indicators"
+	"desafiocotacaob3/internal/repository"
+)
+
+var (
+	errInvalidIndicator = apiError{ID: "ERR_INVALID_INDICATOR", Message: "indicator must be one of sma, ema, rsi, bollinger, macd"}
+	errInvalidPeriod    = apiError{ID: "ERR_INVALID_PERIOD", Message: "period, fast, slow and signal must be positive integers"}
+	errInvalidInterval  = apiError{ID: "ERR_INVALID_INTERVAL", Message: "interval must be one of 1m, 5m, 15m, 30m, 1h, 1d"}
+	errInvalidStdDev    = apiError{ID: "ERR_INVALID_STDDEV", Message: "k must be a positive number"}
+)
+
+type candlesRepo interface {
+	Candles(ctx context.Context, ticker string, interval time.Duration, from, to time.Time, warmup int) ([]repository.Bar, error)
+}
+
+type indicatorPoint struct {
+	Time   time.Time          `json:"time"`
+	Values map[string]float64 `json:"values"`
+}
+
+type indicatorsResponse struct {
+	Ticker    string           `json:"ticker"`
+	Indicator string           `json:"indicator"`
+	Interval  string           `json:"interval"`
+	Params    map[string]any   `json:"params"`
+	Warmup    int              `json:"warmup"`
+	Points    []indicatorPoint `json:"points"`
+}
+
+// indicatorSpec computes one indicator over closing prices. warmup is the
+// number of bars needed before the first valid value.
+type indicatorSpec struct {
+	name    string
+	params  map[string]any
+	warmup  int
+	compute func(closes []float64) map[string][]float64
+}
+
+func positiveIntParam(r *http.Request, name string, def int) (int, bool) {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return def, true
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v <= 0 {
+		return 0, false
+	}
+	return v, true
+}
+
+func parseIndicator(r *http.Request) (indicatorSpec, *apiError) {
+	name := strings.ToLower(r.URL.Query().Get("indicator"))
+	if name == "" {
+		name = "sma"
+	}
+	switch name {
+	case "sma", "ema", "rsi", "bollinger":
+		def := 20
+		if name == "rsi" {
+			def = 14
+		}
+		period, ok := positiveIntParam(r, "period", def)
+		if !ok {
+			return indicatorSpec{}, &errInvalidPeriod
+		}
+		spec := indicatorSpec{name: name, params: map[string]any{"period": period}}
+		switch name {
+		case "sma":
+			spec.warmup = indicators.SMAWarmup(period)
+			spec.compute = func(c []float64) map[string][]float64 {
+				return map[string][]float64{"sma": indicators.SMA(c, period)}
+			}
+		case "ema":
+			spec.warmup = indicators.EMAWarmup(period)
+			spec.compute = func(c []float64) map[string][]float64 {
+				return map[string][]float64{"ema": indicators.EMA(c, period)}
+			}
+		case "rsi":
+			spec.warmup = indicators.RSIWarmup(period)
+			spec.compute = func(c []float64) map[string][]float64 {
+				return map[string][]float64{"rsi": indicators.RSI(c, period)}
+			}
+		case "bollinger":
+			k := 2.0
+			if s := r.URL.Query().Get("k"); s != "" {
+				v, err := strconv.ParseFloat(s, 64)
+				if err != nil || v <= 0 {
+					return indicatorSpec{}, &errInvalidStdDev
+				}
+				k = v
+			}
+			spec.params["k"] = k
+			spec.warmup = indicators.BollingerWarmup(period)
+			spec.compute = func(c []float64) map[string][]float64 {
+				upper, middle, lower := indicators.Bollinger(c, period, k)
+				return map[string][]float64{"upper": upper, "middle": middle, "lower": lower}
+			}
+		}
+		return spec, nil
+	case "macd":
+		fast, ok1 := positiveIntParam(r, "fast", 12)
+		slow, ok2 := positiveIntParam(r, "slow", 26)
+		signal, ok3 := positiveIntParam(r, "signal", 9)
+		if !ok1 || !ok2 || !ok3 {
+			return indicatorSpec{}, &errInvalidPeriod
+		}
+		return indicatorSpec{
+			name:   name,
+			params: map[string]any{"fast": fast, "slow": slow, "signal": signal},
+			warmup: indicators.MACDWarmup(fast, slow, signal),
+			compute: func(c []float64) map[string][]float64 {
+				macd, sig, hist := indicators.MACD(c, fast, slow, signal)
+				return map[string][]float64{"macd": macd, "signal": sig, "histogram": hist}
+			},
+		}, nil
+	}
+	return indicatorSpec{}, &errInvalidIndicator
+}
+
+func quotesIndicatorsHandler(repo candlesRepo) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ticker := strings.ToUpper(r.URL.Query().Get("ticker"))
+		if ticker == "" {
+			writeError(w, r, http.StatusBadRequest, errMissingTicker)
+			return
+		}
+		intervalName := r.URL.Query().Get("interval")
+		if intervalName == "" {
+			intervalName = "1d"
+		}
+		interval, ok := repository.Intervals[intervalName]
+		if !ok {
+			writeError(w, r, http.StatusBadRequest, errInvalidInterval)
+			return
+		}
+		spec, apiErr := parseIndicator(r)
+		if apiErr != nil {
+			writeError(w, r, http.StatusBadRequest, *apiErr)
+			return
+		}
+		from, to, apiErr := parseDateRange(r, 7)
+		if apiErr != nil {
+			writeError(w, r, http.StatusBadRequest, *apiErr)
+			return
+		}
+
+		bars, err := repo.Candles(r.Context(), ticker, interval, from, to, spec.warmup)
+		if err != nil {
+			writeFailure(w, r, err)
+			return
+		}
+		if len(bars) == 0 {
+			writeError(w, r, http.StatusNotFound, errTickerNotFound)
+			return
+		}
+
+		closes := make([]float64, len(bars))
+		for i, b := range bars {
+			closes[i] = b.Close
+		}
+		series := spec.compute(closes)
+
+		resp := indicatorsResponse{
+			Ticker:    ticker,
+			Indicator: spec.name,
+			Interval:  intervalName,
+			Params:    spec.params,
+			Warmup:    spec.warmup,
+			Points:    []indicatorPoint{},
+		}
+	points:
+		for i, b := range bars {
+			if b.Time.Before(from) {
+				continue
+			}
+			values := make(map[string]float64, len(series))
+			for name, s := range series {
+				if math.IsNaN(s[i]) {
+					continue points
+				}
+				values[name] = s[i]
+			}
+			resp.Points = append(resp.Points, indicatorPoint{Time: b.Time, Values: values})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"desafiocotacaob3/internal/repository"
+)
+
+type stubCandlesRepo struct {
+	lastInterval time.Duration
+	lastWarmup   int
+	bars         []repository.Bar
+}
+
+func (s *stubCandlesRepo) Candles(ctx context.Context, ticker string, interval time.Duration, from, to time.Time, warmup int) ([]repository.Bar, error) {
+	s.lastInterval = interval
+	s.lastWarmup = warmup
+	return s.bars, nil
+}
+
+func TestQuotesIndicatorsWarmup(t *testing.T) {
+	repo := &stubCandlesRepo{bars: []repository.Bar{
+		dailyBar(2, 10), dailyBar(3, 20), dailyBar(6, 30), dailyBar(7, 40),
+	}}
+	srv := httptest.NewServer(quotesIndicatorsHandler(repo))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/quotes/indicators?ticker=PETR4&indicator=sma&period=3&from=2024-05-06&to=2024-05-07")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	var ind indicatorsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ind); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if repo.lastWarmup != 2 || repo.lastInterval != repository.Day {
+		t.Fatalf("unexpected query warmup=%d interval=%v", repo.lastWarmup, repo.lastInterval)
+	}
+	if len(ind.Points) != 2 {
+		t.Fatalf("expected 2 points, got %+v", ind.Points)
+	}
+	if ind.Points[0].Time.Day() != 6 || ind.Points[0].Values["sma"] != 20 || ind.Points[1].Values["sma"] != 30 {
+		t.Fatalf("unexpected points %+v", ind.Points)
+	}
+}
+
+func TestQuotesIndicatorsInvalidIndicator(t *testing.T) {
+	srv := httptest.NewServer(quotesIndicatorsHandler(nil))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/quotes/indicators?ticker=PETR4&indicator=foo")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", resp.StatusCode)
+	}
+	var e apiError
+	if err := json.NewDecoder(resp.Body).Decode(&e); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if e.ID != errInvalidIndicator.ID {
+		t.Fatalf("expected error %s, got %s", errInvalidIndicator.ID, e.ID)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// requestIDHeader carries the correlation ID of a request. An ID sent by the
+// client or a proxy is kept so the request can be followed across services.
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLen bounds client-supplied IDs, which end up in every log line.
+const maxRequestIDLen = 128
+
+// validRequestID accepts IDs made of printable ASCII without spaces, so a
+// client cannot forge log fields or split headers.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+type requestLoggerKey struct{}
+
+// logField adds a field to the logger of the request ctx belongs to, so it is
+// attached to every line logged from then on, the access log line included.
+// It is a no-op outside of requestLogger and the gRPC logging interceptor.
+func logField(ctx context.Context, key, value string) {
+	if l, ok := ctx.Value(requestLoggerKey{}).(*zerolog.Logger); ok {
+		l.UpdateContext(func(c zerolog.Context) zerolog.Context {
+			return c.Str(key, value)
+		})
+	}
+}
+
+// requestID is the correlation ID requestLogger assigned to the response
+// being written to w, or "" outside of it.
+func requestID(w http.ResponseWriter) string {
+	return w.Header().Get(requestIDHeader)
+}
+
+// statusRecorder captures what a handler sent for the access log.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += int64(n)
+	return n, err
+}
+
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack hands the connection to handlers that answer on it themselves, as
+// WebSocket upgrades do.
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(s.ResponseWriter).Hijack()
+	if err == nil && s.status == 0 {
+		s.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// requestLogger assigns or propagates the X-Request-ID of every request,
+// echoes it in the response and logs one line per request once it is served.
+// Handlers log through zerolog.Ctx(r.Context()) to have the ID attached.
+func requestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		w.Header().Set(requestIDHeader, id)
+		ctx := log.With().Str("request_id", id).Logger().WithContext(r.Context())
+		logger := zerolog.Ctx(ctx)
+		r = r.WithContext(context.WithValue(ctx, requestLoggerKey{}, logger))
+
+		rec := &statusRecorder{ResponseWriter: w}
+		start := time.Now()
+		defer func() {
+			status := rec.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			p := recover()
+			var event *zerolog.Event
+			switch {
+			case p != nil:
+				// The connection is dropped, so whatever was sent is all the
+				// client got.
+				event = logger.Error().Interface("panic", p)
+			case status >= 500:
+				event = logger.Error()
+			default:
+				event = logger.Info()
+			}
+			event.Str("method", r.Method).
+				Str("path", r.URL.Path).
+				Str("query", r.URL.RawQuery).
+				Int("status", status).
+				Dur("latency", time.Since(start)).
+				Int64("bytes", rec.bytes).
+				Str("remote", r.RemoteAddr).
+				Str("user_agent", r.UserAgent()).
+				Msg("request")
+			if p != nil {
+				panic(p)
+			}
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
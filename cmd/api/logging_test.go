@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// captureLog redirects the global logger to a buffer for the test.
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	orig := log.Logger
+	log.Logger = zerolog.New(&buf)
+	t.Cleanup(func() { log.Logger = orig })
+	return &buf
+}
+
+func TestRequestLoggerPropagatesID(t *testing.T) {
+	buf := captureLog(t)
+	h := requestLogger(quotesSummaryHandler(&stubSummaryRepo{}))
+
+	req := httptest.NewRequest(http.MethodGet, "/quotes/summary", nil)
+	req.Header.Set(requestIDHeader, "abc-123")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get(requestIDHeader); got != "abc-123" {
+		t.Fatalf("expected propagated request id, got %q", got)
+	}
+	var e apiError
+	if err := json.NewDecoder(rec.Body).Decode(&e); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if e.RequestID != "abc-123" {
+		t.Fatalf("expected request id in error body, got %+v", e)
+	}
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("decode log line %q: %v", buf, err)
+	}
+	if line["request_id"] != "abc-123" || line["status"] != float64(http.StatusBadRequest) || line["path"] != "/quotes/summary" || line["method"] != http.MethodGet {
+		t.Fatalf("unexpected access log %v", line)
+	}
+	if _, ok := line["latency"]; !ok || line["bytes"] == float64(0) {
+		t.Fatalf("access log lacks latency or bytes: %v", line)
+	}
+}
+
+func TestRequestLoggerGeneratesID(t *testing.T) {
+	captureLog(t)
+	h := requestLogger(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, sent := range []string{"", "has space", strings.Repeat("x", maxRequestIDLen+1)} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(requestIDHeader, sent)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if got := rec.Header().Get(requestIDHeader); got == "" || got == sent {
+			t.Fatalf("expected a generated id for %q, got %q", sent, got)
+		}
+	}
+}
+
+func TestInternalErrorLoggedWithRequestID(t *testing.T) {
+	buf := captureLog(t)
+	h := requestLogger(quotesSummaryHandler(&stubSummaryRepo{err: errors.New("connection reset")}))
+
+	req := httptest.NewRequest(http.MethodGet, "/quotes/summary?ticker=PETR4", nil)
+	req.Header.Set(requestIDHeader, "req-1")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected an error and an access log line, got %q", buf)
+	}
+	var line map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &line); err != nil {
+		t.Fatalf("decode log line: %v", err)
+	}
+	if line["request_id"] != "req-1" || line["error"] != "connection reset" {
+		t.Fatalf("repository error not logged with request id: %v", line)
+	}
+}
@@ -1,17 +1,22 @@
 package main
 
 import (
-	"compress/gzip"
 	"context"
 	"encoding/json"
-	"io"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/rs/zerolog/log"
+	"golang.org/x/sync/errgroup"
 
+	"desafiocotacaob3/internal/auth"
 	"desafiocotacaob3/internal/config"
+	"desafiocotacaob3/internal/ratelimit"
 	"desafiocotacaob3/internal/repository"
 	"desafiocotacaob3/internal/util"
 )
@@ -22,47 +27,102 @@ func main() {
 		log.Fatal().Err(err).Msg("failed to load configuration")
 	}
 
+	// The keys are loaded once at startup, so a bad JWKS stops the API
+	// before it serves anything.
+	var tokens tokenVerifier
+	if cfg.JWKS != "" {
+		verifier := auth.NewVerifier(cfg.JWKS, cfg.JWTIssuer, cfg.JWTAudience, cfg.JWTLeeway)
+		if err := verifier.Refresh(context.Background()); err != nil {
+			log.Fatal().Err(err).Msg("failed to load JWKS")
+		}
+		tokens = verifier
+	}
+
 	repo, err := repository.NewPostgres(cfg)
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to connect to database")
 	}
 
-	mux := http.NewServeMux()
-	mux.HandleFunc("/quotes/summary", quotesSummaryHandler(repo))
+	defer repo.Close()
 
-	addr := ":" + cfg.APIPort
-	log.Info().Msgf("API running on port %s", cfg.APIPort)
-	if err := http.ListenAndServe(addr, gzipMiddleware(mux)); err != nil {
-		log.Fatal().Err(err).Msg("failed to start server")
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var data apiRepository = repo
+	events := newQuoteEvents(repo)
+	onIngest := []func(day string){events.notify}
+	if cfg.QueryCacheSize > 0 {
+		cached := newCachedRepo(repo, cfg.QueryCacheSize, cfg.QueryCacheTTL)
+		onIngest = append(onIngest, cached.invalidate)
+		data = cached
 	}
-}
+	go func() {
+		err := repo.ListenIngest(ctx, func(day string) {
+			for _, fn := range onIngest {
+				fn(day)
+			}
+		})
+		if err != nil {
+			log.Error().Err(err).Msgf("failed to listen to ingest notifications, event streams are not woken and query cache entries only expire after %s", cfg.QueryCacheTTL)
+		}
+	}()
 
-func gzipMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
-			w.Header().Set("Content-Encoding", "gzip")
-			gz := gzip.NewWriter(w)
-			defer gz.Close()
-			gw := gzipResponseWriter{ResponseWriter: w, Writer: gz}
-			next.ServeHTTP(gw, r)
-			return
+	reg := newRegistry(repo.Collectors()...)
+	acc := newAccess(data, tokens, cfg)
+	mux := newRouter(data, cfg, reg, events, acc)
+	srv := newServer(cfg, requestLogger(compress(mux, cfg.CompressMinSize)))
+	srv.RegisterOnShutdown(events.close)
+	grpcSrv := newGRPCServer(data, cfg, reg, acc)
+
+	ln, err := net.Listen("tcp", ":"+cfg.APIPort)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to start server")
+	}
+	defer ln.Close()
+	var httpLn, grpcLn net.Listener
+	if cfg.GRPCPort == "" || cfg.GRPCPort == cfg.APIPort {
+		httpLn, grpcLn = splitGRPC(ln, cfg.ReadHeaderTimeout)
+		log.Info().Msgf("API running on port %s, gRPC included", cfg.APIPort)
+	} else {
+		httpLn = ln
+		if grpcLn, err = net.Listen("tcp", ":"+cfg.GRPCPort); err != nil {
+			log.Fatal().Err(err).Msg("failed to start gRPC server")
 		}
-		next.ServeHTTP(w, r)
-	})
-}
+		log.Info().Msgf("API running on port %s, gRPC on port %s", cfg.APIPort, cfg.GRPCPort)
+	}
 
-type gzipResponseWriter struct {
-	http.ResponseWriter
-	io.Writer
+	g, gctx := errgroup.WithContext(ctx)
+	g.Go(func() error { return serve(gctx, srv, httpLn, cfg.ShutdownTimeout) })
+	g.Go(func() error { return serveGRPC(gctx, grpcSrv, grpcLn, cfg.ShutdownTimeout) })
+	if err := g.Wait(); err != nil {
+		log.Fatal().Err(err).Msg("server did not shut down cleanly")
+	}
+	log.Info().Msg("server stopped")
 }
 
-func (w gzipResponseWriter) Write(b []byte) (int, error) {
-	return w.Writer.Write(b)
+// apiRepository is everything the HTTP handlers read from storage.
+type apiRepository interface {
+	quoteSummaryRepo
+	dailyBarsRepo
+	candlesRepo
+	sessionStatsRepo
+	quoteEventsRepo
+	tradeReplayRepo
+	volumeRepo
+	tradesStreamer
+	candlesStreamer
+	quoteBatchRepo
+	generationRepo
+	readinessRepo
+	apiKeyStore
+	ratelimit.Backend
 }
 
 type apiError struct {
 	ID      string `json:"id"`
 	Message string `json:"message"`
+	// RequestID is the X-Request-ID of the failed request, for support.
+	RequestID string `json:"request_id,omitempty"`
 }
 
 var (
@@ -81,17 +141,11 @@ type quoteSummaryRepo interface {
 	QuoteSummary(ctx context.Context, ticker string, startDate time.Time) (float64, int64, bool, error)
 }
 
-func writeError(w http.ResponseWriter, status int, e apiError) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	_ = json.NewEncoder(w).Encode(e)
-}
-
 func quotesSummaryHandler(repo quoteSummaryRepo) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ticker := strings.ToUpper(r.URL.Query().Get("ticker"))
 		if ticker == "" {
-			writeError(w, http.StatusBadRequest, errMissingTicker)
+			writeError(w, r, http.StatusBadRequest, errMissingTicker)
 			return
 		}
 
@@ -100,7 +154,7 @@ func quotesSummaryHandler(repo quoteSummaryRepo) http.HandlerFunc {
 			var err error
 			startDate, err = time.Parse("2006-01-02", ds)
 			if err != nil {
-				writeError(w, http.StatusBadRequest, errInvalidDate)
+				writeError(w, r, http.StatusBadRequest, errInvalidDate)
 				return
 			}
 		} else {
@@ -109,11 +163,11 @@ func quotesSummaryHandler(repo quoteSummaryRepo) http.HandlerFunc {
 
 		maxPrice, maxVolume, ok, err := repo.QuoteSummary(r.Context(), ticker, startDate)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, apiError{ID: "ERR_INTERNAL", Message: err.Error()})
+			writeFailure(w, r, err)
 			return
 		}
 		if !ok {
-			writeError(w, http.StatusNotFound, errTickerNotFound)
+			writeError(w, r, http.StatusNotFound, errTickerNotFound)
 			return
 		}
 
@@ -18,9 +18,11 @@ type stubSummaryRepo struct {
 	maxVolume  int64
 	ok         bool
 	err        error
+	calls      int
 }
 
 func (s *stubSummaryRepo) QuoteSummary(ctx context.Context, ticker string, startDate time.Time) (float64, int64, bool, error) {
+	s.calls++
 	s.lastTicker = ticker
 	s.lastStart = startDate
 	return s.maxPrice, s.maxVolume, s.ok, s.err
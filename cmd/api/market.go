@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"desafiocotacaob3/internal/instrument"
+	"desafiocotacaob3/internal/repository"
+	"desafiocotacaob3/internal/util"
+)
+
+const (
+	moversDefaultLimit = 20
+	moversMaxLimit     = 500
+)
+
+var (
+	errInvalidMoversBy = apiError{ID: "ERR_INVALID_BY", Message: "by must be one of change, volume, notional, trades"}
+	errInvalidClass    = apiError{ID: "ERR_INVALID_CLASS", Message: "class must be one of stock, unit, bdr, fractional, option, future, other"}
+	errInvalidLimit    = apiError{ID: "ERR_INVALID_LIMIT", Message: "limit must be an integer between 1 and 500"}
+	errNoSessionData   = apiError{ID: "ERR_NO_SESSION_DATA", Message: "no trades found for date"}
+	errInvalidDay      = apiError{ID: "ERR_INVALID_DATE", Message: "invalid date format"}
+)
+
+type sessionStatsRepo interface {
+	SessionStats(ctx context.Context, day time.Time) ([]repository.SessionStats, error)
+}
+
+type moverEntry struct {
+	Ticker    string           `json:"ticker"`
+	Class     instrument.Class `json:"class"`
+	Open      float64          `json:"open"`
+	Close     float64          `json:"close"`
+	PrevClose float64          `json:"prev_close,omitempty"`
+	Change    *float64         `json:"change,omitempty"`
+	Volume    int64            `json:"volume"`
+	Notional  float64          `json:"notional"`
+	Trades    int64            `json:"trades"`
+}
+
+type moversResponse struct {
+	Date   string       `json:"date"`
+	By     string       `json:"by"`
+	Class  string       `json:"class,omitempty"`
+	Top    []moverEntry `json:"top"`
+	Bottom []moverEntry `json:"bottom,omitempty"`
+}
+
+// moverMetrics maps the accepted by values to the ranked quantity.
+var moverMetrics = map[string]func(moverEntry) float64{
+	"change":   func(e moverEntry) float64 { return *e.Change },
+	"volume":   func(e moverEntry) float64 { return float64(e.Volume) },
+	"notional": func(e moverEntry) float64 { return e.Notional },
+	"trades":   func(e moverEntry) float64 { return float64(e.Trades) },
+}
+
+// rankMovers filters stats by class (empty for all) and returns the limit
+// entries with the highest metric. For change it also returns up to limit
+// entries with the lowest among the others, so a ticker is never both a
+// gainer and a loser, ignoring tickers without a previous close.
+func rankMovers(stats []repository.SessionStats, by string, class instrument.Class, limit int) (top, bottom []moverEntry) {
+	metric := moverMetrics[by]
+	entries := make([]moverEntry, 0, len(stats))
+	for _, s := range stats {
+		e := moverEntry{
+			Ticker:    s.Ticker,
+			Class:     instrument.Classify(s.Ticker),
+			Open:      s.Open,
+			Close:     s.Close,
+			PrevClose: s.PrevClose,
+			Volume:    s.Volume,
+			Notional:  s.Notional,
+			Trades:    s.Trades,
+		}
+		if class != "" && e.Class != class {
+			continue
+		}
+		if s.PrevClose > 0 {
+			change := s.Close/s.PrevClose - 1
+			e.Change = &change
+		} else if by == "change" {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		mi, mj := metric(entries[i]), metric(entries[j])
+		if mi != mj {
+			return mi > mj
+		}
+		return entries[i].Ticker < entries[j].Ticker
+	})
+
+	n := min(limit, len(entries))
+	top = append([]moverEntry{}, entries[:n]...)
+	if by == "change" {
+		rest := min(limit, len(entries)-n)
+		bottom = make([]moverEntry, 0, rest)
+		for i := len(entries) - 1; i >= len(entries)-rest; i-- {
+			bottom = append(bottom, entries[i])
+		}
+	}
+	return top, bottom
+}
+
+func marketMoversHandler(repo sessionStatsRepo) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		day := util.BusinessDaysAgo(time.Now().UTC(), 1)
+		if ds := q.Get("date"); ds != "" {
+			var err error
+			day, err = time.Parse("2006-01-02", ds)
+			if err != nil {
+				writeError(w, r, http.StatusBadRequest, errInvalidDay)
+				return
+			}
+		}
+		by := q.Get("by")
+		if by == "" {
+			by = "change"
+		}
+		if _, ok := moverMetrics[by]; !ok {
+			writeError(w, r, http.StatusBadRequest, errInvalidMoversBy)
+			return
+		}
+		var class instrument.Class
+		if cs := q.Get("class"); cs != "" {
+			var ok bool
+			if class, ok = instrument.ParseClass(cs); !ok {
+				writeError(w, r, http.StatusBadRequest, errInvalidClass)
+				return
+			}
+		}
+		limit := moversDefaultLimit
+		if ls := q.Get("limit"); ls != "" {
+			v, err := strconv.Atoi(ls)
+			if err != nil || v < 1 || v > moversMaxLimit {
+				writeError(w, r, http.StatusBadRequest, errInvalidLimit)
+				return
+			}
+			limit = v
+		}
+
+		stats, err := repo.SessionStats(r.Context(), day)
+		if err != nil {
+			writeFailure(w, r, err)
+			return
+		}
+		if len(stats) == 0 {
+			writeError(w, r, http.StatusNotFound, errNoSessionData)
+			return
+		}
+
+		top, bottom := rankMovers(stats, by, class, limit)
+		resp := moversResponse{
+			Date:   day.Format("2006-01-02"),
+			By:     by,
+			Class:  string(class),
+			Top:    top,
+			Bottom: bottom,
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
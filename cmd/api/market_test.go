@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"desafiocotacaob3/internal/instrument"
+	"desafiocotacaob3/internal/repository"
+)
+
+type stubSessionRepo struct {
+	lastDay time.Time
+	stats   []repository.SessionStats
+}
+
+func (s *stubSessionRepo) SessionStats(ctx context.Context, day time.Time) ([]repository.SessionStats, error) {
+	s.lastDay = day
+	return s.stats, nil
+}
+
+var sessionFixture = []repository.SessionStats{
+	{Ticker: "PETR4", Close: 11, PrevClose: 10, Volume: 500, Notional: 5500, Trades: 50},
+	{Ticker: "VALE3", Close: 9, PrevClose: 10, Volume: 900, Notional: 8100, Trades: 10},
+	{Ticker: "BOVA11", Close: 10.5, PrevClose: 10, Volume: 100, Notional: 1050, Trades: 5},
+	{Ticker: "ITUB4", Close: 20, Volume: 2000, Notional: 40000, Trades: 70},
+}
+
+func TestRankMoversByChange(t *testing.T) {
+	top, bottom := rankMovers(sessionFixture, "change", "", 2)
+	if len(top) != 2 || top[0].Ticker != "PETR4" || top[1].Ticker != "BOVA11" {
+		t.Fatalf("unexpected gainers %+v", top)
+	}
+	if len(bottom) != 1 || bottom[0].Ticker != "VALE3" {
+		t.Fatalf("expected the losers not among the gainers, got %+v", bottom)
+	}
+
+	top, bottom = rankMovers(sessionFixture, "change", "", 1)
+	if len(top) != 1 || top[0].Ticker != "PETR4" || len(bottom) != 1 || bottom[0].Ticker != "VALE3" {
+		t.Fatalf("unexpected movers %+v %+v", top, bottom)
+	}
+}
+
+func TestRankMoversByVolumeAndClass(t *testing.T) {
+	top, bottom := rankMovers(sessionFixture, "volume", instrument.Stock, 10)
+	if bottom != nil {
+		t.Fatalf("expected no bottom list for volume, got %+v", bottom)
+	}
+	want := []string{"ITUB4", "VALE3", "PETR4"}
+	if len(top) != len(want) {
+		t.Fatalf("expected %d entries, got %+v", len(want), top)
+	}
+	for i, ticker := range want {
+		if top[i].Ticker != ticker {
+			t.Fatalf("entry %d = %s, want %s", i, top[i].Ticker, ticker)
+		}
+	}
+	if top[0].Change != nil {
+		t.Fatalf("expected no change without a previous close")
+	}
+}
+
+func TestMarketMoversHandler(t *testing.T) {
+	repo := &stubSessionRepo{stats: sessionFixture}
+	srv := httptest.NewServer(marketMoversHandler(repo))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/market/movers?date=2024-05-10&by=trades&limit=1")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	var m moversResponse
+	if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !repo.lastDay.Equal(time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected day %v", repo.lastDay)
+	}
+	if len(m.Top) != 1 || m.Top[0].Ticker != "ITUB4" {
+		t.Fatalf("unexpected movers %+v", m.Top)
+	}
+}
+
+func TestMarketMoversInvalidBy(t *testing.T) {
+	srv := httptest.NewServer(marketMoversHandler(nil))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/market/movers?by=price")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", resp.StatusCode)
+	}
+	var e apiError
+	if err := json.NewDecoder(resp.Body).Decode(&e); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if e.ID != errInvalidMoversBy.ID {
+		t.Fatalf("expected error %s, got %s", errInvalidMoversBy.ID, e.ID)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"desafiocotacaob3/internal/config"
+)
+
+func TestMetricsPerRoute(t *testing.T) {
+	repo := newFakeRepo()
+	cfg := &config.Config{}
+	router := newRouter(repo, cfg, prometheus.NewRegistry(), newQuoteEvents(repo), newAccess(repo, nil, cfg))
+
+	for _, path := range []string{"/v1/quotes/summary?ticker=PETR4", "/v1/quotes/summary?ticker=PETR4", "/v1/quotes/summary", "/quotes/summary?ticker=PETR4"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	body, _ := io.ReadAll(rec.Body)
+	for _, want := range []string{
+		`quotes_http_requests_total{code="200",method="get",route="/v1/quotes/summary"} 2`,
+		`quotes_http_requests_total{code="400",method="get",route="/v1/quotes/summary"} 1`,
+		`quotes_http_requests_total{code="200",method="get",route="/quotes/summary"} 1`,
+		`quotes_http_request_duration_seconds_count{code="200",method="get",route="/v1/quotes/summary"} 2`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Fatalf("missing %q in:\n%s", want, body)
+		}
+	}
+}
+
+func TestMetricsNeedAdminIngest(t *testing.T) {
+	repo := newFakeRepo()
+	cfg := &config.Config{AuthRequired: true}
+	router := newRouter(repo, cfg, prometheus.NewRegistry(), newQuoteEvents(repo), newAccess(repo, nil, cfg))
+
+	for key, want := range map[string]int{
+		"":                 http.StatusUnauthorized,
+		"qk_reader_secret": http.StatusForbidden,
+		"qk_admin_secret":  http.StatusOK,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if key != "" {
+			req.Header.Set(apiKeyHeader, key)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Fatalf("key %q: expected status %d, got %d", key, want, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openapiSpec is the contract of every endpoint registered by newRouter. It is
+// checked against the handlers in openapi_test.go.
+//
+//go:embed openapi.json
+var openapiSpec []byte
+
+//go:embed docs.html
+var docsPage []byte
+
+func openapiHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(openapiSpec)
+}
+
+func docsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write(docsPage)
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/legacy"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"desafiocotacaob3/internal/config"
+	"desafiocotacaob3/internal/repository"
+)
+
+// fakeRepo serves the fixtures of the per-handler tests through every
+// repository interface newRouter needs.
+type fakeRepo struct {
+	*stubSummaryRepo
+	stubMultiBarsRepo
+	*stubCandlesRepo
+	*stubSessionRepo
+	*stubVolumeRepo
+	*stubStreamRepo
+	*stubHealthRepo
+	*stubSessionsRepo
+	*stubKeyRepo
+	*stubRateBackend
+	*stubBatchRepo
+	*stubIngestLog
+}
+
+func newFakeRepo() *fakeRepo {
+	return &fakeRepo{
+		stubSummaryRepo:   &stubSummaryRepo{maxPrice: 10.5, maxVolume: 1000, ok: true},
+		stubMultiBarsRepo: compareFixture,
+		stubCandlesRepo:   &stubCandlesRepo{bars: []repository.Bar{dailyBar(2, 10), dailyBar(3, 20), dailyBar(6, 30), dailyBar(7, 40)}},
+		stubSessionRepo:   &stubSessionRepo{stats: sessionFixture},
+		stubVolumeRepo: &stubVolumeRepo{
+			points: []repository.VWAPPoint{{Time: time.Date(2024, 5, 10, 10, 0, 0, 0, time.UTC), VWAP: 10, CumulativeVWAP: 10, Volume: 100}},
+			levels: []repository.PriceLevel{{Price: 10, Volume: 100, Trades: 2}},
+		},
+		stubStreamRepo: &stubStreamRepo{
+			trades: []repository.Trade{{ID: "6f1c1bde-8f0c-4f43-9b0e-7e4a4a2b8a10", Ticker: "PETR4", Time: time.Date(2024, 5, 10, 10, 0, 0, 0, time.UTC), Price: 10.5, Quantity: 100}},
+			bars:   []repository.Bar{dailyBar(9, 10)},
+		},
+		stubHealthRepo:   &stubHealthRepo{version: repository.SchemaVersion, latest: time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC), hasData: true},
+		stubSessionsRepo: &stubSessionsRepo{days: []time.Time{time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)}},
+		stubKeyRepo:      newStubKeyRepo(testKeys),
+		stubRateBackend:  &stubRateBackend{},
+		stubBatchRepo:    &stubBatchRepo{summaries: batchFixture.summaries, bars: batchFixture.bars, trades: batchFixture.trades},
+		stubIngestLog:    ingestLogFixture(),
+	}
+}
+
+// decodeNDJSON validates every line of an NDJSON body against the per-record
+// schema, since openapi3filter only knows how to check a single document.
+func decodeNDJSON(body io.Reader, _ http.Header, schema *openapi3.SchemaRef, _ openapi3filter.EncodingFn) (any, error) {
+	dec := json.NewDecoder(body)
+	var last any
+	for dec.More() {
+		var v any
+		if err := dec.Decode(&v); err != nil {
+			return nil, err
+		}
+		if err := schema.Value.VisitJSON(v); err != nil {
+			return nil, err
+		}
+		last = v
+	}
+	return last, nil
+}
+
+func loadSpec(t *testing.T) *openapi3.T {
+	t.Helper()
+	doc, err := openapi3.NewLoader().LoadFromData(openapiSpec)
+	if err != nil {
+		t.Fatalf("load spec: %v", err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		t.Fatalf("invalid spec: %v", err)
+	}
+	return doc
+}
+
+func TestOpenAPIResponsesConform(t *testing.T) {
+	doc := loadSpec(t)
+	router, err := legacy.NewRouter(doc)
+	if err != nil {
+		t.Fatalf("router: %v", err)
+	}
+	repo := newFakeRepo()
+	cfg := &config.Config{RiskFreeRate: 0.1, ReadinessTimeout: time.Second}
+	mux := newRouter(repo, cfg, prometheus.NewRegistry(), newQuoteEvents(repo), newAccess(repo, nil, cfg))
+	openapi3filter.RegisterBodyDecoder("application/x-ndjson", decodeNDJSON)
+
+	tests := []struct {
+		path   string
+		status int
+		accept string
+	}{
+		{"/v1/quotes/summary?ticker=PETR4", http.StatusOK, ""},
+		{"/v1/quotes/summary", http.StatusBadRequest, ""},
+		{"/v1/quotes/summary", http.StatusBadRequest, "application/problem+json"},
+		{"/v1/quotes/summary?ticker=PETR4&date_start=2024-13-01", http.StatusBadRequest, ""},
+		{"/v1/quotes/analytics?ticker=PETR4&from=2024-05-01&to=2024-05-10", http.StatusOK, ""},
+		{"/v1/quotes/analytics?ticker=PETR4&risk_free=abc", http.StatusBadRequest, ""},
+		{"/v1/quotes/indicators?ticker=PETR4&indicator=bollinger&period=2&from=2024-05-03&to=2024-05-07", http.StatusOK, ""},
+		{"/v1/quotes/indicators?ticker=PETR4&indicator=macd&fast=1&slow=2&signal=1&from=2024-05-03", http.StatusOK, ""},
+		{"/v1/quotes/correlation?tickers=PETR4,VALE3&from=2024-05-01&to=2024-05-10", http.StatusOK, ""},
+		{"/v1/quotes/correlation?tickers=PETR4", http.StatusBadRequest, ""},
+		{"/v1/quotes/compare?tickers=PETR4,VALE3&from=2024-05-01&to=2024-05-10", http.StatusOK, ""},
+		{"/v1/quotes/compare?tickers=PETR4,XXXX", http.StatusNotFound, ""},
+		{"/v1/quotes/trades?ticker=PETR4", http.StatusOK, ""},
+		{"/v1/quotes/candles?ticker=PETR4&format=ndjson", http.StatusOK, ""},
+		{"/v1/quotes/candles?ticker=PETR4&format=xml", http.StatusBadRequest, ""},
+		{"/v1/quotes/vwap?ticker=PETR4&date=2024-05-10", http.StatusOK, ""},
+		{"/v1/quotes/volume-profile?ticker=PETR4&bucket=0.1", http.StatusOK, ""},
+		{"/v1/market/movers?date=2024-05-10&by=change", http.StatusOK, ""},
+		{"/v1/market/movers?class=crypto", http.StatusBadRequest, ""},
+		{"/v1/stream/quotes", http.StatusBadRequest, ""},
+		{"/v1/stream/trades?speed=fast", http.StatusBadRequest, ""},
+		{"/v1/stream/trades?date=2024-05-09", http.StatusNotFound, ""},
+		{"/v1/graphql?query=%7Bticker(symbol:%22PETR4%22)%7Bsymbol%20summary%7BmaxRangeValue%7Dbars%7Btime%20close%7D%7D%7D", http.StatusOK, ""},
+		{"/v1/graphql?query=%7Bticker(symbol:%22PETR4%22)%7Bbars(interval:%222h%22)%7Bclose%7D%7D%7D", http.StatusBadRequest, ""},
+		{"/v1/graphql?query=%7Bticker", http.StatusBadRequest, ""},
+		{"/quotes/summary?ticker=PETR4", http.StatusOK, ""},
+		{"/quotes/summary", http.StatusBadRequest, ""},
+		{"/openapi.json", http.StatusOK, ""},
+		{"/healthz", http.StatusOK, ""},
+		{"/readyz", http.StatusOK, ""},
+		{"/metrics", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost"+tt.path, nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Fatalf("%s: expected status %d, got %d: %s", tt.path, tt.status, rec.Code, rec.Body)
+		}
+
+		route, pathParams, err := router.FindRoute(req)
+		if err != nil {
+			t.Fatalf("%s: route not in spec: %v", tt.path, err)
+		}
+		input := &openapi3filter.RequestValidationInput{Request: req, PathParams: pathParams, Route: route, Options: &openapi3filter.Options{AuthenticationFunc: openapi3filter.NoopAuthenticationFunc}}
+		if rec.Code < 400 {
+			if err := openapi3filter.ValidateRequest(context.Background(), input); err != nil {
+				t.Fatalf("%s: request does not conform: %v", tt.path, err)
+			}
+		}
+		err = openapi3filter.ValidateResponse(context.Background(), &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: input,
+			Status:                 rec.Code,
+			Header:                 rec.Header(),
+			Body:                   io.NopCloser(rec.Body),
+		})
+		if err != nil {
+			t.Fatalf("%s: response does not conform: %v", tt.path, err)
+		}
+	}
+}
+
+func TestOpenAPIDocumentsErrorIDs(t *testing.T) {
+	doc := loadSpec(t)
+	enum := doc.Components.Schemas["Error"].Value.Properties["id"].Value.Enum
+	documented := make(map[string]bool, len(enum))
+	for _, id := range enum {
+		documented[id.(string)] = true
+	}
+	all := []apiError{
+		errMissingTicker, errInvalidDate, errTickerNotFound,
+		errInvalidRange, errInvalidDateRange, errInvalidRiskFree, errInsufficientData,
+		errInvalidIndicator, errInvalidPeriod, errInvalidInterval, errInvalidStdDev,
+		errInvalidMoversBy, errInvalidClass, errInvalidLimit, errNoSessionData, errInvalidDay,
+		errMissingTickers, errTooFewTickers, errTooManyTickers, errTickersNotFound,
+		errInvalidBucket, errInvalidFormat, errNotAcceptable, errInvalidEventID, errInvalidSpeed,
+		errInvalidQuery, errQueryTooComplex,
+		errInternal, errTimeout, errUnavailable,
+		errUnauthorized, errForbidden, errRateLimited,
+	}
+	for _, e := range all {
+		if !documented[e.ID] {
+			t.Fatalf("error id %s is not documented in openapi.json", e.ID)
+		}
+	}
+}
+
+func TestOpenAPICoversRoutes(t *testing.T) {
+	doc := loadSpec(t)
+	repo := newFakeRepo()
+	cfg := &config.Config{}
+	mux := newRouter(repo, cfg, prometheus.NewRegistry(), newQuoteEvents(repo), newAccess(repo, nil, cfg))
+	for path, item := range doc.Paths.Map() {
+		for method := range item.Operations() {
+			req := httptest.NewRequest(method, path, nil)
+			if _, pattern := mux.Handler(req); pattern != method+" "+path {
+				t.Fatalf("documented operation %s %s is not routed (matched %q)", method, path, pattern)
+			}
+		}
+	}
+	for _, pattern := range mux.patterns {
+		method, path, _ := strings.Cut(pattern, " ")
+		if item := doc.Paths.Value(path); item == nil || item.GetOperation(method) == nil {
+			t.Fatalf("route %s is not documented in openapi.json", pattern)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"desafiocotacaob3/internal/cache"
+	"desafiocotacaob3/internal/repository"
+)
+
+type summaryResult struct {
+	maxPrice  float64
+	maxVolume int64
+	ok        bool
+}
+
+// cachedRepo answers aggregate queries from memory, keyed by their
+// normalized parameters. Results only change when a session is ingested, so
+// the caches are purged then rather than left to expire. The bars and trades
+// GraphQL loads are left uncached: a batch of them holds up to thousands of
+// rows, too many to keep hundreds of batches.
+type cachedRepo struct {
+	apiRepository
+	summaries *cache.Cache[summaryResult]
+	batches   *cache.Cache[map[string]repository.Summary]
+}
+
+func newCachedRepo(repo apiRepository, size int, ttl time.Duration) *cachedRepo {
+	return &cachedRepo{
+		apiRepository: repo,
+		summaries:     cache.New[summaryResult](size, ttl),
+		batches:       cache.New[map[string]repository.Summary](size, ttl),
+	}
+}
+
+// startKey is the cache key part of a start date, empty when there is none.
+func startKey(startDate time.Time) string {
+	if startDate.IsZero() {
+		return ""
+	}
+	return startDate.Format("2006-01-02")
+}
+
+func (c *cachedRepo) QuoteSummary(ctx context.Context, ticker string, startDate time.Time) (float64, int64, bool, error) {
+	ticker = strings.ToUpper(ticker)
+	res, err := c.summaries.Get(ctx, ticker+"|"+startKey(startDate), func(ctx context.Context) (summaryResult, error) {
+		maxPrice, maxVolume, ok, err := c.apiRepository.QuoteSummary(ctx, ticker, startDate)
+		return summaryResult{maxPrice: maxPrice, maxVolume: maxVolume, ok: ok}, err
+	})
+	return res.maxPrice, res.maxVolume, res.ok, err
+}
+
+// QuoteSummaries caches the summaries of a set of tickers as a whole, in
+// whatever order or case they are given. The map returned is shared between
+// callers, which must not modify it.
+func (c *cachedRepo) QuoteSummaries(ctx context.Context, tickers []string, startDate time.Time) (map[string]repository.Summary, error) {
+	set := make([]string, len(tickers))
+	for i, t := range tickers {
+		set[i] = strings.ToUpper(t)
+	}
+	slices.Sort(set)
+	set = slices.Compact(set)
+	return c.batches.Get(ctx, strings.Join(set, ",")+"|"+startKey(startDate), func(ctx context.Context) (map[string]repository.Summary, error) {
+		return c.apiRepository.QuoteSummaries(ctx, set, startDate)
+	})
+}
+
+// invalidate purges the caches once day is ingested, or when notifications
+// may have been missed, which day is empty for.
+func (c *cachedRepo) invalidate(day string) {
+	c.summaries.Purge()
+	c.batches.Purge()
+	if day == "" {
+		log.Info().Msg("reconnected to ingest notifications, query cache purged")
+		return
+	}
+	log.Info().Str("day", day).Msg("session ingested, query cache purged")
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCachedRepoSummary(t *testing.T) {
+	fake := newFakeRepo()
+	c := newCachedRepo(fake, 16, time.Minute)
+	ctx := context.Background()
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	c.QuoteSummary(ctx, "PETR4", start)
+	maxPrice, maxVolume, ok, err := c.QuoteSummary(ctx, "petr4", start)
+	if err != nil || !ok || maxPrice != 10.5 || maxVolume != 1000 {
+		t.Fatalf("unexpected cached summary %v %v %v %v", maxPrice, maxVolume, ok, err)
+	}
+	if fake.stubSummaryRepo.calls != 1 {
+		t.Fatalf("expected normalized parameters to hit the cache, queried %d times", fake.stubSummaryRepo.calls)
+	}
+
+	c.QuoteSummary(ctx, "PETR4", time.Time{})
+	if fake.stubSummaryRepo.calls != 2 {
+		t.Fatalf("different windows must be cached apart")
+	}
+
+	fake.stubSummaryRepo.maxPrice = 11
+	c.invalidate("2024-05-10")
+	if maxPrice, _, _, _ := c.QuoteSummary(ctx, "PETR4", start); maxPrice != 11 {
+		t.Fatalf("expected an ingested session to purge the cache, got %v", maxPrice)
+	}
+}
+
+func TestCachedRepoSummaries(t *testing.T) {
+	fake := newFakeRepo()
+	c := newCachedRepo(fake, 16, time.Minute)
+	ctx := context.Background()
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	c.QuoteSummaries(ctx, []string{"VALE3", "petr4"}, start)
+	got, err := c.QuoteSummaries(ctx, []string{"PETR4", "VALE3", "PETR4"}, start)
+	if err != nil || len(got) != 2 || got["VALE3"].MaxPrice != 61.2 {
+		t.Fatalf("unexpected cached summaries %v %v", got, err)
+	}
+	if calls := fake.stubBatchRepo.calls["summaries"]; len(calls) != 1 {
+		t.Fatalf("expected the same set of tickers to hit the cache, queried %v", calls)
+	}
+
+	c.QuoteSummaries(ctx, []string{"PETR4", "VALE3"}, time.Time{})
+	c.invalidate("2024-05-10")
+	c.QuoteSummaries(ctx, []string{"PETR4", "VALE3"}, start)
+	if calls := fake.stubBatchRepo.calls["summaries"]; len(calls) != 3 {
+		t.Fatalf("expected other windows and ingested sessions to miss the cache, queried %v", calls)
+	}
+}
+
+func TestCachedRepoDoesNotCacheFailures(t *testing.T) {
+	fake := newFakeRepo()
+	fake.stubSummaryRepo.err = errors.New("connection refused")
+	c := newCachedRepo(fake, 16, time.Minute)
+
+	c.QuoteSummary(context.Background(), "PETR4", time.Time{})
+	fake.stubSummaryRepo.err = nil
+	if _, _, ok, err := c.QuoteSummary(context.Background(), "PETR4", time.Time{}); err != nil || !ok {
+		t.Fatalf("a failed query must be retried, got %v %v", ok, err)
+	}
+}
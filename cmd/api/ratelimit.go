@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"desafiocotacaob3/internal/ratelimit"
+)
+
+var errRateLimited = apiError{ID: "ERR_RATE_LIMITED", Message: "too many requests, retry after the delay in Retry-After"}
+
+// ceilSeconds rounds d up to whole seconds, as HTTP delta-seconds headers
+// require.
+func ceilSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
+
+// setRateLimitHeaders reports the state of the bucket a request was counted
+// against: its capacity, the requests left and the seconds until it is full.
+func setRateLimitHeaders(w http.ResponseWriter, d ratelimit.Decision) {
+	h := w.Header()
+	h.Set("X-RateLimit-Limit", strconv.Itoa(d.Limit))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(d.Remaining))
+	h.Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(d.Reset)))
+}
+
+// writeRateLimited answers a throttled request with 429 and when to retry.
+func writeRateLimited(w http.ResponseWriter, r *http.Request, d ratelimit.Decision) {
+	w.Header().Set("Retry-After", strconv.Itoa(max(ceilSeconds(d.RetryAfter), 1)))
+	writeError(w, r, http.StatusTooManyRequests, errRateLimited)
+}
+
+// clientLimiter throttles each client of a route to the rate of the route.
+// Clients are told apart by address until their credential is verified, and
+// by principal after.
+type clientLimiter struct {
+	store    ratelimit.Store
+	rate     ratelimit.Rate
+	routes   map[string]ratelimit.Rate
+	ipHeader string
+}
+
+// newClientLimiter returns a limiter counting requests in store. Routes get
+// rate unless routes overrides it; a zero Rate disables limiting. Clients
+// are told apart by the address in ipHeader, or the peer address when it is
+// empty.
+func newClientLimiter(store ratelimit.Store, rate ratelimit.Rate, routes map[string]ratelimit.Rate, ipHeader string) *clientLimiter {
+	return &clientLimiter{store: store, rate: rate, routes: routes, ipHeader: ipHeader}
+}
+
+// origin is where a request came from: the peer address, and what the proxy
+// in front put in ipHeader.
+type origin struct {
+	addr      string
+	forwarded string
+}
+
+// originOf is the origin of r.
+func (l *clientLimiter) originOf(r *http.Request) origin {
+	o := origin{addr: r.RemoteAddr}
+	if l.ipHeader != "" {
+		o.forwarded = r.Header.Get(l.ipHeader)
+	}
+	return o
+}
+
+// client identifies the client at o by its address, for requests without a
+// verified credential. IPv6 clients are grouped by /64, the smallest prefix
+// usually delegated to a single site.
+func (l *clientLimiter) client(o origin) string {
+	addr := o.addr
+	if o.forwarded != "" {
+		// Proxies append the address they saw, which is the last one a
+		// client cannot forge.
+		addr = strings.TrimSpace(o.forwarded[strings.LastIndex(o.forwarded, ",")+1:])
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return "ip:" + addr
+	}
+	if ip.To4() == nil {
+		ip = ip.Mask(net.CIDRMask(64, 128))
+	}
+	return "ip:" + ip.String()
+}
+
+// rateOf is the rate of the route at path.
+func (l *clientLimiter) rateOf(path string) ratelimit.Rate {
+	if rate, ok := l.routes[path]; ok {
+		return rate
+	}
+	return l.rate
+}
+
+// peek reports whether the client at o may still call route, before its
+// credential is checked, without counting the request. It returns the
+// client's bucket, or nil when the route is not limited; a throttled request
+// is a *denial.
+func (l *clientLimiter) peek(ctx context.Context, route string, o origin) (*ratelimit.Decision, error) {
+	return l.count(ctx, route, l.client(o), l.store.Peek)
+}
+
+// take counts a request to route against the bucket of client, the address
+// of the client or the principal its credential was verified as. It returns
+// the bucket, or nil when the route is not limited. A throttled request is a
+// *denial.
+func (l *clientLimiter) take(ctx context.Context, route, client string) (*ratelimit.Decision, error) {
+	return l.count(ctx, route, client, l.store.Take)
+}
+
+// count decides a request to route from client with decide. Should the store
+// fail, requests are let through rather than failing the API with it.
+func (l *clientLimiter) count(ctx context.Context, route, client string, decide func(context.Context, string, ratelimit.Rate) (ratelimit.Decision, error)) (*ratelimit.Decision, error) {
+	rate := l.rateOf(route)
+	if rate.Limit <= 0 {
+		return nil, nil
+	}
+	d, err := decide(ctx, route+" "+client, rate)
+	switch {
+	case err != nil:
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("rate limit store failed, request not limited")
+		return nil, nil
+	case !d.Allowed:
+		return &d, &denial{status: http.StatusTooManyRequests, apiErr: errRateLimited, limited: &d}
+	}
+	return &d, nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"desafiocotacaob3/internal/auth"
+	"desafiocotacaob3/internal/ratelimit"
+	"desafiocotacaob3/internal/repository"
+)
+
+// stubRateBackend takes every token, or fails with err.
+type stubRateBackend struct {
+	err error
+}
+
+func (s *stubRateBackend) TakeToken(ctx context.Context, key string, interval, capacity time.Duration) (time.Time, time.Time, bool, error) {
+	now := time.Now()
+	return now, now.Add(interval), s.err == nil, s.err
+}
+
+func (s *stubRateBackend) PeekToken(ctx context.Context, key string) (time.Time, time.Time, error) {
+	now := time.Now()
+	return now, now, s.err
+}
+
+func (s *stubRateBackend) SweepTokens(ctx context.Context) error {
+	return s.err
+}
+
+func limitedGet(h http.Handler, remoteAddr string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/quotes/summary?ticker=PETR4", nil)
+	req.RemoteAddr = remoteAddr
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestClientLimiterThrottlesPerClient(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	l := newClientLimiter(ratelimit.NewLimiter(), ratelimit.PerMinute(60, 2), nil, "")
+	h := guarded(nil, l, "/quotes/summary", ok)
+
+	for i := 0; i < 2; i++ {
+		if rec := limitedGet(h, "203.0.113.7:5000", nil); rec.Code != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d", i, rec.Code)
+		}
+	}
+	rec := limitedGet(h, "203.0.113.7:5001", nil)
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "1" || rec.Header().Get("X-RateLimit-Remaining") != "0" {
+		t.Fatalf("expected 429 with Retry-After, got %d %v", rec.Code, rec.Header())
+	}
+	if _, e := authGet(t, h, ""); e.ID != "" {
+		t.Fatalf("httptest's default client must have its own bucket, got %s", e.ID)
+	}
+	if rec := limitedGet(h, "203.0.113.8:5000", nil); rec.Code != http.StatusOK {
+		t.Fatalf("other clients must not be throttled, got %d", rec.Code)
+	}
+	if rec := limitedGet(guarded(nil, l, "/quotes/trades", ok), "203.0.113.7:5000", nil); rec.Code != http.StatusOK {
+		t.Fatalf("routes must have their own buckets, got %d", rec.Code)
+	}
+}
+
+func TestClientLimiterRouteRates(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	l := newClientLimiter(ratelimit.NewLimiter(), ratelimit.Rate{}, map[string]ratelimit.Rate{"/quotes/summary": ratelimit.PerMinute(60, 1)}, "")
+
+	if rec := limitedGet(guarded(nil, l, "/quotes/trades", ok), "203.0.113.7:5000", nil); rec.Header().Get("X-RateLimit-Limit") != "" {
+		t.Fatalf("a zero default rate must disable limiting")
+	}
+	h := guarded(nil, l, "/quotes/summary", ok)
+	limitedGet(h, "203.0.113.7:5000", nil)
+	if rec := limitedGet(h, "203.0.113.7:5000", nil); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the route rate to apply, got %d", rec.Code)
+	}
+}
+
+func TestClientLimiterIdentifiesClients(t *testing.T) {
+	l := newClientLimiter(nil, ratelimit.Rate{}, nil, "X-Forwarded-For")
+	tests := []struct {
+		remote string
+		header string
+		want   string
+	}{
+		{"10.0.0.1:4000", "", "ip:10.0.0.1"},
+		{"10.0.0.1:4000", "198.51.100.1, 203.0.113.7", "ip:203.0.113.7"},
+		{"[2001:db8:1:2:3:4:5:6]:4000", "", "ip:2001:db8:1:2::"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tt.remote
+		if tt.header != "" {
+			req.Header.Set("X-Forwarded-For", tt.header)
+		}
+		if got := l.client(l.originOf(req)); got != tt.want {
+			t.Fatalf("%s %q: got %s, want %s", tt.remote, tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestClientLimiterKeepsKeyQuotaHeaders(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	l := newClientLimiter(ratelimit.NewLimiter(), ratelimit.PerMinute(600, 100), nil, "")
+	h := guarded(newAuthenticator(newStubKeyRepo(testKeys), nil, false, ratelimit.NewLimiter()), l, "/quotes/summary", ok)
+	if rec, _ := authGet(t, h, "qk_reader_secret"); rec.Header().Get("X-RateLimit-Limit") != "2" {
+		t.Fatalf("expected the key quota to be reported, got %v", rec.Header())
+	}
+}
+
+func TestClientLimiterRunsBeforeAuthentication(t *testing.T) {
+	keys := newStubKeyRepo(testKeys)
+	l := newClientLimiter(ratelimit.NewLimiter(), ratelimit.PerMinute(60, 2), nil, "")
+	h := guarded(newAuthenticator(keys, nil, true, ratelimit.NewLimiter()), l, "/quotes/summary", http.NotFoundHandler())
+	for i, key := range []string{"qk_forged1_secret", "qk_forged2_secret", "qk_forged3_secret"} {
+		rec := limitedGet(h, "203.0.113.7:5000", http.Header{http.CanonicalHeaderKey(apiKeyHeader): {key}})
+		if want := []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests}[i]; rec.Code != want {
+			t.Fatalf("request %d: expected %d, got %d", i, want, rec.Code)
+		}
+	}
+	if keys.lookups != 2 {
+		t.Fatalf("expected throttled requests not to look their key up, got %d lookups", keys.lookups)
+	}
+}
+
+func TestClientLimiterCountsVerifiedPrincipals(t *testing.T) {
+	keys := newStubKeyRepo(map[string]repository.APIKey{
+		"qk_risk_secret":  {Prefix: "qk_risk", Scopes: []string{auth.ReadQuotes}, RatePerMinute: 600, Burst: 100},
+		"qk_desk_secret":  {Prefix: "qk_desk", Scopes: []string{auth.ReadQuotes}, RatePerMinute: 600, Burst: 100},
+		"qk_audit_secret": {Prefix: "qk_audit", Scopes: []string{auth.ReadQuotes}, RatePerMinute: 600, Burst: 100},
+	})
+	l := newClientLimiter(ratelimit.NewLimiter(), ratelimit.PerMinute(60, 1), nil, "")
+	h := guarded(newAuthenticator(keys, nil, false, ratelimit.NewLimiter()), l, "/quotes/summary", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	get := func(remote, key string) int {
+		header := http.Header{}
+		if key != "" {
+			header.Set(apiKeyHeader, key)
+		}
+		return limitedGet(h, remote, header).Code
+	}
+
+	if get("203.0.113.7:5000", "qk_risk_secret") != http.StatusOK || get("203.0.113.7:5000", "qk_desk_secret") != http.StatusOK {
+		t.Fatalf("keys behind one address must have their own buckets")
+	}
+	if code := get("198.51.100.1:5000", "qk_risk_secret"); code != http.StatusTooManyRequests {
+		t.Fatalf("a key must have one bucket whatever its address, got %d", code)
+	}
+	if code := get("203.0.113.7:5000", ""); code != http.StatusOK {
+		t.Fatalf("requests with a key must not be counted against the address, got %d", code)
+	}
+	if code := get("203.0.113.7:5000", "qk_audit_secret"); code != http.StatusTooManyRequests {
+		t.Fatalf("an exhausted address must be throttled before its credential is checked, got %d", code)
+	}
+}
+
+// stubQuotaStore counts the buckets taken from.
+type stubQuotaStore struct {
+	keys []string
+}
+
+func (s *stubQuotaStore) Take(ctx context.Context, key string, rate ratelimit.Rate) (ratelimit.Decision, error) {
+	s.keys = append(s.keys, key)
+	return ratelimit.Decision{Allowed: true, Limit: rate.Burst}, nil
+}
+
+func (s *stubQuotaStore) Peek(ctx context.Context, key string, rate ratelimit.Rate) (ratelimit.Decision, error) {
+	return ratelimit.Decision{Allowed: true, Limit: rate.Burst}, nil
+}
+
+func TestKeyQuotasUseTheConfiguredStore(t *testing.T) {
+	store := &stubQuotaStore{}
+	h := guarded(newAuthenticator(newStubKeyRepo(testKeys), nil, false, store), nil, "/quotes/summary", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	authGet(t, h, "qk_reader_secret")
+	if len(store.keys) != 1 || store.keys[0] != "key:qk_reader" {
+		t.Fatalf("expected the key quota to be taken from the store, got %v", store.keys)
+	}
+}
+
+func TestClientLimiterFailsOpen(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	store := ratelimit.NewShared(&stubRateBackend{err: errors.New("connection refused")})
+	h := guarded(nil, newClientLimiter(store, ratelimit.PerMinute(60, 1), nil, ""), "/quotes/summary", ok)
+	for i := 0; i < 3; i++ {
+		if rec := limitedGet(h, "203.0.113.7:5000", nil); rec.Code != http.StatusOK {
+			t.Fatalf("expected requests through while the store is down, got %d", rec.Code)
+		}
+	}
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog"
+
+	"desafiocotacaob3/internal/export"
+	"desafiocotacaob3/internal/repository"
+)
+
+const (
+	// replayPage is how many trades a replay reads ahead.
+	replayPage = 1000
+	// replayMaxSpeed bounds the speed multiplier; faster replays use max.
+	replayMaxSpeed = 1000
+	// replayWriteWait bounds every write to a replay connection.
+	replayWriteWait = 10 * time.Second
+	// replayPongWait is how long a replay connection may stay silent; it is
+	// pinged often enough to answer within it.
+	replayPongWait  = time.Minute
+	replayPingEvery = replayPongWait * 9 / 10
+	// replayReadLimit bounds the size of client commands.
+	replayReadLimit = 4096
+)
+
+var errInvalidSpeed = apiError{ID: "ERR_INVALID_SPEED", Message: "speed must be max or a multiplier up to 1000x, e.g. 1x or 10x"}
+
+type tradeReplayRepo interface {
+	latestSessionRepo
+	Sessions(ctx context.Context, from, to time.Time) ([]time.Time, error)
+	SessionTrades(ctx context.Context, day time.Time, tickers []string, after time.Time, afterID string, limit int) ([]repository.Trade, error)
+}
+
+// upgrader rejects browser connections from other origins, which would
+// otherwise ride on the user's credentials.
+var upgrader = websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 4096}
+
+// replayCommand is a message from the client, changing its subscription.
+type replayCommand struct {
+	Type    string   `json:"type"`
+	Tickers []string `json:"tickers"`
+}
+
+// replayStatus acknowledges a connection or a command with the replay's
+// parameters and current subscription.
+type replayStatus struct {
+	Type    string   `json:"type"`
+	Date    string   `json:"date"`
+	Speed   string   `json:"speed"`
+	Tickers []string `json:"tickers"`
+}
+
+type replayTrade struct {
+	Type string `json:"type"`
+	export.TradeRecord
+}
+
+// replayEnd is sent once the subscribed tickers have no trades left, before
+// the connection is closed.
+type replayEnd struct {
+	Type   string `json:"type"`
+	Trades int    `json:"trades"`
+}
+
+// replayError reports a rejected command; the replay goes on.
+type replayError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// parseSpeed reads a speed multiplier such as 10x, or max, which replays as
+// fast as the client reads and is returned as 0.
+func parseSpeed(s string) (float64, bool) {
+	switch s {
+	case "":
+		return 1, true
+	case "max":
+		return 0, true
+	}
+	n, ok := strings.CutSuffix(s, "x")
+	if !ok {
+		return 0, false
+	}
+	speed, err := strconv.ParseFloat(n, 64)
+	if err != nil || !(speed > 0 && speed <= replayMaxSpeed) {
+		return 0, false
+	}
+	return speed, true
+}
+
+// replay is one client's replay of a session.
+type replay struct {
+	repo         tradeReplayRepo
+	conn         *websocket.Conn
+	day          time.Time
+	speed        float64
+	speedName    string
+	queryTimeout time.Duration
+
+	tickers map[string]bool
+	pending []repository.Trade
+	// cursor is the trade the next page starts after.
+	cursor repository.Trade
+	// origin is the time of the first trade sent and start when it was
+	// sent: the session clock runs from there at speed.
+	origin, start time.Time
+	sent          int
+}
+
+func (p *replay) write(v any) error {
+	if err := p.conn.SetWriteDeadline(time.Now().Add(replayWriteWait)); err != nil {
+		return err
+	}
+	return p.conn.WriteJSON(v)
+}
+
+func (p *replay) close(code int, reason string) error {
+	msg := websocket.FormatCloseMessage(code, reason)
+	return p.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(replayWriteWait))
+}
+
+func (p *replay) status() replayStatus {
+	tickers := make([]string, 0, len(p.tickers))
+	for t := range p.tickers {
+		tickers = append(tickers, t)
+	}
+	slices.Sort(tickers)
+	return replayStatus{Type: "subscribed", Date: p.day.Format("2006-01-02"), Speed: p.speedName, Tickers: tickers}
+}
+
+// command applies a subscription change. Rejected commands are answered with
+// an error message; only a failure to write ends the replay.
+func (p *replay) command(msg []byte) error {
+	var cmd replayCommand
+	if err := json.Unmarshal(msg, &cmd); err != nil {
+		return p.write(replayError{Type: "error", Message: "commands must be JSON objects"})
+	}
+	switch cmd.Type {
+	case "subscribe":
+		var added []string
+		for _, t := range cmd.Tickers {
+			if t = strings.ToUpper(strings.TrimSpace(t)); t != "" && !p.tickers[t] {
+				p.tickers[t] = true
+				added = append(added, t)
+			}
+		}
+		if len(p.tickers) > maxCompareTickers {
+			for _, t := range added {
+				delete(p.tickers, t)
+			}
+			return p.write(replayError{Type: "error", Message: errTooManyTickers.Message})
+		}
+	case "unsubscribe":
+		for _, t := range cmd.Tickers {
+			delete(p.tickers, strings.ToUpper(strings.TrimSpace(t)))
+		}
+	default:
+		return p.write(replayError{Type: "error", Message: "type must be subscribe or unsubscribe"})
+	}
+	// Read ahead for the new subscription, joining the session where its
+	// clock is rather than where the old subscription's last trade was.
+	p.pending = nil
+	if p.sent > 0 && p.speed > 0 {
+		if now := p.clock(); now.After(p.cursor.Time) {
+			p.cursor = repository.Trade{Time: now}
+		}
+	}
+	return p.write(p.status())
+}
+
+// clock is the session time now.
+func (p *replay) clock() time.Time {
+	return p.origin.Add(time.Duration(float64(time.Since(p.start)) * p.speed))
+}
+
+// wait is how long until t is due.
+func (p *replay) wait(t repository.Trade) time.Duration {
+	if p.sent == 0 || p.speed == 0 {
+		return 0
+	}
+	return time.Until(p.start.Add(time.Duration(float64(t.Time.Sub(p.origin)) / p.speed)))
+}
+
+func (p *replay) fetch(ctx context.Context) error {
+	if p.queryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.queryTimeout)
+		defer cancel()
+	}
+	tickers := make([]string, 0, len(p.tickers))
+	for t := range p.tickers {
+		tickers = append(tickers, t)
+	}
+	trades, err := p.repo.SessionTrades(ctx, p.day, tickers, p.cursor.Time, p.cursor.ID, replayPage)
+	if err != nil {
+		return err
+	}
+	p.pending = trades
+	return nil
+}
+
+func (p *replay) send() error {
+	t := p.pending[0]
+	p.pending = p.pending[1:]
+	if p.sent == 0 {
+		p.origin, p.start = t.Time, time.Now()
+	}
+	if err := p.write(replayTrade{Type: "trade", TradeRecord: export.NewTradeRecord(t)}); err != nil {
+		return err
+	}
+	p.cursor = t
+	p.sent++
+	return nil
+}
+
+// errReplayOver ends a replay that did not fail.
+var errReplayOver = errors.New("replay over")
+
+// dueNow is always ready, for trades whose time has come.
+var dueNow = func() <-chan time.Time {
+	ch := make(chan time.Time)
+	close(ch)
+	return ch
+}()
+
+// run plays the session until the subscribed tickers have no trades left,
+// the client leaves or done is closed.
+func (p *replay) run(ctx context.Context, commands <-chan []byte, done <-chan struct{}) error {
+	ping := time.NewTicker(replayPingEvery)
+	defer ping.Stop()
+	for {
+		if len(p.tickers) > 0 && len(p.pending) == 0 {
+			if err := p.fetch(ctx); err != nil {
+				return err
+			}
+			if len(p.pending) == 0 {
+				if err := p.write(replayEnd{Type: "end", Trades: p.sent}); err != nil {
+					return err
+				}
+				return p.close(websocket.CloseNormalClosure, "end of session")
+			}
+		}
+
+		var timer *time.Timer
+		var due <-chan time.Time
+		if len(p.pending) > 0 {
+			if wait := p.wait(p.pending[0]); wait > 0 {
+				timer = time.NewTimer(wait)
+				due = timer.C
+			} else {
+				due = dueNow
+			}
+		}
+		err := p.next(due, commands, ping.C, done)
+		if timer != nil {
+			timer.Stop()
+		}
+		if errors.Is(err, errReplayOver) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// next handles whichever comes first of the next trade being due, a command,
+// a ping and done. Trades that are due already still give way to commands.
+func (p *replay) next(due <-chan time.Time, commands <-chan []byte, ping <-chan time.Time, done <-chan struct{}) error {
+	select {
+	case <-due:
+		return p.send()
+	case msg, ok := <-commands:
+		if !ok {
+			// The client left.
+			return errReplayOver
+		}
+		return p.command(msg)
+	case <-ping:
+		return p.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(replayWriteWait))
+	case <-done:
+		if err := p.close(websocket.CloseGoingAway, "server shutting down"); err != nil {
+			return err
+		}
+		return errReplayOver
+	}
+}
+
+// tradeReplayHandler upgrades to a WebSocket that replays the trades of a
+// past session, in time order and with their original spacing divided by the
+// speed. Clients subscribe to and unsubscribe from tickers with commands at
+// any time; the session clock starts with the first trade sent and keeps
+// running, so tickers subscribed later join the session where it is. Each
+// page of trades is bounded by queryTimeout, and the connection is closed
+// when the server shuts down.
+func tradeReplayHandler(repo tradeReplayRepo, events *quoteEvents, queryTimeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		speed, ok := parseSpeed(q.Get("speed"))
+		if !ok {
+			writeError(w, r, http.StatusBadRequest, errInvalidSpeed)
+			return
+		}
+		speedName := q.Get("speed")
+		if speedName == "" {
+			speedName = "1x"
+		}
+		var tickers []string
+		if q.Has("tickers") {
+			var apiErr *apiError
+			if tickers, apiErr = parseTickers(r); apiErr != nil {
+				writeError(w, r, http.StatusBadRequest, *apiErr)
+				return
+			}
+		}
+
+		ctx := r.Context()
+		if queryTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, queryTimeout)
+			defer cancel()
+		}
+		var day time.Time
+		if d := q.Get("date"); d != "" {
+			var err error
+			if day, err = time.Parse("2006-01-02", d); err != nil {
+				writeError(w, r, http.StatusBadRequest, errInvalidDay)
+				return
+			}
+		} else {
+			latest, ok, err := repo.LatestSession(ctx)
+			if err != nil {
+				writeFailure(w, r, err)
+				return
+			}
+			if !ok {
+				writeError(w, r, http.StatusNotFound, errNoSessionData)
+				return
+			}
+			day = latest
+		}
+		if days, err := repo.Sessions(ctx, day, day); err != nil {
+			writeFailure(w, r, err)
+			return
+		} else if len(days) == 0 {
+			writeError(w, r, http.StatusNotFound, errNoSessionData)
+			return
+		}
+
+		conn, err := upgrader.Upgrade(w, r, w.Header())
+		if err != nil {
+			// The upgrader has answered already.
+			zerolog.Ctx(r.Context()).Info().Err(err).Msg("websocket upgrade failed")
+			return
+		}
+		defer conn.Close()
+
+		p := &replay{repo: repo, conn: conn, day: day, speed: speed, speedName: speedName, queryTimeout: queryTimeout, tickers: make(map[string]bool)}
+		for _, t := range tickers {
+			p.tickers[t] = true
+		}
+		conn.SetReadLimit(replayReadLimit)
+		_ = conn.SetReadDeadline(time.Now().Add(replayPongWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(replayPongWait))
+		})
+
+		stop := make(chan struct{})
+		defer close(stop)
+		commands := make(chan []byte)
+		go func() {
+			defer close(commands)
+			for {
+				_, msg, err := conn.ReadMessage()
+				if err != nil {
+					return
+				}
+				_ = conn.SetReadDeadline(time.Now().Add(replayPongWait))
+				select {
+				case commands <- msg:
+				case <-stop:
+					return
+				}
+			}
+		}()
+
+		logger := zerolog.Ctx(r.Context())
+		err = p.write(p.status())
+		if err == nil {
+			err = p.run(r.Context(), commands, events.done())
+		}
+		if err != nil {
+			logger.Warn().Err(repository.Classify(err)).Int("trades", p.sent).Msg("trade replay aborted")
+			return
+		}
+		logger.Info().Int("trades", p.sent).Msg("trade replay finished")
+	}
+}
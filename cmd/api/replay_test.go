@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"desafiocotacaob3/internal/repository"
+)
+
+func (s *stubStreamRepo) SessionTrades(ctx context.Context, day time.Time, tickers []string, after time.Time, afterID string, limit int) ([]repository.Trade, error) {
+	var trades []repository.Trade
+	for _, t := range s.trades {
+		if !slices.Contains(tickers, t.Ticker) || t.Time.Before(after) || (t.Time.Equal(after) && t.ID <= afterID) {
+			continue
+		}
+		if len(trades) == limit {
+			break
+		}
+		trades = append(trades, t)
+	}
+	return trades, nil
+}
+
+type stubReplayRepo struct {
+	*stubHealthRepo
+	*stubSessionsRepo
+	*stubStreamRepo
+}
+
+func replayFixture(spacing time.Duration) *stubReplayRepo {
+	at := time.Date(2024, 5, 10, 10, 0, 0, 0, time.UTC)
+	return &stubReplayRepo{
+		stubHealthRepo:   &stubHealthRepo{latest: sessionDay(10), hasData: true},
+		stubSessionsRepo: &stubSessionsRepo{days: []time.Time{sessionDay(10)}},
+		stubStreamRepo: &stubStreamRepo{trades: []repository.Trade{
+			{ID: "1", Ticker: "PETR4", Time: at, Price: 38.1, Quantity: 100},
+			{ID: "2", Ticker: "VALE3", Time: at.Add(spacing), Price: 61.2, Quantity: 200},
+			{ID: "3", Ticker: "PETR4", Time: at.Add(2 * spacing), Price: 38.2, Quantity: 300},
+		}},
+	}
+}
+
+func dialReplay(t *testing.T, h http.Handler, target string) *websocket.Conn {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+target, http.Header{"Accept-Encoding": {"gzip"}})
+	if err != nil {
+		t.Fatalf("dial: %v (%v)", err, resp)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// readReplay returns the next message, as a map to check its type and fields.
+func readReplay(t *testing.T, conn *websocket.Conn) map[string]any {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var msg map[string]any
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return msg
+}
+
+func expectClose(t *testing.T, conn *websocket.Conn, code int) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, code) {
+		t.Fatalf("expected close %d, got %v", code, err)
+	}
+}
+
+func TestParseSpeed(t *testing.T) {
+	for s, want := range map[string]float64{"": 1, "1x": 1, "10x": 10, "0.5x": 0.5, "max": 0} {
+		if got, ok := parseSpeed(s); !ok || got != want {
+			t.Errorf("%q: expected %v, got %v %v", s, want, got, ok)
+		}
+	}
+	for _, s := range []string{"10", "0x", "-1x", "1001x", "NaNx", "fast"} {
+		if _, ok := parseSpeed(s); ok {
+			t.Errorf("%q: expected to be rejected", s)
+		}
+	}
+}
+
+func TestTradeReplayMaxSpeed(t *testing.T) {
+	events := newQuoteEvents(newStubEventsRepo(sessionDay(10)))
+	h := requestLogger(compress(tradeReplayHandler(replayFixture(time.Hour), events, time.Second), 0))
+	conn := dialReplay(t, h, "/stream/trades?date=2024-05-10&speed=max&tickers=petr4")
+
+	if msg := readReplay(t, conn); msg["type"] != "subscribed" || msg["speed"] != "max" || msg["date"] != "2024-05-10" {
+		t.Fatalf("expected the subscription status, got %v", msg)
+	}
+	for _, id := range []string{"1", "3"} {
+		if msg := readReplay(t, conn); msg["type"] != "trade" || msg["id"] != id || msg["ticker"] != "PETR4" {
+			t.Fatalf("expected trade %s, got %v", id, msg)
+		}
+	}
+	if msg := readReplay(t, conn); msg["type"] != "end" || msg["trades"] != 2.0 {
+		t.Fatalf("expected the end of the session, got %v", msg)
+	}
+	expectClose(t, conn, websocket.CloseNormalClosure)
+}
+
+func TestTradeReplayKeepsTiming(t *testing.T) {
+	events := newQuoteEvents(newStubEventsRepo(sessionDay(10)))
+	// Trades a second apart, replayed at 20x.
+	conn := dialReplay(t, tradeReplayHandler(replayFixture(time.Second), events, time.Second), "/stream/trades?speed=20x&tickers=PETR4,VALE3")
+	readReplay(t, conn)
+
+	readReplay(t, conn)
+	start := time.Now()
+	readReplay(t, conn)
+	readReplay(t, conn)
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Fatalf("expected two seconds of session to take 100ms, took %s", elapsed)
+	}
+}
+
+func TestTradeReplaySubscriptions(t *testing.T) {
+	events := newQuoteEvents(newStubEventsRepo(sessionDay(10)))
+	conn := dialReplay(t, tradeReplayHandler(replayFixture(time.Hour), events, time.Second), "/stream/trades?speed=max")
+	if msg := readReplay(t, conn); msg["type"] != "subscribed" || len(msg["tickers"].([]any)) != 0 {
+		t.Fatalf("expected an empty subscription, got %v", msg)
+	}
+
+	conn.WriteMessage(websocket.TextMessage, []byte("subscribe VALE3"))
+	if msg := readReplay(t, conn); msg["type"] != "error" {
+		t.Fatalf("expected malformed commands to be rejected, got %v", msg)
+	}
+	conn.WriteJSON(replayCommand{Type: "subscribe", Tickers: []string{" vale3"}})
+	if msg := readReplay(t, conn); msg["type"] != "subscribed" || msg["tickers"].([]any)[0] != "VALE3" {
+		t.Fatalf("expected VALE3 to be subscribed, got %v", msg)
+	}
+	if msg := readReplay(t, conn); msg["type"] != "trade" || msg["ticker"] != "VALE3" {
+		t.Fatalf("expected the VALE3 trade, got %v", msg)
+	}
+	if msg := readReplay(t, conn); msg["type"] != "end" {
+		t.Fatalf("expected the end of the session, got %v", msg)
+	}
+}
+
+func TestTradeReplayShutdown(t *testing.T) {
+	events := newQuoteEvents(newStubEventsRepo(sessionDay(10)))
+	conn := dialReplay(t, tradeReplayHandler(replayFixture(time.Hour), events, time.Second), "/stream/trades?tickers=PETR4")
+	readReplay(t, conn)
+	readReplay(t, conn) // the next trade is an hour away
+	events.close()
+	expectClose(t, conn, websocket.CloseGoingAway)
+}
+
+func TestTradeReplayRejectsInvalidRequests(t *testing.T) {
+	h := tradeReplayHandler(replayFixture(time.Hour), newQuoteEvents(newStubEventsRepo(sessionDay(10))), time.Second)
+	for target, status := range map[string]int{
+		"/stream/trades?speed=fast":      http.StatusBadRequest,
+		"/stream/trades?date=10/05/2024": http.StatusBadRequest,
+		"/stream/trades?tickers=":        http.StatusBadRequest,
+		"/stream/trades?date=2024-05-11": http.StatusNotFound,
+		"/stream/trades?date=2024-05-10": http.StatusBadRequest, // not a WebSocket handshake
+	} {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != status {
+			t.Errorf("%s: expected %d, got %d", target, status, rec.Code)
+		}
+	}
+}
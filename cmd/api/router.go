@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+
+	"desafiocotacaob3/internal/auth"
+	"desafiocotacaob3/internal/config"
+)
+
+// legacyPrefix is the version the unversioned paths are aliases of.
+const legacyPrefix = "/v1"
+
+// apiVersion is a set of routes mounted under a path prefix.
+type apiVersion struct {
+	prefix string
+	routes map[string]http.Handler
+}
+
+// derive starts a new version from v, replacing only the routes whose
+// response shape changes, so consumers of v keep their contract. A /v2 that
+// returns prices as decimal strings would be:
+//
+//	v1.derive("/v2", map[string]http.Handler{"/quotes/summary": quotesSummaryV2Handler(repo)})
+func (v apiVersion) derive(prefix string, overrides map[string]http.Handler) apiVersion {
+	routes := maps.Clone(v.routes)
+	maps.Copy(routes, overrides)
+	return apiVersion{prefix: prefix, routes: routes}
+}
+
+func v1Routes(repo apiRepository, cfg *config.Config, events *quoteEvents) apiVersion {
+	return apiVersion{prefix: "/v1", routes: map[string]http.Handler{
+		"/quotes/summary":        quotesSummaryHandler(repo),
+		"/quotes/analytics":      quotesAnalyticsHandler(repo, cfg.RiskFreeRate),
+		"/quotes/indicators":     quotesIndicatorsHandler(repo),
+		"/quotes/correlation":    quotesCorrelationHandler(repo),
+		"/quotes/compare":        quotesCompareHandler(repo),
+		"/quotes/trades":         quotesTradesHandler(repo),
+		"/quotes/candles":        quotesCandlesHandler(repo),
+		"/quotes/vwap":           quotesVWAPHandler(repo),
+		"/quotes/volume-profile": quotesVolumeProfileHandler(repo),
+		"/market/movers":         marketMoversHandler(repo),
+		"/stream/quotes":         quoteStreamHandler(events, cfg.QueryTimeout),
+		"/stream/trades":         tradeReplayHandler(repo, events, cfg.QueryTimeout),
+		"/graphql":               graphqlHandler(repo, cfg.GraphQLMaxComplexity),
+	}}
+}
+
+// streamingRoutes stream exports whose size is bounded by the requested range
+// rather than by the server, so they get ExportTimeout instead of QueryTimeout.
+var streamingRoutes = map[string]bool{
+	"/quotes/trades":  true,
+	"/quotes/candles": true,
+}
+
+// eventRoutes hold the connection open until the client leaves. They bound
+// their queries themselves and are never cached.
+var eventRoutes = map[string]bool{
+	"/stream/quotes": true,
+	"/stream/trades": true,
+}
+
+// unaliasedRoutes were added after versioning, so they have no unversioned
+// alias.
+var unaliasedRoutes = map[string]bool{
+	"/stream/quotes": true,
+	"/stream/trades": true,
+	"/graphql":       true,
+}
+
+// routeMethods are the methods routes serve besides GET and HEAD, which
+// every route serves.
+var routeMethods = map[string][]string{
+	"/graphql": {http.MethodPost},
+}
+
+// router is the HTTP API: a ServeMux and the patterns mounted on it, each
+// naming its method, so other methods get 405.
+type router struct {
+	*http.ServeMux
+	patterns []string
+}
+
+// newRouter mounts every API version under its prefix and keeps the
+// unversioned paths as deprecated aliases of legacyPrefix. Every route is
+// instrumented on reg, which is also exposed at /metrics. Event streams are
+// woken through events. Data endpoints are guarded by acc, and so is /metrics,
+// which needs admin:ingest.
+func newRouter(repo apiRepository, cfg *config.Config, reg *prometheus.Registry, events *quoteEvents, acc *access) *router {
+	v1 := v1Routes(repo, cfg, events)
+	metrics := newHTTPMetrics(reg)
+	for path := range cfg.RateLimitRoutes {
+		if _, ok := v1.routes[path]; !ok {
+			log.Warn().Msgf("RATE_LIMIT_ROUTES: %s is not a data route", path)
+		}
+	}
+	mux := &router{ServeMux: http.NewServeMux()}
+	mount := func(path string, h http.Handler, methods ...string) {
+		for _, method := range append([]string{http.MethodGet}, methods...) {
+			mux.Handle(method+" "+path, h)
+			mux.patterns = append(mux.patterns, method+" "+path)
+		}
+	}
+	handle := func(path string, h http.Handler, methods ...string) {
+		mount(path, metrics.instrument(path, h), methods...)
+	}
+	// data wraps the handler of a data endpoint with its rate limit,
+	// credential check, deadline and conditional request handling.
+	data := func(path string, h http.Handler) http.Handler {
+		switch {
+		case eventRoutes[path]:
+			// Bounded by the handler, never cached.
+		case streamingRoutes[path]:
+			h = withStreamDeadline(conditional(repo, cfg.CacheMaxAge, cfg.RecentCacheMaxAge, h), cfg.ExportTimeout)
+		default:
+			h = withDeadline(conditional(repo, cfg.CacheMaxAge, cfg.RecentCacheMaxAge, h), cfg.QueryTimeout)
+		}
+		return acc.guard(path, auth.ReadQuotes, h)
+	}
+	for _, v := range []apiVersion{v1} {
+		for path, h := range v.routes {
+			handle(v.prefix+path, data(path, h), routeMethods[path]...)
+		}
+	}
+	for path, h := range v1.routes {
+		if unaliasedRoutes[path] {
+			continue
+		}
+		handle(path, deprecatedAlias(data(path, h), legacyPrefix+path, cfg.LegacyDeprecation, cfg.LegacySunset), routeMethods[path]...)
+	}
+	handle("/openapi.json", http.HandlerFunc(openapiHandler))
+	handle("/docs", http.HandlerFunc(docsHandler))
+	handle("/healthz", http.HandlerFunc(healthzHandler))
+	handle("/readyz", readyzHandler(repo, cfg.ReadinessTimeout, cfg.StaleAfterDays))
+	mount("/metrics", acc.guard("/metrics", auth.AdminIngest, metricsHandler(reg)))
+	return mux
+}
+
+// deprecatedAlias serves next while announcing, per RFC 9745 and RFC 8594,
+// when the path was deprecated, when it will be removed and what replaces it.
+func deprecatedAlias(next http.Handler, successor string, deprecation, sunset time.Time) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "@"+strconv.FormatInt(deprecation.Unix(), 10))
+		w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", successor))
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"desafiocotacaob3/internal/config"
+)
+
+func TestRouterLegacyAlias(t *testing.T) {
+	cfg := &config.Config{
+		LegacyDeprecation: time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC),
+		LegacySunset:      time.Date(2027, 4, 30, 0, 0, 0, 0, time.UTC),
+	}
+	repo := newFakeRepo()
+	router := newRouter(repo, cfg, prometheus.NewRegistry(), newQuoteEvents(repo), newAccess(repo, nil, cfg))
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/quotes/summary?ticker=PETR4", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Deprecation"); got != "@1792368000" {
+		t.Fatalf("unexpected Deprecation header %q", got)
+	}
+	if got := rec.Header().Get("Sunset"); got != "Fri, 30 Apr 2027 00:00:00 GMT" {
+		t.Fatalf("unexpected Sunset header %q", got)
+	}
+	if got := rec.Header().Get("Link"); got != `</v1/quotes/summary>; rel="successor-version"` {
+		t.Fatalf("unexpected Link header %q", got)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/quotes/summary?ticker=PETR4", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	if rec.Header().Get("Deprecation") != "" || rec.Header().Get("Sunset") != "" {
+		t.Fatalf("versioned route must not be marked deprecated")
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/quotes/summary?ticker=PETR4", nil))
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "GET, HEAD" {
+		t.Fatalf("expected 405 for an undocumented method, got %d %v", rec.Code, rec.Header())
+	}
+}
+
+func TestAPIVersionDerive(t *testing.T) {
+	repo := newFakeRepo()
+	v1 := v1Routes(repo, &config.Config{}, newQuoteEvents(repo))
+	override := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	v2 := v1.derive("/v2", map[string]http.Handler{"/quotes/summary": override})
+
+	if v2.prefix != "/v2" || len(v2.routes) != len(v1.routes) {
+		t.Fatalf("unexpected derived version %s with %d routes", v2.prefix, len(v2.routes))
+	}
+	rec := httptest.NewRecorder()
+	v2.routes["/quotes/summary"].ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v2/quotes/summary", nil))
+	if rec.Code != http.StatusTeapot {
+		t.Fatalf("override not applied")
+	}
+	rec = httptest.NewRecorder()
+	v1.routes["/quotes/summary"].ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/quotes/summary?ticker=PETR4", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("deriving v2 changed v1: got %d", rec.Code)
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+
+	"desafiocotacaob3/internal/config"
+)
+
+// newServer builds the API server with the limits of cfg, so a slow or
+// malicious client cannot hold connections open indefinitely.
+func newServer(cfg *config.Config, h http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           h,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+}
+
+// withDeadline bounds the work of next, including its database queries, which
+// all run on the request context, to timeout. A query that runs out of time is
+// answered with ERR_TIMEOUT. A zero timeout leaves requests unbounded.
+func withDeadline(next http.Handler, timeout time.Duration) http.Handler {
+	if timeout <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// withStreamDeadline is withDeadline for handlers that stream large responses:
+// the server's write timeout is pushed back to the same deadline, since a
+// download can legitimately outlast it.
+func withStreamDeadline(next http.Handler, timeout time.Duration) http.Handler {
+	if timeout <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadline := time.Now().Add(timeout)
+		if err := http.NewResponseController(w).SetWriteDeadline(deadline); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			zerolog.Ctx(r.Context()).Warn().Err(err).Msg("failed to extend write deadline")
+		}
+		ctx, cancel := context.WithDeadline(r.Context(), deadline)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// serve runs srv on ln until ctx is canceled, then stops accepting
+// connections and waits up to drain for in-flight requests to finish. Requests
+// still running after that are cut off and reported as an error.
+func serve(ctx context.Context, srv *http.Server, ln net.Listener, drain time.Duration) error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.Serve(ln)
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Info().Msgf("shutting down, draining connections for up to %s", drain)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), drain)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		srv.Close()
+		return fmt.Errorf("drain connections: %w", err)
+	}
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// serveGRPC is serve for the gRPC API. Once ctx is canceled, RPCs in flight,
+// streams included, have up to drain to finish before they are cut off.
+func serveGRPC(ctx context.Context, srv *grpc.Server, ln net.Listener, drain time.Duration) error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.Serve(ln)
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(drain):
+		srv.Stop()
+		<-errCh
+		return errors.New("drain RPCs: still running after the shutdown timeout")
+	}
+	return <-errCh
+}
+
+// http2Preface opens every HTTP/2 connection. gRPC clients send it first
+// thing over plaintext, where HTTP/1 clients send a request line.
+const http2Preface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+// splitListener hands the connections accepted by a listener to the gRPC or
+// the HTTP server by their first bytes, so both can share a port. The HTTP
+// server does not speak HTTP/2 over plaintext, so it loses no clients to gRPC.
+type splitListener struct {
+	ln      net.Listener
+	timeout time.Duration
+	http    *connQueue
+	grpc    *connQueue
+}
+
+// splitGRPC starts accepting on ln and returns the listeners the HTTP and
+// gRPC servers are to serve. Clients that have not sent enough to tell after
+// timeout are disconnected. Closing the returned listeners leaves ln open;
+// closing ln closes them.
+func splitGRPC(ln net.Listener, timeout time.Duration) (httpLn, grpcLn net.Listener) {
+	s := &splitListener{ln: ln, timeout: timeout, http: newConnQueue(ln.Addr()), grpc: newConnQueue(ln.Addr())}
+	go s.accept()
+	return s.http, s.grpc
+}
+
+func (s *splitListener) accept() {
+	for {
+		conn, err := s.ln.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			s.http.close(err)
+			s.grpc.close(err)
+			return
+		}
+		if err != nil {
+			// Out of file descriptors, most likely: back off as net/http does.
+			log.Warn().Err(err).Msg("accept failed")
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		go s.route(conn)
+	}
+}
+
+func (s *splitListener) route(conn net.Conn) {
+	if s.timeout > 0 {
+		_ = conn.SetReadDeadline(time.Now().Add(s.timeout))
+	}
+	r := bufio.NewReaderSize(conn, len(http2Preface))
+	// Stop at the first byte that differs, since HTTP/1 requests can be
+	// shorter than the preface.
+	for i := 1; i <= len(http2Preface); i++ {
+		b, err := r.Peek(i)
+		if err != nil {
+			conn.Close()
+			return
+		}
+		if b[i-1] != http2Preface[i-1] {
+			_ = conn.SetReadDeadline(time.Time{})
+			s.http.put(&peekedConn{Conn: conn, r: r})
+			return
+		}
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+	s.grpc.put(&peekedConn{Conn: conn, r: r})
+}
+
+// peekedConn is a connection whose first bytes were read into r.
+type peekedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *peekedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// connQueue is a listener accepting the connections put to it.
+type connQueue struct {
+	addr  net.Addr
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+	err   error
+}
+
+func newConnQueue(addr net.Addr) *connQueue {
+	return &connQueue{addr: addr, conns: make(chan net.Conn), done: make(chan struct{})}
+}
+
+// put hands conn to Accept, or closes it once the queue is closed.
+func (q *connQueue) put(conn net.Conn) {
+	select {
+	case q.conns <- conn:
+	case <-q.done:
+		conn.Close()
+	}
+}
+
+func (q *connQueue) Accept() (net.Conn, error) {
+	select {
+	case conn := <-q.conns:
+		return conn, nil
+	case <-q.done:
+		return nil, q.err
+	}
+}
+
+// close makes Accept fail with err from now on.
+func (q *connQueue) close(err error) {
+	q.once.Do(func() {
+		q.err = err
+		close(q.done)
+	})
+}
+
+func (q *connQueue) Close() error {
+	q.close(net.ErrClosed)
+	return nil
+}
+
+func (q *connQueue) Addr() net.Addr {
+	return q.addr
+}
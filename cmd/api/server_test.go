@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"desafiocotacaob3/internal/config"
+	"desafiocotacaob3/internal/repository"
+	quotesv1 "desafiocotacaob3/proto/quotes/v1"
+)
+
+func TestServeDrainsInFlightRequests(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		io.WriteString(w, "done")
+	})}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- serve(ctx, srv, ln, 5*time.Second) }()
+
+	body := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String())
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		body <- string(b)
+	}()
+
+	<-started
+	cancel()
+	select {
+	case err := <-served:
+		t.Fatalf("serve returned before the request finished: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+
+	if got := <-body; got != "done" {
+		t.Fatalf("in-flight request was not completed: %q", got)
+	}
+	if err := <-served; err != nil {
+		t.Fatalf("serve: %v", err)
+	}
+}
+
+func TestServeCutsOffAfterDrainTimeout(t *testing.T) {
+	started := make(chan struct{})
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+	})}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- serve(ctx, srv, ln, 50*time.Millisecond) }()
+	go http.Get("http://" + ln.Addr().String())
+
+	<-started
+	cancel()
+	if err := <-served; err == nil {
+		t.Fatalf("expected an error when requests outlive the drain timeout")
+	}
+}
+
+// blockingTradesRepo streams no trade until the query context ends.
+type blockingTradesRepo struct {
+	*fakeRepo
+	started chan struct{}
+}
+
+func (r blockingTradesRepo) StreamTrades(ctx context.Context, ticker string, from, to time.Time, fn func(repository.Trade) error) error {
+	close(r.started)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestServeGRPCCutsOffStreamsAfterDrainTimeout(t *testing.T) {
+	repo := blockingTradesRepo{fakeRepo: newFakeRepo(), started: make(chan struct{})}
+	cfg := &config.Config{}
+	srv := newGRPCServer(repo, cfg, prometheus.NewRegistry(), newAccess(repo, nil, cfg))
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- serveGRPC(ctx, srv, ln, 50*time.Millisecond) }()
+	conn, err := grpc.NewClient(ln.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	stream, err := quotesv1.NewQuotesServiceClient(conn).StreamTrades(context.Background(), &quotesv1.StreamTradesRequest{Ticker: "PETR4"})
+	if err != nil {
+		t.Fatalf("StreamTrades: %v", err)
+	}
+	go stream.Recv()
+
+	<-repo.started
+	cancel()
+	if err := <-served; err == nil {
+		t.Fatalf("expected an error when streams outlive the drain timeout")
+	}
+}
+
+func TestSplitGRPCServesShortHTTPRequests(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	httpLn, grpcLn := splitGRPC(ln, time.Second)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	})}
+	go srv.Serve(httpLn)
+	defer srv.Close()
+
+	// Shorter than the HTTP/2 preface, which it shares its first byte with.
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, "PUT / HTTP/1.0\r\n\r\n")
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the request to reach the HTTP server, got %v %v", resp, err)
+	}
+
+	ln.Close()
+	if _, err := grpcLn.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("expected closing the listener to close the gRPC side, got %v", err)
+	}
+}
+
+func TestNewServerLimits(t *testing.T) {
+	cfg := &config.Config{ReadHeaderTimeout: time.Second, ReadTimeout: 2 * time.Second, WriteTimeout: 3 * time.Second, IdleTimeout: 4 * time.Second, MaxHeaderBytes: 1024}
+	srv := newServer(cfg, http.NotFoundHandler())
+	if srv.ReadHeaderTimeout != time.Second || srv.ReadTimeout != 2*time.Second || srv.WriteTimeout != 3*time.Second || srv.IdleTimeout != 4*time.Second || srv.MaxHeaderBytes != 1024 {
+		t.Fatalf("limits not applied: %+v", srv)
+	}
+}
+
+// blockingSummaryRepo waits for the query context to expire, as a slow query
+// would.
+type blockingSummaryRepo struct{}
+
+func (blockingSummaryRepo) QuoteSummary(ctx context.Context, ticker string, startDate time.Time) (float64, int64, bool, error) {
+	<-ctx.Done()
+	return 0, 0, false, ctx.Err()
+}
+
+func TestWithDeadlineTimesOutQueries(t *testing.T) {
+	h := withDeadline(quotesSummaryHandler(blockingSummaryRepo{}), 10*time.Millisecond)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/quotes/summary?ticker=PETR4", nil))
+
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Fatalf("expected status 504, got %d", rec.Code)
+	}
+	var e apiError
+	if err := json.NewDecoder(rec.Body).Decode(&e); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if e.ID != errTimeout.ID {
+		t.Fatalf("expected error %s, got %s", errTimeout.ID, e.ID)
+	}
+}
+
+func TestWithStreamDeadlineOutlastsWriteTimeout(t *testing.T) {
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(150 * time.Millisecond)
+		io.WriteString(w, "done")
+	})
+	get := func(h http.Handler) (string, error) {
+		srv := httptest.NewUnstartedServer(requestLogger(compress(h, 0)))
+		srv.Config.WriteTimeout = 50 * time.Millisecond
+		srv.Start()
+		defer srv.Close()
+		resp, err := http.Get(srv.URL)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		return string(b), err
+	}
+	captureLog(t)
+
+	if _, err := get(slow); err == nil {
+		t.Fatalf("expected the write timeout to cut off a slow response")
+	}
+	if got, err := get(withStreamDeadline(slow, time.Second)); err != nil || got != "done" {
+		t.Fatalf("expected the stream deadline to extend the write timeout, got %q, %v", got, err)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"desafiocotacaob3/internal/repository"
+	"desafiocotacaob3/internal/util"
+)
+
+var errInvalidBucket = apiError{ID: "ERR_INVALID_BUCKET", Message: "bucket must be a finite number of at least 0.01"}
+
+// minBucket is the tick size of B3: narrower levels hold no more trades, and
+// would only let a request make Postgres group prices ever more finely.
+const minBucket = 0.01
+
+type volumeRepo interface {
+	VWAP(ctx context.Context, ticker string, day time.Time, interval time.Duration) ([]repository.VWAPPoint, error)
+	VolumeProfile(ctx context.Context, ticker string, from, to time.Time, bucket float64) ([]repository.PriceLevel, error)
+}
+
+type vwapPoint struct {
+	Time           time.Time `json:"time"`
+	VWAP           float64   `json:"vwap"`
+	CumulativeVWAP float64   `json:"cumulative_vwap"`
+	Volume         int64     `json:"volume"`
+}
+
+type vwapResponse struct {
+	Ticker   string      `json:"ticker"`
+	Date     string      `json:"date"`
+	Interval string      `json:"interval"`
+	VWAP     float64     `json:"vwap"`
+	Points   []vwapPoint `json:"points"`
+}
+
+type priceLevel struct {
+	Price  float64 `json:"price"`
+	Volume int64   `json:"volume"`
+	Trades int64   `json:"trades"`
+}
+
+type volumeProfileResponse struct {
+	Ticker         string       `json:"ticker"`
+	From           string       `json:"from"`
+	To             string       `json:"to"`
+	Bucket         float64      `json:"bucket"`
+	TotalVolume    int64        `json:"total_volume"`
+	PointOfControl float64      `json:"point_of_control"`
+	Levels         []priceLevel `json:"levels"`
+}
+
+func quotesVWAPHandler(repo volumeRepo) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		ticker := strings.ToUpper(q.Get("ticker"))
+		if ticker == "" {
+			writeError(w, r, http.StatusBadRequest, errMissingTicker)
+			return
+		}
+		day := util.BusinessDaysAgo(time.Now().UTC(), 1)
+		if ds := q.Get("date"); ds != "" {
+			var err error
+			day, err = time.Parse("2006-01-02", ds)
+			if err != nil {
+				writeError(w, r, http.StatusBadRequest, errInvalidDay)
+				return
+			}
+		}
+		intervalName := q.Get("interval")
+		if intervalName == "" {
+			intervalName = "5m"
+		}
+		interval, ok := repository.Intervals[intervalName]
+		if !ok {
+			writeError(w, r, http.StatusBadRequest, errInvalidInterval)
+			return
+		}
+
+		points, err := repo.VWAP(r.Context(), ticker, day, interval)
+		if err != nil {
+			writeFailure(w, r, err)
+			return
+		}
+		if len(points) == 0 {
+			writeError(w, r, http.StatusNotFound, errTickerNotFound)
+			return
+		}
+
+		resp := vwapResponse{
+			Ticker:   ticker,
+			Date:     day.Format("2006-01-02"),
+			Interval: intervalName,
+			VWAP:     points[len(points)-1].CumulativeVWAP,
+			Points:   make([]vwapPoint, len(points)),
+		}
+		for i, p := range points {
+			resp.Points[i] = vwapPoint(p)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func quotesVolumeProfileHandler(repo volumeRepo) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		ticker := strings.ToUpper(q.Get("ticker"))
+		if ticker == "" {
+			writeError(w, r, http.StatusBadRequest, errMissingTicker)
+			return
+		}
+		from, to, apiErr := parseDateRange(r, 7)
+		if apiErr != nil {
+			writeError(w, r, http.StatusBadRequest, *apiErr)
+			return
+		}
+		bucket := 0.05
+		if bs := q.Get("bucket"); bs != "" {
+			v, err := strconv.ParseFloat(bs, 64)
+			if err != nil || !(v >= minBucket) || math.IsInf(v, 0) {
+				writeError(w, r, http.StatusBadRequest, errInvalidBucket)
+				return
+			}
+			bucket = v
+		}
+
+		levels, err := repo.VolumeProfile(r.Context(), ticker, from, to, bucket)
+		if err != nil {
+			writeFailure(w, r, err)
+			return
+		}
+		if len(levels) == 0 {
+			writeError(w, r, http.StatusNotFound, errTickerNotFound)
+			return
+		}
+
+		resp := volumeProfileResponse{
+			Ticker: ticker,
+			From:   from.Format("2006-01-02"),
+			To:     to.Format("2006-01-02"),
+			Bucket: bucket,
+			Levels: make([]priceLevel, len(levels)),
+		}
+		var maxVolume int64 = -1
+		for i, l := range levels {
+			resp.Levels[i] = priceLevel(l)
+			resp.TotalVolume += l.Volume
+			if l.Volume > maxVolume {
+				maxVolume = l.Volume
+				resp.PointOfControl = l.Price
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
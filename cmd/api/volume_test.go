@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"desafiocotacaob3/internal/repository"
+)
+
+type stubVolumeRepo struct {
+	lastInterval time.Duration
+	lastBucket   float64
+	points       []repository.VWAPPoint
+	levels       []repository.PriceLevel
+}
+
+func (s *stubVolumeRepo) VWAP(ctx context.Context, ticker string, day time.Time, interval time.Duration) ([]repository.VWAPPoint, error) {
+	s.lastInterval = interval
+	return s.points, nil
+}
+
+func (s *stubVolumeRepo) VolumeProfile(ctx context.Context, ticker string, from, to time.Time, bucket float64) ([]repository.PriceLevel, error) {
+	s.lastBucket = bucket
+	return s.levels, nil
+}
+
+func TestQuotesVWAP(t *testing.T) {
+	repo := &stubVolumeRepo{points: []repository.VWAPPoint{
+		{Time: time.Date(2024, 5, 10, 10, 0, 0, 0, time.UTC), VWAP: 10, CumulativeVWAP: 10, Volume: 100},
+		{Time: time.Date(2024, 5, 10, 10, 15, 0, 0, time.UTC), VWAP: 12, CumulativeVWAP: 11, Volume: 100},
+	}}
+	srv := httptest.NewServer(quotesVWAPHandler(repo))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/quotes/vwap?ticker=PETR4&date=2024-05-10&interval=15m")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	var v vwapResponse
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if repo.lastInterval != 15*time.Minute {
+		t.Fatalf("unexpected interval %v", repo.lastInterval)
+	}
+	if v.VWAP != 11 || len(v.Points) != 2 {
+		t.Fatalf("unexpected vwap response %+v", v)
+	}
+}
+
+func TestQuotesVolumeProfile(t *testing.T) {
+	repo := &stubVolumeRepo{levels: []repository.PriceLevel{
+		{Price: 10.00, Volume: 300, Trades: 3},
+		{Price: 10.05, Volume: 700, Trades: 5},
+		{Price: 10.10, Volume: 200, Trades: 1},
+	}}
+	srv := httptest.NewServer(quotesVolumeProfileHandler(repo))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/quotes/volume-profile?ticker=PETR4&from=2024-05-06&to=2024-05-10&bucket=0.05")
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	var p volumeProfileResponse
+	if err := json.NewDecoder(resp.Body).Decode(&p); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if repo.lastBucket != 0.05 {
+		t.Fatalf("unexpected bucket %v", repo.lastBucket)
+	}
+	if p.TotalVolume != 1200 || p.PointOfControl != 10.05 || len(p.Levels) != 3 {
+		t.Fatalf("unexpected profile %+v", p)
+	}
+}
+
+func TestQuotesVolumeProfileInvalidBucket(t *testing.T) {
+	srv := httptest.NewServer(quotesVolumeProfileHandler(nil))
+	defer srv.Close()
+
+	for _, bucket := range []string{"-1", "0", "0.001", "1e-300", "NaN", "Inf", "1e309"} {
+		resp, err := http.Get(srv.URL + "/quotes/volume-profile?ticker=PETR4&bucket=" + bucket)
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		var e apiError
+		err = json.NewDecoder(resp.Body).Decode(&e)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest || err != nil || e.ID != errInvalidBucket.ID {
+			t.Fatalf("bucket=%s: expected 400 %s, got %d %s %v", bucket, errInvalidBucket.ID, resp.StatusCode, e.ID, err)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rs/zerolog/log"
+
+	"desafiocotacaob3/internal/auth"
+	"desafiocotacaob3/internal/config"
+	"desafiocotacaob3/internal/repository"
+)
+
+const usage = `usage:
+  apikey create -name NAME [-scopes read:quotes,admin:ingest] [-rate N] [-burst N]
+  apikey revoke PREFIX
+  apikey list`
+
+// errUsage is returned for invalid command lines, after printing usage.
+var errUsage = errors.New("invalid arguments")
+
+func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to load configuration")
+	}
+	repo, err := repository.NewPostgres(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to connect to database")
+	}
+	defer repo.Close()
+
+	if err := run(context.Background(), repo, os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		if !errors.Is(err, errUsage) {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		repo.Close()
+		os.Exit(2)
+	}
+}
+
+type keyAdmin interface {
+	CreateAPIKey(ctx context.Context, key repository.APIKey, hash []byte) (repository.APIKey, error)
+	RevokeAPIKey(ctx context.Context, prefix string) error
+	ListAPIKeys(ctx context.Context) ([]repository.APIKey, error)
+}
+
+// run executes the subcommand in args, writing results to out and usage
+// errors to errOut.
+func run(ctx context.Context, repo keyAdmin, args []string, out, errOut io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprintln(errOut, usage)
+		return errUsage
+	}
+	switch args[0] {
+	case "create":
+		return create(ctx, repo, args[1:], out, errOut)
+	case "revoke":
+		if len(args) != 2 {
+			fmt.Fprintln(errOut, usage)
+			return errUsage
+		}
+		if err := repo.RevokeAPIKey(ctx, args[1]); err != nil {
+			return fmt.Errorf("revoke %s: %w", args[1], err)
+		}
+		fmt.Fprintf(out, "revoked %s\n", args[1])
+		return nil
+	case "list":
+		return list(ctx, repo, out)
+	}
+	fmt.Fprintln(errOut, usage)
+	return errUsage
+}
+
+func create(ctx context.Context, repo keyAdmin, args []string, out, errOut io.Writer) error {
+	fs := flag.NewFlagSet("create", flag.ContinueOnError)
+	fs.SetOutput(errOut)
+	name := fs.String("name", "", "team or service the key is issued to")
+	scopesFlag := fs.String("scopes", auth.ReadQuotes, "comma-separated scopes")
+	rate := fs.Int("rate", 60, "requests per minute")
+	burst := fs.Int("burst", 60, "requests allowed in a burst")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if *name == "" || *rate <= 0 || *burst <= 0 {
+		fmt.Fprintln(errOut, "-name is required and -rate and -burst must be positive")
+		return errUsage
+	}
+	scopes, err := auth.ParseScopes(*scopesFlag)
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return errUsage
+	}
+
+	secret, prefix, hash, err := auth.GenerateKey()
+	if err != nil {
+		return err
+	}
+	key, err := repo.CreateAPIKey(ctx, repository.APIKey{Name: *name, Prefix: prefix, Scopes: scopes, RatePerMinute: *rate, Burst: *burst}, hash)
+	if err != nil {
+		return fmt.Errorf("create key: %w", err)
+	}
+	fmt.Fprintf(out, "created %s for %s with %s\n", key.Prefix, key.Name, strings.Join(key.Scopes, ","))
+	fmt.Fprintf(out, "key: %s\n", secret)
+	fmt.Fprintln(out, "store it now, it cannot be shown again")
+	return nil
+}
+
+func list(ctx context.Context, repo keyAdmin, out io.Writer) error {
+	keys, err := repo.ListAPIKeys(ctx)
+	if err != nil {
+		return fmt.Errorf("list keys: %w", err)
+	}
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PREFIX\tNAME\tSCOPES\tRATE/MIN\tBURST\tCREATED\tREVOKED")
+	for _, k := range keys {
+		revoked := "-"
+		if k.RevokedAt != nil {
+			revoked = k.RevokedAt.UTC().Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%s\t%s\n", k.Prefix, k.Name, strings.Join(k.Scopes, ","), k.RatePerMinute, k.Burst, k.CreatedAt.UTC().Format("2006-01-02 15:04"), revoked)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"desafiocotacaob3/internal/auth"
+	"desafiocotacaob3/internal/repository"
+)
+
+type stubAdmin struct {
+	keys   []repository.APIKey
+	hashes [][]byte
+}
+
+func (s *stubAdmin) CreateAPIKey(ctx context.Context, key repository.APIKey, hash []byte) (repository.APIKey, error) {
+	key.CreatedAt = time.Date(2024, 5, 10, 10, 0, 0, 0, time.UTC)
+	s.keys = append(s.keys, key)
+	s.hashes = append(s.hashes, hash)
+	return key, nil
+}
+
+func (s *stubAdmin) RevokeAPIKey(ctx context.Context, prefix string) error {
+	for i := range s.keys {
+		if s.keys[i].Prefix == prefix && s.keys[i].RevokedAt == nil {
+			now := time.Date(2024, 5, 11, 10, 0, 0, 0, time.UTC)
+			s.keys[i].RevokedAt = &now
+			return nil
+		}
+	}
+	return repository.ErrKeyNotFound
+}
+
+func (s *stubAdmin) ListAPIKeys(ctx context.Context) ([]repository.APIKey, error) {
+	return s.keys, nil
+}
+
+func TestCreateRevokeList(t *testing.T) {
+	repo := &stubAdmin{}
+	var out, errOut bytes.Buffer
+	if err := run(context.Background(), repo, []string{"create", "-name", "risk", "-scopes", "read:quotes", "-rate", "120", "-burst", "10"}, &out, &errOut); err != nil {
+		t.Fatalf("create: %v (%s)", err, errOut.String())
+	}
+	if len(repo.keys) != 1 || repo.keys[0].Name != "risk" || repo.keys[0].RatePerMinute != 120 || repo.keys[0].Burst != 10 {
+		t.Fatalf("unexpected key %+v", repo.keys)
+	}
+	var secret string
+	for _, line := range strings.Split(out.String(), "\n") {
+		if s, ok := strings.CutPrefix(line, "key: "); ok {
+			secret = s
+		}
+	}
+	if secret == "" || !bytes.Equal(auth.HashKey(secret), repo.hashes[0]) {
+		t.Fatalf("printed key does not match the stored hash:\n%s", out.String())
+	}
+
+	prefix := repo.keys[0].Prefix
+	if err := run(context.Background(), repo, []string{"revoke", prefix}, &out, &errOut); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if err := run(context.Background(), repo, []string{"revoke", prefix}, &out, &errOut); !errors.Is(err, repository.ErrKeyNotFound) {
+		t.Fatalf("expected revoking twice to fail, got %v", err)
+	}
+
+	out.Reset()
+	if err := run(context.Background(), repo, []string{"list"}, &out, &errOut); err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if !strings.Contains(out.String(), prefix) || !strings.Contains(out.String(), "2024-05-11 10:00") {
+		t.Fatalf("unexpected listing:\n%s", out.String())
+	}
+}
+
+func TestInvalidArguments(t *testing.T) {
+	for _, args := range [][]string{
+		nil,
+		{"rotate"},
+		{"revoke"},
+		{"create"},
+		{"create", "-name", "x", "-scopes", "write:quotes"},
+		{"create", "-name", "x", "-rate", "0"},
+	} {
+		var out, errOut bytes.Buffer
+		if err := run(context.Background(), &stubAdmin{}, args, &out, &errOut); !errors.Is(err, errUsage) {
+			t.Fatalf("%v: expected a usage error, got %v", args, err)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"desafiocotacaob3/internal/config"
+	"desafiocotacaob3/internal/export"
+	"desafiocotacaob3/internal/repository"
+	"desafiocotacaob3/internal/util"
+)
+
+func main() {
+	yesterday := util.BusinessDaysAgo(time.Now().UTC(), 1).Format("2006-01-02")
+	fromFlag := flag.String("from", yesterday, "first session to export (YYYY-MM-DD)")
+	toFlag := flag.String("to", yesterday, "last session to export (YYYY-MM-DD)")
+	out := flag.String("out", "export", "dataset root directory")
+	flag.Parse()
+
+	from, to, err := parseRange(*fromFlag, *toFlag)
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid date range")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to load configuration")
+	}
+
+	repo, err := repository.NewPostgres(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to connect to database")
+	}
+
+	ds, err := export.OpenDataset(*out)
+	if err != nil {
+		log.Fatal().Err(err).Msgf("failed to open dataset %s", *out)
+	}
+
+	if err := run(context.Background(), repo, ds, from, to); err != nil {
+		log.Fatal().Err(err).Msg("export failed")
+	}
+}
+
+type sessionSource interface {
+	Sessions(ctx context.Context, from, to time.Time) ([]time.Time, error)
+	StreamSession(ctx context.Context, day time.Time, fn func(repository.Trade) error) error
+}
+
+type dayWriter interface {
+	Done(day time.Time) bool
+	WriteDay(day time.Time, stream func(fn func(repository.Trade) error) error) (export.ManifestDay, error)
+}
+
+// run exports every session between from and to that is not yet in the
+// dataset manifest, stopping at the first failure so that a rerun resumes
+// from that session.
+func run(ctx context.Context, repo sessionSource, ds dayWriter, from, to time.Time) error {
+	days, err := repo.Sessions(ctx, from, to)
+	if err != nil {
+		return err
+	}
+	for _, day := range days {
+		dayStr := day.Format("2006-01-02")
+		if ds.Done(day) {
+			log.Info().Msgf("session %s already exported", dayStr)
+			continue
+		}
+		start := time.Now()
+		entry, err := ds.WriteDay(day, func(fn func(repository.Trade) error) error {
+			return repo.StreamSession(ctx, day, fn)
+		})
+		if err != nil {
+			return fmt.Errorf("export %s: %w", dayStr, err)
+		}
+		var rows int64
+		for _, f := range entry.Files {
+			rows += f.Rows
+		}
+		log.Info().Int("files", len(entry.Files)).Int64("rows", rows).Dur("elapsed", time.Since(start)).Msgf("exported session %s", dayStr)
+	}
+	return nil
+}
+
+func parseRange(fromStr, toStr string) (time.Time, time.Time, error) {
+	from, err := time.Parse("2006-01-02", fromStr)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid -from: %w", err)
+	}
+	to, err := time.Parse("2006-01-02", toStr)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid -to: %w", err)
+	}
+	if from.After(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("-from %s is after -to %s", fromStr, toStr)
+	}
+	return from, to, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"desafiocotacaob3/internal/export"
+	"desafiocotacaob3/internal/repository"
+)
+
+type stubSource struct {
+	days     []time.Time
+	failDay  time.Time
+	streamed []time.Time
+}
+
+func (s *stubSource) Sessions(ctx context.Context, from, to time.Time) ([]time.Time, error) {
+	return s.days, nil
+}
+
+func (s *stubSource) StreamSession(ctx context.Context, day time.Time, fn func(repository.Trade) error) error {
+	s.streamed = append(s.streamed, day)
+	if day.Equal(s.failDay) {
+		return errors.New("boom")
+	}
+	return fn(repository.Trade{ID: "1", Ticker: "PETR4", Time: day})
+}
+
+type stubWriter struct {
+	done    map[time.Time]bool
+	written []time.Time
+}
+
+func (w *stubWriter) Done(day time.Time) bool {
+	return w.done[day]
+}
+
+func (w *stubWriter) WriteDay(day time.Time, stream func(fn func(repository.Trade) error) error) (export.ManifestDay, error) {
+	if err := stream(func(repository.Trade) error { return nil }); err != nil {
+		return export.ManifestDay{}, err
+	}
+	w.written = append(w.written, day)
+	return export.ManifestDay{Date: day.Format("2006-01-02")}, nil
+}
+
+func day(d int) time.Time {
+	return time.Date(2024, 5, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestRunSkipsExportedSessions(t *testing.T) {
+	src := &stubSource{days: []time.Time{day(8), day(9), day(10)}}
+	w := &stubWriter{done: map[time.Time]bool{day(8): true}}
+	if err := run(context.Background(), src, w, day(8), day(10)); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if len(w.written) != 2 || !w.written[0].Equal(day(9)) {
+		t.Fatalf("unexpected sessions written %v", w.written)
+	}
+}
+
+func TestRunStopsAtFirstFailure(t *testing.T) {
+	src := &stubSource{days: []time.Time{day(8), day(9), day(10)}, failDay: day(9)}
+	w := &stubWriter{}
+	if err := run(context.Background(), src, w, day(8), day(10)); err == nil {
+		t.Fatalf("expected error")
+	}
+	if len(src.streamed) != 2 || len(w.written) != 1 {
+		t.Fatalf("expected export to stop at the failing session, streamed %v", src.streamed)
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	if _, _, err := parseRange("2024-05-10", "2024-05-01"); err == nil {
+		t.Fatalf("expected inverted range to fail")
+	}
+	from, to, err := parseRange("2024-05-01", "2024-05-10")
+	if err != nil || !from.Equal(day(1)) || !to.Equal(day(10)) {
+		t.Fatalf("unexpected range %v %v %v", from, to, err)
+	}
+}
@@ -9,7 +9,10 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/rs/zerolog/log"
@@ -18,6 +21,15 @@ import (
 	"desafiocotacaob3/internal/repository"
 )
 
+// Exit statuses of ingest.
+const (
+	// exitOK is returned when ingest was stopped between days.
+	exitOK = 0
+	// exitAborted (EX_TEMPFAIL) is returned when stopping interrupted a day.
+	// Its trades were rolled back and it is loaded again on the next start.
+	exitAborted = 75
+)
+
 func main() {
 	cfg, err := config.Load()
 	if err != nil {
@@ -29,29 +41,62 @@ func main() {
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to connect to database")
 	}
+	exportMetrics(cfg.IngestMetricsAddr, repo.Collectors()...)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	status := ingestLoop(ctx, repo, 24*time.Hour, cfg.IngestMetricsTextfile)
+	stop()
+	repo.Close()
+	os.Exit(status)
+}
 
-	ctx := context.Background()
+// ingestLoop loads the last business days now and then every interval until
+// ctx is canceled, returning the exit status of the process.
+func ingestLoop(ctx context.Context, repo inserter, interval time.Duration, textfile string) int {
 	processed := make(map[string]struct{})
-	run := func() {
+	// run reports whether ctx interrupted a day.
+	run := func() bool {
+		defer writeTextfile(textfile)
 		days := prevBusinessDays(7, time.Now())
 		for _, day := range days {
+			if ctx.Err() != nil {
+				return false
+			}
 			dayStr := day.Format("2006-01-02")
 			if _, ok := processed[dayStr]; ok {
 				continue
 			}
-			if err := ingestDay(ctx, repo, day); err != nil {
+			start := time.Now()
+			err := ingestDay(ctx, repo, day)
+			metrics.observeDay(day, start, err)
+			if err != nil && ctx.Err() != nil {
+				log.Warn().Err(err).Msgf("ingest of %s aborted, its trades were rolled back", dayStr)
+				return true
+			}
+			if err != nil {
 				log.Error().Err(err).Msgf("failed to ingest %s", dayStr)
 				continue
 			}
 			processed[dayStr] = struct{}{}
 		}
+		return false
 	}
 
-	run()
-	ticker := time.NewTicker(24 * time.Hour)
+	if run() {
+		return exitAborted
+	}
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
-	for range ticker.C {
-		run()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("ingest stopped")
+			return exitOK
+		case <-ticker.C:
+			if run() {
+				return exitAborted
+			}
+		}
 	}
 }
 
@@ -78,9 +123,12 @@ func prevBusinessDays(n int, ref time.Time) []time.Time {
 
 type inserter interface {
 	DayExists(ctx context.Context, day string) (bool, error)
-	InsertBatch(ctx context.Context, day string, lines []string) error
+	InsertDay(ctx context.Context, day string, fill func(insert func(lines []string) error) error) error
 }
 
+// ingestDay loads the trades of day unless they are already stored. Each
+// attempt runs in its own transaction, so a failed or canceled attempt leaves
+// no partial day behind.
 func ingestDay(ctx context.Context, repo inserter, day time.Time) error {
 	dayStr := day.Format("2006-01-02")
 	exists, err := repo.DayExists(ctx, dayStr)
@@ -92,30 +140,40 @@ func ingestDay(ctx context.Context, repo inserter, day time.Time) error {
 		return nil
 	}
 
-	return retry(3, func() error {
+	return retry(ctx, 3, func() error {
 		linesCh, errCh, err := processDay(ctx, day)
 		if err != nil {
 			return err
 		}
-		const batchSize = 1000
-		batch := make([]string, 0, batchSize)
-		for line := range linesCh {
-			batch = append(batch, line)
-			if len(batch) >= batchSize {
-				if err := repo.InsertBatch(ctx, dayStr, batch); err != nil {
+		var rows int
+		err = repo.InsertDay(ctx, dayStr, func(insert func(lines []string) error) error {
+			const batchSize = 1000
+			batch := make([]string, 0, batchSize)
+			for line := range linesCh {
+				batch = append(batch, line)
+				if len(batch) >= batchSize {
+					if err := insert(batch); err != nil {
+						return err
+					}
+					rows += len(batch)
+					batch = batch[:0]
+				}
+			}
+			if len(batch) > 0 {
+				if err := insert(batch); err != nil {
 					return err
 				}
-				batch = batch[:0]
+				rows += len(batch)
 			}
-		}
-		if len(batch) > 0 {
-			if err := repo.InsertBatch(ctx, dayStr, batch); err != nil {
-				return err
+			return <-errCh
+		})
+		if err != nil {
+			// Unblock the reader so it does not leak when the insert failed.
+			for range linesCh {
 			}
-		}
-		if err := <-errCh; err != nil {
 			return err
 		}
+		metrics.rows.Add(float64(rows))
 		return nil
 	})
 }
@@ -123,9 +181,12 @@ func ingestDay(ctx context.Context, repo inserter, day time.Time) error {
 var b3BaseURL = "https://arquivos.b3.com.br/rapinegocios/tickercsv"
 
 func fetchDayZip(ctx context.Context, day time.Time) ([]byte, error) {
-	_ = ctx
 	url := fmt.Sprintf("%s/%s", b3BaseURL, day.Format("2006-01-02"))
-	resp, err := http.Get(url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -133,7 +194,9 @@ func fetchDayZip(ctx context.Context, day time.Time) ([]byte, error) {
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
 	}
-	return io.ReadAll(resp.Body)
+	body, err := io.ReadAll(resp.Body)
+	metrics.bytes.Add(float64(len(body)))
+	return body, err
 }
 
 func processDay(ctx context.Context, day time.Time) (<-chan string, <-chan error, error) {
@@ -195,13 +258,25 @@ func processDay(ctx context.Context, day time.Time) (<-chan string, <-chan error
 	return lines, errCh, nil
 }
 
-func retry(times int, fn func() error) error {
+// retry calls fn up to times times, a second apart, until it succeeds. It
+// gives up early when ctx is canceled.
+func retry(ctx context.Context, times int, fn func() error) error {
 	var err error
 	for i := 0; i < times; i++ {
+		if i > 0 {
+			metrics.retries.Inc()
+		}
 		if err = fn(); err == nil {
 			return nil
 		}
-		time.Sleep(time.Second)
+		if ctx.Err() != nil {
+			return err
+		}
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			return err
+		}
 	}
 	return err
 }
@@ -4,12 +4,15 @@ import (
 	"archive/zip"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
 	"testing"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func zipBytes(files map[string]string) []byte {
@@ -102,15 +105,32 @@ func TestProcessDay(t *testing.T) {
 type mockRepo struct {
 	dayExists bool
 	batches   [][]string
+	// failAfter makes the insert after that many batches fail and call
+	// onFail.
+	failAfter int
+	onFail    func()
 }
 
 func (m *mockRepo) DayExists(ctx context.Context, day string) (bool, error) {
 	return m.dayExists, nil
 }
 
-func (m *mockRepo) InsertBatch(ctx context.Context, day string, lines []string) error {
-	cp := append([]string(nil), lines...)
-	m.batches = append(m.batches, cp)
+// InsertDay only keeps the batches of a day whose fill succeeded, as the
+// transaction of the Postgres repository does.
+func (m *mockRepo) InsertDay(ctx context.Context, day string, fill func(insert func(lines []string) error) error) error {
+	var staged [][]string
+	err := fill(func(lines []string) error {
+		if m.failAfter > 0 && len(staged) == m.failAfter {
+			m.onFail()
+			return errors.New("insert failed")
+		}
+		staged = append(staged, append([]string(nil), lines...))
+		return ctx.Err()
+	})
+	if err != nil {
+		return err
+	}
+	m.batches = append(m.batches, staged...)
 	return nil
 }
 
@@ -130,11 +150,18 @@ func TestIngestDayBatches(t *testing.T) {
 	b3BaseURL = srv.URL
 	defer func() { b3BaseURL = orig }()
 
+	rowsBefore, bytesBefore := testutil.ToFloat64(metrics.rows), testutil.ToFloat64(metrics.bytes)
 	repo := &mockRepo{}
 	day := time.Date(2024, 5, 5, 0, 0, 0, 0, time.UTC)
 	if err := ingestDay(context.Background(), repo, day); err != nil {
 		t.Fatalf("ingestDay error: %v", err)
 	}
+	if got := testutil.ToFloat64(metrics.rows) - rowsBefore; got != 1001 {
+		t.Fatalf("expected 1001 rows counted, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.bytes) - bytesBefore; got != float64(len(data)) {
+		t.Fatalf("expected %d bytes counted, got %v", len(data), got)
+	}
 	if len(repo.batches) != 2 {
 		t.Fatalf("expected 2 batches, got %d", len(repo.batches))
 	}
@@ -148,3 +175,74 @@ func TestIngestDayBatches(t *testing.T) {
 		t.Fatalf("last line mismatch: %s", repo.batches[1][0])
 	}
 }
+
+func serveDay(t *testing.T, lines int) {
+	t.Helper()
+	var sb bytes.Buffer
+	sb.WriteString("DT_NEG;TICKER;PRECO;QUANTIDADE;HORA\n")
+	for i := 0; i < lines; i++ {
+		fmt.Fprintf(&sb, "2024-05-05;ABC%d;1,0;1;12:00:00\n", i)
+	}
+	data := zipBytes(map[string]string{"mock.csv": sb.String()})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+	orig := b3BaseURL
+	b3BaseURL = srv.URL
+	t.Cleanup(func() { b3BaseURL = orig })
+}
+
+func TestIngestDayFailureLeavesNoData(t *testing.T) {
+	serveDay(t, 2500)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// Cancel on failure so the day is not retried.
+	repo := &mockRepo{failAfter: 2, onFail: cancel}
+	if err := ingestDay(ctx, repo, time.Date(2024, 5, 5, 0, 0, 0, 0, time.UTC)); err == nil {
+		t.Fatalf("expected an error")
+	}
+	if len(repo.batches) != 0 {
+		t.Fatalf("expected no committed batches, got %d", len(repo.batches))
+	}
+}
+
+func TestIngestLoopAbortedDay(t *testing.T) {
+	serveDay(t, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	repo := &cancelingRepo{cancel: cancel}
+	if got := ingestLoop(ctx, repo, time.Hour, ""); got != exitAborted {
+		t.Fatalf("expected exit status %d, got %d", exitAborted, got)
+	}
+	if repo.days != 1 {
+		t.Fatalf("expected ingest to stop after the aborted day, got %d days", repo.days)
+	}
+}
+
+func TestIngestLoopStopsBetweenDays(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	repo := &mockRepo{dayExists: true}
+	done := make(chan int)
+	go func() { done <- ingestLoop(ctx, repo, time.Hour, "") }()
+	cancel()
+	if got := <-done; got != exitOK {
+		t.Fatalf("expected exit status %d, got %d", exitOK, got)
+	}
+}
+
+// cancelingRepo cancels the context while the first day is being inserted,
+// as a SIGTERM would.
+type cancelingRepo struct {
+	cancel context.CancelFunc
+	days   int
+}
+
+func (c *cancelingRepo) DayExists(ctx context.Context, day string) (bool, error) {
+	return false, nil
+}
+
+func (c *cancelingRepo) InsertDay(ctx context.Context, day string, fill func(insert func(lines []string) error) error) error {
+	c.days++
+	c.cancel()
+	return fill(func(lines []string) error { return ctx.Err() })
+}
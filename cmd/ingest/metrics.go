@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog/log"
+)
+
+// ingestMetrics tracks the progress of the ingest loop.
+type ingestMetrics struct {
+	rows        prometheus.Counter
+	bytes       prometheus.Counter
+	retries     prometheus.Counter
+	dayDuration *prometheus.HistogramVec
+	lastSuccess prometheus.Gauge
+	lastDay     time.Time
+}
+
+func newIngestMetrics(reg prometheus.Registerer) *ingestMetrics {
+	m := &ingestMetrics{
+		rows: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "quotes",
+			Subsystem: "ingest",
+			Name:      "rows_total",
+			Help:      "Trades written to the database.",
+		}),
+		bytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "quotes",
+			Subsystem: "ingest",
+			Name:      "downloaded_bytes_total",
+			Help:      "Bytes of B3 trade files downloaded, including failed attempts.",
+		}),
+		retries: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "quotes",
+			Subsystem: "ingest",
+			Name:      "retries_total",
+			Help:      "Attempts at ingesting a day beyond the first.",
+		}),
+		dayDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "quotes",
+			Subsystem: "ingest",
+			Name:      "day_duration_seconds",
+			Help:      "Time to ingest a day, by result.",
+			Buckets:   []float64{1, 5, 15, 30, 60, 120, 300, 600, 1200, 1800},
+		}, []string{"result"}),
+		lastSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "quotes",
+			Subsystem: "ingest",
+			Name:      "last_success_day_timestamp_seconds",
+			Help:      "Midnight UTC of the most recent day known to be ingested.",
+		}),
+	}
+	reg.MustRegister(m.rows, m.bytes, m.retries, m.dayDuration, m.lastSuccess)
+	return m
+}
+
+// observeDay records an attempt at day that started at start and ended with err.
+func (m *ingestMetrics) observeDay(day, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	m.dayDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+	if err == nil && day.After(m.lastDay) {
+		m.lastDay = day
+		m.lastSuccess.Set(float64(time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC).Unix()))
+	}
+}
+
+var (
+	registry = prometheus.NewRegistry()
+	metrics  = newIngestMetrics(registry)
+)
+
+// exportMetrics registers extra collectors and exposes registry on addr, when
+// set, for Prometheus to scrape.
+func exportMetrics(addr string, extra ...prometheus.Collector) {
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	registry.MustRegister(extra...)
+	if addr == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry}))
+	go func() {
+		log.Info().Msgf("Ingest metrics on %s/metrics", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Error().Err(err).Msg("metrics listener stopped")
+		}
+	}()
+}
+
+// writeTextfile dumps registry to path for the node_exporter textfile
+// collector. The file is replaced atomically.
+func writeTextfile(path string) {
+	if path == "" {
+		return
+	}
+	if err := prometheus.WriteToTextfile(path, registry); err != nil {
+		log.Error().Err(err).Msgf("failed to write metrics to %s", path)
+	}
+}
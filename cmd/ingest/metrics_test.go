@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRetryCountsRetries(t *testing.T) {
+	before := testutil.ToFloat64(metrics.retries)
+	calls := 0
+	err := retry(context.Background(), 3, func() error {
+		calls++
+		if calls < 2 {
+			return errors.New("transient")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("retry error: %v", err)
+	}
+	if got := testutil.ToFloat64(metrics.retries) - before; got != 1 {
+		t.Fatalf("expected 1 retry, got %v", got)
+	}
+}
+
+func TestObserveDay(t *testing.T) {
+	m := newIngestMetrics(prometheus.NewRegistry())
+	may6 := time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC)
+	may7 := time.Date(2024, 5, 7, 0, 0, 0, 0, time.UTC)
+
+	m.observeDay(may7, time.Now(), nil)
+	m.observeDay(may6, time.Now(), nil)
+	m.observeDay(may7.AddDate(0, 0, 1), time.Now(), errors.New("boom"))
+
+	if got := testutil.ToFloat64(m.lastSuccess); got != float64(may7.Unix()) {
+		t.Fatalf("last success must be the latest ingested day, got %v", got)
+	}
+	if n := testutil.CollectAndCount(m.dayDuration); n != 2 {
+		t.Fatalf("expected success and failure series, got %d", n)
+	}
+}
+
+func TestWriteTextfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ingest.prom")
+	metrics.rows.Add(0)
+	writeTextfile(path)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read textfile: %v", err)
+	}
+	if !strings.Contains(string(b), "quotes_ingest_rows_total") {
+		t.Fatalf("unexpected textfile:\n%s", b)
+	}
+}
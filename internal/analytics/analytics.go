@@ -0,0 +1,105 @@
+package analytics
+
+import (
+	"math"
+	"time"
+)
+
+// TradingDaysPerYear is the number of B3 sessions used to annualize daily statistics.
+const TradingDaysPerYear = 252
+
+// Point is a closing price observed on a given session.
+type Point struct {
+	Date  time.Time
+	Close float64
+}
+
+// Return is the log return between a session and the previous one.
+type Return struct {
+	Date  time.Time
+	Value float64
+}
+
+// Drawdown is the largest peak-to-trough decline of a series, expressed as a
+// negative fraction of the peak.
+type Drawdown struct {
+	Value  float64
+	Peak   time.Time
+	Trough time.Time
+}
+
+// LogReturns returns ln(close[i]/close[i-1]) for every consecutive pair of points.
+// Points with a non-positive close are skipped.
+func LogReturns(series []Point) []Return {
+	returns := make([]Return, 0, len(series))
+	var prev float64
+	for _, p := range series {
+		if p.Close <= 0 {
+			continue
+		}
+		if prev > 0 {
+			returns = append(returns, Return{Date: p.Date, Value: math.Log(p.Close / prev)})
+		}
+		prev = p.Close
+	}
+	return returns
+}
+
+// AnnualizedVolatility is the sample standard deviation of daily returns scaled
+// by the square root of TradingDaysPerYear. It is zero for fewer than two returns.
+func AnnualizedVolatility(returns []Return) float64 {
+	return stddev(returns) * math.Sqrt(TradingDaysPerYear)
+}
+
+// MaxDrawdown finds the largest decline from a running peak to a later trough.
+// The zero Drawdown is returned when the series never falls below a previous peak.
+func MaxDrawdown(series []Point) Drawdown {
+	var dd Drawdown
+	var peak Point
+	for i, p := range series {
+		if i == 0 || p.Close > peak.Close {
+			peak = p
+			continue
+		}
+		if peak.Close <= 0 {
+			continue
+		}
+		if v := p.Close/peak.Close - 1; v < dd.Value {
+			dd = Drawdown{Value: v, Peak: peak.Date, Trough: p.Date}
+		}
+	}
+	return dd
+}
+
+// SharpeRatio is the annualized excess return over riskFree (an annual rate)
+// divided by the annualized volatility. It is zero when volatility is zero.
+func SharpeRatio(returns []Return, riskFree float64) float64 {
+	vol := AnnualizedVolatility(returns)
+	if vol == 0 {
+		return 0
+	}
+	return (mean(returns)*TradingDaysPerYear - riskFree) / vol
+}
+
+func mean(returns []Return) float64 {
+	if len(returns) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, r := range returns {
+		sum += r.Value
+	}
+	return sum / float64(len(returns))
+}
+
+func stddev(returns []Return) float64 {
+	if len(returns) < 2 {
+		return 0
+	}
+	m := mean(returns)
+	var sq float64
+	for _, r := range returns {
+		sq += (r.Value - m) * (r.Value - m)
+	}
+	return math.Sqrt(sq / float64(len(returns)-1))
+}
@@ -0,0 +1,73 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func day(d int) time.Time {
+	return time.Date(2024, 5, d, 0, 0, 0, 0, time.UTC)
+}
+
+func series(closes ...float64) []Point {
+	points := make([]Point, len(closes))
+	for i, c := range closes {
+		points[i] = Point{Date: day(i + 1), Close: c}
+	}
+	return points
+}
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestLogReturns(t *testing.T) {
+	got := LogReturns(series(100, 110, 99, 121))
+	want := []float64{0.09531017980432493, -0.10536051565782628, 0.20067069546215124}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d returns, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if !almostEqual(got[i].Value, want[i]) {
+			t.Fatalf("return %d = %v, want %v", i, got[i].Value, want[i])
+		}
+		if !got[i].Date.Equal(day(i + 2)) {
+			t.Fatalf("return %d dated %v, want %v", i, got[i].Date, day(i+2))
+		}
+	}
+}
+
+func TestAnnualizedVolatility(t *testing.T) {
+	got := AnnualizedVolatility(LogReturns(series(100, 110, 99, 121)))
+	if !almostEqual(got, 2.4680024463466976) {
+		t.Fatalf("unexpected volatility %v", got)
+	}
+	if v := AnnualizedVolatility(LogReturns(series(100, 110))); v != 0 {
+		t.Fatalf("expected zero volatility for a single return, got %v", v)
+	}
+}
+
+func TestMaxDrawdown(t *testing.T) {
+	got := MaxDrawdown(series(100, 110, 99, 121, 96.8, 130))
+	if !almostEqual(got.Value, -0.2) {
+		t.Fatalf("unexpected drawdown %v", got.Value)
+	}
+	if !got.Peak.Equal(day(4)) || !got.Trough.Equal(day(5)) {
+		t.Fatalf("unexpected peak/trough %v/%v", got.Peak, got.Trough)
+	}
+
+	if dd := MaxDrawdown(series(1, 2, 3)); dd != (Drawdown{}) {
+		t.Fatalf("expected no drawdown for a rising series, got %+v", dd)
+	}
+}
+
+func TestSharpeRatio(t *testing.T) {
+	got := SharpeRatio(LogReturns(series(100, 110, 99, 121)), 0.1)
+	if !almostEqual(got, 6.44736403348415) {
+		t.Fatalf("unexpected sharpe %v", got)
+	}
+	if s := SharpeRatio(LogReturns(series(10, 10, 10)), 0.1); s != 0 {
+		t.Fatalf("expected zero sharpe for a flat series, got %v", s)
+	}
+}
@@ -0,0 +1,110 @@
+package analytics
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Align places several series on the union of their dates, in ascending order.
+// closes[i][j] is the close of series i on dates[j], or NaN when that series
+// has no session on that date.
+func Align(series [][]Point) (dates []time.Time, closes [][]float64) {
+	seen := make(map[time.Time]struct{})
+	for _, s := range series {
+		for _, p := range s {
+			seen[p.Date] = struct{}{}
+		}
+	}
+	dates = make([]time.Time, 0, len(seen))
+	for d := range seen {
+		dates = append(dates, d)
+	}
+	sort.Slice(dates, func(i, j int) bool { return dates[i].Before(dates[j]) })
+
+	index := make(map[time.Time]int, len(dates))
+	for i, d := range dates {
+		index[d] = i
+	}
+	closes = make([][]float64, len(series))
+	for i, s := range series {
+		closes[i] = nanSlice(len(dates))
+		for _, p := range s {
+			closes[i][index[p.Date]] = p.Close
+		}
+	}
+	return dates, closes
+}
+
+// AlignedLogReturns returns the log return for each aligned date. A return is
+// only defined when the series has a positive close on both that date and the
+// previous aligned date; otherwise it is NaN, so a gap is never silently
+// folded into a multi-day return.
+func AlignedLogReturns(closes []float64) []float64 {
+	returns := nanSlice(len(closes))
+	for i := 1; i < len(closes); i++ {
+		if closes[i] > 0 && closes[i-1] > 0 {
+			returns[i] = math.Log(closes[i] / closes[i-1])
+		}
+	}
+	return returns
+}
+
+// Correlation is the Pearson correlation of a and b over the indices where
+// both are defined, and the number of such observations. It is NaN when there
+// are fewer than two observations or either side has zero variance.
+func Correlation(a, b []float64) (float64, int) {
+	var xs, ys []float64
+	for i := range a {
+		if i < len(b) && !math.IsNaN(a[i]) && !math.IsNaN(b[i]) {
+			xs = append(xs, a[i])
+			ys = append(ys, b[i])
+		}
+	}
+	n := len(xs)
+	if n < 2 {
+		return math.NaN(), n
+	}
+	var mx, my float64
+	for i := range xs {
+		mx += xs[i]
+		my += ys[i]
+	}
+	mx /= float64(n)
+	my /= float64(n)
+	var cov, vx, vy float64
+	for i := range xs {
+		cov += (xs[i] - mx) * (ys[i] - my)
+		vx += (xs[i] - mx) * (xs[i] - mx)
+		vy += (ys[i] - my) * (ys[i] - my)
+	}
+	if vx == 0 || vy == 0 {
+		return math.NaN(), n
+	}
+	return cov / math.Sqrt(vx*vy), n
+}
+
+// Rebase scales closes so that the first defined value equals base. Missing
+// values stay NaN.
+func Rebase(closes []float64, base float64) []float64 {
+	out := nanSlice(len(closes))
+	var first float64
+	for i, c := range closes {
+		if math.IsNaN(c) || c <= 0 {
+			continue
+		}
+		if first == 0 {
+			first = c
+		}
+		out[i] = c / first * base
+	}
+	return out
+}
+
+func nanSlice(n int) []float64 {
+	out := make([]float64, n)
+	for i := range out {
+		out[i] = math.NaN()
+	}
+	return out
+}
@@ -0,0 +1,46 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAlignMarksMissingSessions(t *testing.T) {
+	a := []Point{{Date: day(2), Close: 10}, {Date: day(3), Close: 11}, {Date: day(6), Close: 12}}
+	b := []Point{{Date: day(2), Close: 20}, {Date: day(6), Close: 22}}
+	dates, closes := Align([][]Point{a, b})
+	if len(dates) != 3 || !dates[1].Equal(day(3)) {
+		t.Fatalf("unexpected dates %v", dates)
+	}
+	if closes[0][1] != 11 || !math.IsNaN(closes[1][1]) || closes[1][2] != 22 {
+		t.Fatalf("unexpected aligned closes %v", closes)
+	}
+
+	returns := AlignedLogReturns(closes[1])
+	if !math.IsNaN(returns[1]) || !math.IsNaN(returns[2]) {
+		t.Fatalf("expected no return across a missing session, got %v", returns)
+	}
+}
+
+func TestCorrelation(t *testing.T) {
+	a := []float64{math.NaN(), 1, 2, 3, 4}
+	b := []float64{math.NaN(), 2, 4, 6, 8}
+	c := []float64{math.NaN(), 4, 3, math.NaN(), 2}
+
+	if r, n := Correlation(a, b); !almostEqual(r, 1) || n != 4 {
+		t.Fatalf("expected perfect correlation over 4 obs, got %v over %d", r, n)
+	}
+	if r, n := Correlation(a, c); !almostEqual(r, -0.9819805060619657) || n != 3 {
+		t.Fatalf("unexpected correlation %v over %d", r, n)
+	}
+	if r, n := Correlation([]float64{1, 1, 1}, b[1:4]); !math.IsNaN(r) || n != 3 {
+		t.Fatalf("expected NaN for zero variance, got %v", r)
+	}
+}
+
+func TestRebase(t *testing.T) {
+	got := Rebase([]float64{math.NaN(), 50, math.NaN(), 75}, 100)
+	if !math.IsNaN(got[0]) || got[1] != 100 || !math.IsNaN(got[2]) || got[3] != 150 {
+		t.Fatalf("unexpected rebased series %v", got)
+	}
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestGenerateKey(t *testing.T) {
+	key, prefix, hash, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if !strings.HasPrefix(key, prefix+"_") || !strings.HasPrefix(prefix, keyPrefix) {
+		t.Fatalf("key %q does not start with prefix %q", key, prefix)
+	}
+	if !bytes.Equal(hash, HashKey(key)) {
+		t.Fatalf("hash does not match key")
+	}
+	other, _, _, _ := GenerateKey()
+	if other == key {
+		t.Fatalf("keys must be random")
+	}
+}
+
+func TestParseScopes(t *testing.T) {
+	got, err := ParseScopes("read:quotes, admin:ingest,read:quotes")
+	if err != nil || len(got) != 2 || got[0] != ReadQuotes || got[1] != AdminIngest {
+		t.Fatalf("unexpected scopes %v, %v", got, err)
+	}
+	for _, s := range []string{"", "write:quotes"} {
+		if _, err := ParseScopes(s); err == nil {
+			t.Fatalf("expected %q to be rejected", s)
+		}
+	}
+}
+
+func TestPrincipalContext(t *testing.T) {
+	if _, ok := FromContext(context.Background()); ok {
+		t.Fatalf("unexpected principal")
+	}
+	ctx := WithPrincipal(context.Background(), Principal{Subject: "qk_1", Scopes: []string{ReadQuotes}})
+	p, ok := FromContext(ctx)
+	if !ok || !p.Has(ReadQuotes) || p.Has(AdminIngest) {
+		t.Fatalf("unexpected principal %+v", p)
+	}
+}
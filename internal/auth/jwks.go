@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// minRSABits is the smallest RSA modulus accepted from a JWKS.
+const minRSABits = 2048
+
+// KeySet holds the public keys of a JWKS by key ID.
+type KeySet struct {
+	keys map[string]jwk
+}
+
+type jwk struct {
+	alg string // empty unless the JWKS pins the key to an algorithm
+	key crypto.PublicKey
+}
+
+// ParseJWKS decodes a JSON Web Key Set (RFC 7517). Keys that are not meant
+// for signatures or of an unsupported type are skipped, so a set shared with
+// encryption keys loads fine; a set without any usable key does not.
+func ParseJWKS(data []byte) (*KeySet, error) {
+	var doc struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			Alg string `json:"alg"`
+			Crv string `json:"crv"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("decode JWKS: %w", err)
+	}
+
+	set := &KeySet{keys: make(map[string]jwk)}
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		var key crypto.PublicKey
+		var err error
+		switch k.Kty {
+		case "RSA":
+			key, err = rsaKey(k.N, k.E)
+		case "EC":
+			key, err = ecKey(k.Crv, k.X, k.Y)
+		case "OKP":
+			key, err = okpKey(k.Crv, k.X)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("JWKS key %q: %w", k.Kid, err)
+		}
+		if _, dup := set.keys[k.Kid]; dup {
+			return nil, fmt.Errorf("JWKS key %q is listed twice", k.Kid)
+		}
+		set.keys[k.Kid] = jwk{alg: k.Alg, key: key}
+	}
+	if len(set.keys) == 0 {
+		return nil, fmt.Errorf("JWKS has no signing keys")
+	}
+	return set, nil
+}
+
+// LoadJWKS reads a JWKS from source, an http(s) URL or a file path.
+func LoadJWKS(ctx context.Context, source string) (*KeySet, error) {
+	if !strings.HasPrefix(source, "https://") && !strings.HasPrefix(source, "http://") {
+		data, err := os.ReadFile(source)
+		if err != nil {
+			return nil, err
+		}
+		return ParseJWKS(data)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch JWKS %s: %s", source, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(data)
+}
+
+// lookup returns the key a token signed with alg under kid must verify with.
+// A token without kid is accepted when the set holds a single key.
+func (s *KeySet) lookup(kid, alg string) (crypto.PublicKey, bool) {
+	k, ok := s.keys[kid]
+	if !ok && kid == "" && len(s.keys) == 1 {
+		for _, only := range s.keys {
+			k, ok = only, true
+		}
+	}
+	if !ok || (k.alg != "" && k.alg != alg) {
+		return nil, false
+	}
+	return k.key, true
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, fmt.Errorf("invalid base64url integer")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func rsaKey(n, e string) (crypto.PublicKey, error) {
+	modulus, err := decodeInt(n)
+	if err != nil {
+		return nil, fmt.Errorf("n: %w", err)
+	}
+	exponent, err := decodeInt(e)
+	if err != nil {
+		return nil, fmt.Errorf("e: %w", err)
+	}
+	if modulus.BitLen() < minRSABits {
+		return nil, fmt.Errorf("RSA modulus of %d bits is shorter than %d", modulus.BitLen(), minRSABits)
+	}
+	if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("unsupported RSA exponent")
+	}
+	return &rsa.PublicKey{N: modulus, E: int(exponent.Int64())}, nil
+}
+
+var curves = map[string]struct {
+	curve elliptic.Curve
+	ecdh  ecdh.Curve
+}{
+	"P-256": {elliptic.P256(), ecdh.P256()},
+	"P-384": {elliptic.P384(), ecdh.P384()},
+	"P-521": {elliptic.P521(), ecdh.P521()},
+}
+
+func ecKey(crv, x, y string) (crypto.PublicKey, error) {
+	c, ok := curves[crv]
+	if !ok {
+		return nil, fmt.Errorf("unsupported curve %q", crv)
+	}
+	xb, errX := base64.RawURLEncoding.DecodeString(x)
+	yb, errY := base64.RawURLEncoding.DecodeString(y)
+	size := (c.curve.Params().BitSize + 7) / 8
+	if errX != nil || errY != nil || len(xb) != size || len(yb) != size {
+		return nil, fmt.Errorf("invalid %s coordinates", crv)
+	}
+	// crypto/ecdh rejects points that are not on the curve.
+	if _, err := c.ecdh.NewPublicKey(append(append([]byte{4}, xb...), yb...)); err != nil {
+		return nil, fmt.Errorf("invalid %s point: %w", crv, err)
+	}
+	return &ecdsa.PublicKey{Curve: c.curve, X: new(big.Int).SetBytes(xb), Y: new(big.Int).SetBytes(yb)}, nil
+}
+
+func okpKey(crv, x string) (crypto.PublicKey, error) {
+	if crv != "Ed25519" {
+		return nil, fmt.Errorf("unsupported curve %q", crv)
+	}
+	b, err := base64.RawURLEncoding.DecodeString(x)
+	if err != nil || len(b) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid Ed25519 key")
+	}
+	return ed25519.PublicKey(b), nil
+}
@@ -0,0 +1,312 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidToken is wrapped by every error Verify returns for a token that
+// is malformed, badly signed or not valid for this API. Other errors mean
+// the keys could not be loaded.
+var ErrInvalidToken = errors.New("invalid token")
+
+// jwksRefreshInterval is the least time between two reloads of the JWKS
+// triggered by tokens signed with an unknown key, so forged key IDs cannot
+// make the API hammer the identity provider.
+const jwksRefreshInterval = time.Minute
+
+// maxNumericDate is 9999-12-31T23:59:59Z, the last NumericDate accepted.
+const maxNumericDate = 253402300799
+
+// algorithms maps the JWS algorithms accepted to the hash they sign.
+// Symmetric algorithms and "none" are deliberately absent.
+var algorithms = map[string]crypto.Hash{
+	"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+	"PS256": crypto.SHA256, "PS384": crypto.SHA384, "PS512": crypto.SHA512,
+	"ES256": crypto.SHA256, "ES384": crypto.SHA384, "ES512": crypto.SHA512,
+	"EdDSA": 0,
+}
+
+// esCurves is the curve each ECDSA algorithm is defined over.
+var esCurves = map[string]elliptic.Curve{"ES256": elliptic.P256(), "ES384": elliptic.P384(), "ES512": elliptic.P521()}
+
+// Verifier validates bearer JWTs against the keys of a JWKS.
+type Verifier struct {
+	issuer   string
+	audience string
+	leeway   time.Duration
+	load     func(ctx context.Context) (*KeySet, error)
+	now      func() time.Time
+
+	mu       sync.RWMutex
+	keys     *KeySet
+	loadedAt time.Time
+	loadErr  error
+	// reload serializes refreshes so concurrent requests share one.
+	reload sync.Mutex
+}
+
+// NewVerifier returns a Verifier accepting tokens issued by issuer for
+// audience and signed by a key of the JWKS at source, a URL or file path.
+// Expiry and not-before are checked with leeway for clock skew.
+func NewVerifier(source, issuer, audience string, leeway time.Duration) *Verifier {
+	return &Verifier{
+		issuer:   issuer,
+		audience: audience,
+		leeway:   leeway,
+		load:     func(ctx context.Context) (*KeySet, error) { return LoadJWKS(ctx, source) },
+		now:      time.Now,
+	}
+}
+
+// Refresh reloads the JWKS.
+func (v *Verifier) Refresh(ctx context.Context) error {
+	v.reload.Lock()
+	defer v.reload.Unlock()
+	return v.refresh(ctx)
+}
+
+// refresh reloads the JWKS, keeping the previous keys if that fails.
+func (v *Verifier) refresh(ctx context.Context) error {
+	keys, err := v.load(ctx)
+	if err != nil {
+		err = fmt.Errorf("load JWKS: %w", err)
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.loadedAt, v.loadErr = v.now(), err
+	if err == nil {
+		v.keys = keys
+	}
+	return err
+}
+
+// key returns the key for kid, reloading the JWKS when it is unknown since
+// the provider may have rotated its keys.
+func (v *Verifier) key(ctx context.Context, kid, alg string) (crypto.PublicKey, error) {
+	v.mu.RLock()
+	keys, loadedAt, loadErr := v.keys, v.loadedAt, v.loadErr
+	v.mu.RUnlock()
+	if keys != nil {
+		if k, ok := keys.lookup(kid, alg); ok {
+			return k, nil
+		}
+	}
+
+	if loadedAt.IsZero() || v.now().Sub(loadedAt) >= jwksRefreshInterval {
+		v.reload.Lock()
+		v.mu.RLock()
+		stale := v.loadedAt.Equal(loadedAt)
+		v.mu.RUnlock()
+		if stale {
+			_ = v.refresh(ctx)
+		}
+		v.reload.Unlock()
+
+		v.mu.RLock()
+		keys, loadErr = v.keys, v.loadErr
+		v.mu.RUnlock()
+		if keys != nil {
+			if k, ok := keys.lookup(kid, alg); ok {
+				return k, nil
+			}
+		}
+	}
+	if keys == nil {
+		return nil, loadErr
+	}
+	return nil, invalid("unknown key %q", kid)
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+// audience is the aud claim, a single string or an array of them.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	if bytes.HasPrefix(b, []byte(`"`)) {
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+		*a = audience{s}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(a))
+}
+
+type claims struct {
+	Issuer    string          `json:"iss"`
+	Subject   string          `json:"sub"`
+	Audience  audience        `json:"aud"`
+	Expires   *json.Number    `json:"exp"`
+	NotBefore *json.Number    `json:"nbf"`
+	Scope     string          `json:"scope"`
+	Scp       json.RawMessage `json:"scp"`
+}
+
+// scopes returns the known scopes granted by the OAuth 2.0 "scope" claim, a
+// space-separated string, and the "scp" claim some providers use instead, a
+// string or an array. Scopes this API does not define are ignored.
+func (c claims) scopes() []string {
+	granted := strings.Fields(c.Scope)
+	if len(c.Scp) > 0 {
+		var list []string
+		var s string
+		if json.Unmarshal(c.Scp, &list) == nil {
+			granted = append(granted, list...)
+		} else if json.Unmarshal(c.Scp, &s) == nil {
+			granted = append(granted, strings.Fields(s)...)
+		}
+	}
+	var scopes []string
+	for _, scope := range Scopes {
+		if slices.Contains(granted, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+func invalid(format string, args ...any) error {
+	return fmt.Errorf("%w: "+format, append([]any{ErrInvalidToken}, args...)...)
+}
+
+// Verify checks the signature and registered claims of token and returns the
+// principal it authenticates: its subject with the scopes it was granted.
+func (v *Verifier) Verify(ctx context.Context, token string) (Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Principal{}, invalid("not a compact JWS")
+	}
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return Principal{}, invalid("header: %v", err)
+	}
+	hash, ok := algorithms[h.Alg]
+	if !ok {
+		return Principal{}, invalid("unsupported algorithm %q", h.Alg)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Principal{}, invalid("signature: %v", err)
+	}
+	key, err := v.key(ctx, h.Kid, h.Alg)
+	if err != nil {
+		return Principal{}, err
+	}
+	if err := verifySignature(key, h.Alg, hash, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return Principal{}, err
+	}
+
+	var c claims
+	if err := decodeSegment(parts[1], &c); err != nil {
+		return Principal{}, invalid("claims: %v", err)
+	}
+	if c.Issuer != v.issuer {
+		return Principal{}, invalid("issuer %q is not trusted", c.Issuer)
+	}
+	if !slices.Contains(c.Audience, v.audience) {
+		return Principal{}, invalid("token is not issued for audience %q", v.audience)
+	}
+	now := v.now()
+	if c.Expires == nil {
+		return Principal{}, invalid("token has no expiry")
+	}
+	exp, err := numericDate(*c.Expires)
+	if err != nil {
+		return Principal{}, invalid("exp: %v", err)
+	}
+	if !now.Before(exp.Add(v.leeway)) {
+		return Principal{}, invalid("token expired at %s", exp.Format(time.RFC3339))
+	}
+	if c.NotBefore != nil {
+		nbf, err := numericDate(*c.NotBefore)
+		if err != nil {
+			return Principal{}, invalid("nbf: %v", err)
+		}
+		if now.Add(v.leeway).Before(nbf) {
+			return Principal{}, invalid("token is not valid before %s", nbf.Format(time.RFC3339))
+		}
+	}
+	if c.Subject == "" {
+		return Principal{}, invalid("token has no subject")
+	}
+	return Principal{Subject: c.Subject, Scopes: c.scopes()}, nil
+}
+
+func decodeSegment(s string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// numericDate parses a NumericDate, seconds since the epoch that may carry a
+// fraction. Dates beyond year 9999 either way are rejected.
+func numericDate(n json.Number) (time.Time, error) {
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, err
+	}
+	if math.IsNaN(f) || math.Abs(f) > maxNumericDate {
+		return time.Time{}, fmt.Errorf("%s is out of range", n)
+	}
+	sec, frac := math.Modf(f)
+	return time.Unix(int64(sec), int64(frac*float64(time.Second))), nil
+}
+
+func verifySignature(key crypto.PublicKey, alg string, hash crypto.Hash, signed, sig []byte) error {
+	var digest []byte
+	if hash != 0 {
+		h := hash.New()
+		h.Write(signed)
+		digest = h.Sum(nil)
+	}
+
+	var ok bool
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		switch alg[:2] {
+		case "RS":
+			ok = rsa.VerifyPKCS1v15(k, hash, digest, sig) == nil
+		case "PS":
+			ok = rsa.VerifyPSS(k, hash, digest, sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+		}
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if esCurves[alg] == k.Curve && len(sig) == 2*size {
+			r := new(big.Int).SetBytes(sig[:size])
+			s := new(big.Int).SetBytes(sig[size:])
+			ok = ecdsa.Verify(k, digest, r, s)
+		}
+	case ed25519.PublicKey:
+		ok = alg == "EdDSA" && ed25519.Verify(k, signed, sig)
+	}
+	if !ok {
+		return invalid("bad %s signature", alg)
+	}
+	return nil
+}
@@ -0,0 +1,262 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testIssuer   = "https://id.example.com/"
+	testAudience = "quotes-api"
+)
+
+var testNow = time.Date(2024, 5, 10, 10, 0, 0, 0, time.UTC)
+
+type testSigner struct {
+	kid  string
+	alg  string
+	priv crypto.Signer
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// jwk renders the public half of s as a JWKS entry.
+func (s testSigner) jwk() map[string]string {
+	switch pub := s.priv.Public().(type) {
+	case *rsa.PublicKey:
+		return map[string]string{"kty": "RSA", "kid": s.kid, "use": "sig", "n": b64(pub.N.Bytes()), "e": b64(big.NewInt(int64(pub.E)).Bytes())}
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		return map[string]string{"kty": "EC", "kid": s.kid, "crv": pub.Curve.Params().Name, "x": b64(pub.X.FillBytes(make([]byte, size))), "y": b64(pub.Y.FillBytes(make([]byte, size)))}
+	case ed25519.PublicKey:
+		return map[string]string{"kty": "OKP", "kid": s.kid, "crv": "Ed25519", "x": b64(pub)}
+	}
+	panic("unsupported key")
+}
+
+func (s testSigner) sign(t *testing.T, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": s.alg, "kid": s.kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := b64(header) + "." + b64(payload)
+
+	var sig []byte
+	var err error
+	switch k := s.priv.(type) {
+	case *rsa.PrivateKey:
+		sum := crypto.SHA256.New()
+		sum.Write([]byte(signed))
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, sum.Sum(nil))
+	case *ecdsa.PrivateKey:
+		sum := crypto.SHA256.New()
+		sum.Write([]byte(signed))
+		var r, ss *big.Int
+		r, ss, err = ecdsa.Sign(rand.Reader, k, sum.Sum(nil))
+		sig = append(r.FillBytes(make([]byte, 32)), ss.FillBytes(make([]byte, 32))...)
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(k, []byte(signed))
+	}
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return signed + "." + b64(sig)
+}
+
+func newSigners(t *testing.T) (rsaSigner, ecSigner, edSigner testSigner) {
+	t.Helper()
+	rk, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa: %v", err)
+	}
+	ek, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa: %v", err)
+	}
+	_, dk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519: %v", err)
+	}
+	return testSigner{"rsa-1", "RS256", rk}, testSigner{"ec-1", "ES256", ek}, testSigner{"ed-1", "EdDSA", dk}
+}
+
+func jwksJSON(signers ...testSigner) []byte {
+	keys := make([]map[string]string, len(signers))
+	for i, s := range signers {
+		keys[i] = s.jwk()
+	}
+	b, _ := json.Marshal(map[string]any{"keys": keys})
+	return b
+}
+
+func writeJWKS(t *testing.T, signers ...testSigner) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, jwksJSON(signers...), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	return path
+}
+
+func validClaims() map[string]any {
+	return map[string]any{
+		"iss":   testIssuer,
+		"aud":   []string{"other", testAudience},
+		"sub":   "svc-risk",
+		"exp":   testNow.Add(time.Hour).Unix(),
+		"scope": "openid read:quotes",
+	}
+}
+
+func newTestVerifier(source string) *Verifier {
+	v := NewVerifier(source, testIssuer, testAudience, 30*time.Second)
+	v.now = func() time.Time { return testNow }
+	return v
+}
+
+func TestVerifierAcceptsValidTokens(t *testing.T) {
+	rs, es, ed := newSigners(t)
+	v := newTestVerifier(writeJWKS(t, rs, es, ed))
+
+	for _, s := range []testSigner{rs, es, ed} {
+		p, err := v.Verify(context.Background(), s.sign(t, validClaims()))
+		if err != nil {
+			t.Fatalf("%s: %v", s.alg, err)
+		}
+		if p.Subject != "svc-risk" || len(p.Scopes) != 1 || !p.Has(ReadQuotes) {
+			t.Fatalf("%s: unexpected principal %+v", s.alg, p)
+		}
+	}
+
+	c := validClaims()
+	delete(c, "scope")
+	c["aud"] = testAudience
+	c["scp"] = []string{"admin:ingest", "write:everything"}
+	p, err := v.Verify(context.Background(), rs.sign(t, c))
+	if err != nil || len(p.Scopes) != 1 || !p.Has(AdminIngest) {
+		t.Fatalf("expected scp array to grant admin:ingest only, got %+v %v", p, err)
+	}
+}
+
+func TestVerifierRejectsInvalidTokens(t *testing.T) {
+	rs, es, _ := newSigners(t)
+	v := newTestVerifier(writeJWKS(t, rs))
+	other, _, _ := newSigners(t)
+
+	with := func(k string, val any) map[string]any {
+		c := validClaims()
+		if val == nil {
+			delete(c, k)
+		} else {
+			c[k] = val
+		}
+		return c
+	}
+	tampered := strings.Split(rs.sign(t, validClaims()), ".")
+	tampered[1] = b64([]byte(`{"iss":"` + testIssuer + `","aud":"` + testAudience + `","sub":"root","exp":9999999999,"scope":"admin:ingest"}`))
+
+	tests := map[string]string{
+		"wrong issuer":   rs.sign(t, with("iss", "https://evil.example.com/")),
+		"wrong audience": rs.sign(t, with("aud", "someone-else")),
+		"expired":        rs.sign(t, with("exp", testNow.Add(-time.Minute).Unix())),
+		"no expiry":      rs.sign(t, with("exp", nil)),
+		"not yet valid":  rs.sign(t, with("nbf", testNow.Add(time.Minute).Unix())),
+		"exp overflow":   rs.sign(t, with("exp", 1e300)),
+		"nbf overflow":   rs.sign(t, with("nbf", -1e300)),
+		"no subject":     rs.sign(t, with("sub", nil)),
+		"unknown key":    es.sign(t, validClaims()),
+		"foreign key":    testSigner{rs.kid, rs.alg, other.priv}.sign(t, validClaims()),
+		"alg none":       b64([]byte(`{"alg":"none"}`)) + "." + tampered[1] + ".",
+		"tampered":       strings.Join(tampered, "."),
+		"garbage":        "not-a-jwt",
+	}
+	for name, token := range tests {
+		if _, err := v.Verify(context.Background(), token); !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("%s: expected ErrInvalidToken, got %v", name, err)
+		}
+	}
+
+	// Expiries past 2262, which time.Duration cannot hold, are still far off.
+	if _, err := v.Verify(context.Background(), rs.sign(t, with("exp", 9999999999.5))); err != nil {
+		t.Fatalf("expected a distant expiry to be valid: %v", err)
+	}
+
+	// Within the leeway an expired token still passes.
+	if _, err := v.Verify(context.Background(), rs.sign(t, with("exp", testNow.Add(-10*time.Second).Unix()))); err != nil {
+		t.Fatalf("expected leeway to absorb clock skew: %v", err)
+	}
+}
+
+func TestVerifierReloadsRotatedKeys(t *testing.T) {
+	rs, es, _ := newSigners(t)
+	current := jwksJSON(rs)
+	fetches := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		_, _ = w.Write(current)
+	}))
+	defer srv.Close()
+
+	v := newTestVerifier(srv.URL)
+	if err := v.Refresh(context.Background()); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	current = jwksJSON(rs, es)
+
+	// A new key is only looked for once the refresh interval has passed.
+	if _, err := v.Verify(context.Background(), es.sign(t, validClaims())); !errors.Is(err, ErrInvalidToken) || fetches != 1 {
+		t.Fatalf("expected unknown key within the refresh interval, got %v after %d fetches", err, fetches)
+	}
+	v.now = func() time.Time { return testNow.Add(jwksRefreshInterval) }
+	if _, err := v.Verify(context.Background(), es.sign(t, validClaims())); err != nil || fetches != 2 {
+		t.Fatalf("expected rotated key to be fetched, got %v after %d fetches", err, fetches)
+	}
+}
+
+func TestVerifierReportsUnavailableJWKS(t *testing.T) {
+	rs, _, _ := newSigners(t)
+	v := newTestVerifier(filepath.Join(t.TempDir(), "missing.json"))
+	_, err := v.Verify(context.Background(), rs.sign(t, validClaims()))
+	if err == nil || errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected a load error distinct from ErrInvalidToken, got %v", err)
+	}
+}
+
+func TestParseJWKS(t *testing.T) {
+	rs, _, _ := newSigners(t)
+	enc := rs.jwk()
+	enc["use"] = "enc"
+	b, _ := json.Marshal(map[string]any{"keys": []map[string]string{enc}})
+	if _, err := ParseJWKS(b); err == nil {
+		t.Fatalf("expected a set of encryption keys to be rejected")
+	}
+
+	weak, _ := rsa.GenerateKey(rand.Reader, 1024)
+	b = jwksJSON(testSigner{"weak", "RS256", weak})
+	if _, err := ParseJWKS(b); err == nil {
+		t.Fatalf("expected a 1024-bit RSA key to be rejected")
+	}
+
+	off := map[string]string{"kty": "EC", "kid": "bad", "crv": "P-256", "x": b64(make([]byte, 32)), "y": b64(make([]byte, 32))}
+	b, _ = json.Marshal(map[string]any{"keys": []map[string]string{off}})
+	if _, err := ParseJWKS(b); err == nil {
+		t.Fatalf("expected a point off the curve to be rejected")
+	}
+}
@@ -0,0 +1,121 @@
+// Package cache memoizes query results in process, with LRU eviction, a TTL
+// and collapsing of concurrent loads of the same key.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+type entry[V any] struct {
+	key     string
+	value   V
+	expires time.Time
+}
+
+// Cache holds up to size values for ttl each, evicting the least recently
+// used first. It is safe for concurrent use.
+type Cache[V any] struct {
+	size int
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu    sync.Mutex
+	order *list.List // front is the most recently used
+	items map[string]*list.Element
+	// gen counts purges. Loads started before a purge neither store their
+	// result nor are joined by callers arriving after it.
+	gen uint64
+
+	group singleflight.Group
+}
+
+// New returns an empty Cache.
+func New[V any](size int, ttl time.Duration) *Cache[V] {
+	return &Cache[V]{size: size, ttl: ttl, now: time.Now, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+// Get returns the value of key, calling load to produce it when it is not
+// cached. Concurrent callers of the same key share a single load, which is
+// not canceled when the caller that started it goes away; each caller still
+// returns as soon as its own ctx is done. Errors are not cached.
+func (c *Cache[V]) Get(ctx context.Context, key string, load func(ctx context.Context) (V, error)) (V, error) {
+	c.mu.Lock()
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry[V])
+		if c.now().Before(e.expires) {
+			c.order.MoveToFront(el)
+			c.mu.Unlock()
+			return e.value, nil
+		}
+		c.remove(el)
+	}
+	gen := c.gen
+	c.mu.Unlock()
+
+	ch := c.group.DoChan(strconv.FormatUint(gen, 10)+"|"+key, func() (any, error) {
+		lctx := context.WithoutCancel(ctx)
+		if deadline, ok := ctx.Deadline(); ok {
+			var cancel context.CancelFunc
+			lctx, cancel = context.WithDeadline(lctx, deadline)
+			defer cancel()
+		}
+		v, err := load(lctx)
+		if err == nil {
+			c.add(gen, key, v)
+		}
+		return v, err
+	})
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			var zero V
+			return zero, res.Err
+		}
+		return res.Val.(V), nil
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+func (c *Cache[V]) add(gen uint64, key string, v V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen != c.gen {
+		return
+	}
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+	c.items[key] = c.order.PushFront(&entry[V]{key: key, value: v, expires: c.now().Add(c.ttl)})
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *Cache[V]) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.items, el.Value.(*entry[V]).key)
+}
+
+// Purge drops every value, and the results of loads in flight.
+func (c *Cache[V]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	c.order.Init()
+	clear(c.items)
+}
+
+// Len is the number of values cached, expired ones included.
+func (c *Cache[V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
@@ -0,0 +1,142 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func constant(v int, calls *int) func(context.Context) (int, error) {
+	return func(context.Context) (int, error) {
+		*calls++
+		return v, nil
+	}
+}
+
+func TestCacheHitsExpiresAndEvicts(t *testing.T) {
+	now := time.Date(2024, 5, 10, 10, 0, 0, 0, time.UTC)
+	c := New[int](2, time.Minute)
+	c.now = func() time.Time { return now }
+	ctx := context.Background()
+	calls := 0
+
+	for i := 0; i < 2; i++ {
+		if v, err := c.Get(ctx, "a", constant(1, &calls)); v != 1 || err != nil {
+			t.Fatalf("unexpected %d, %v", v, err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("expected a single load, got %d", calls)
+	}
+
+	c.Get(ctx, "b", constant(2, &calls))
+	c.Get(ctx, "a", constant(1, &calls)) // a is now the most recently used
+	c.Get(ctx, "c", constant(3, &calls))
+	if c.Len() != 2 {
+		t.Fatalf("expected the cache to hold 2 values, got %d", c.Len())
+	}
+	calls = 0
+	c.Get(ctx, "a", constant(1, &calls))
+	c.Get(ctx, "b", constant(2, &calls))
+	if calls != 1 {
+		t.Fatalf("expected only the least recently used key to be evicted, reloaded %d", calls)
+	}
+
+	now = now.Add(time.Minute)
+	calls = 0
+	c.Get(ctx, "a", constant(1, &calls))
+	if calls != 1 {
+		t.Fatalf("expected expired values to be reloaded")
+	}
+}
+
+func TestCacheDoesNotCacheErrors(t *testing.T) {
+	c := New[int](10, time.Minute)
+	boom := errors.New("boom")
+	if _, err := c.Get(context.Background(), "a", func(context.Context) (int, error) { return 0, boom }); !errors.Is(err, boom) {
+		t.Fatalf("expected the load error, got %v", err)
+	}
+	if c.Len() != 0 {
+		t.Fatalf("errors must not be cached")
+	}
+}
+
+func TestCacheCollapsesConcurrentLoads(t *testing.T) {
+	c := New[int](10, time.Minute)
+	release := make(chan struct{})
+	var loads atomic.Int32
+	load := func(context.Context) (int, error) {
+		loads.Add(1)
+		<-release
+		return 42, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := c.Get(context.Background(), "k", load); v != 42 || err != nil {
+				t.Errorf("unexpected %d, %v", v, err)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if loads.Load() != 1 {
+		t.Fatalf("expected one load for concurrent callers, got %d", loads.Load())
+	}
+}
+
+func TestCacheCallerCancellation(t *testing.T) {
+	c := New[int](10, time.Minute)
+	release := make(chan struct{})
+	var loadErr error
+	done := make(chan struct{})
+	load := func(ctx context.Context) (int, error) {
+		<-release
+		loadErr = ctx.Err()
+		close(done)
+		return 1, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	if _, err := c.Get(ctx, "k", load); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the caller to give up, got %v", err)
+	}
+	close(release)
+	<-done
+	if loadErr != nil {
+		t.Fatalf("the shared load must outlive the caller that started it, got %v", loadErr)
+	}
+}
+
+func TestCachePurgeDropsLoadsInFlight(t *testing.T) {
+	c := New[int](10, time.Minute)
+	started, release := make(chan struct{}), make(chan struct{})
+	go c.Get(context.Background(), "k", func(context.Context) (int, error) {
+		close(started)
+		<-release
+		return 1, nil
+	})
+	<-started
+	c.Purge()
+
+	calls := 0
+	if v, _ := c.Get(context.Background(), "k", constant(2, &calls)); v != 2 || calls != 1 {
+		t.Fatalf("callers after a purge must not join a stale load, got %d", v)
+	}
+	close(release)
+	time.Sleep(10 * time.Millisecond)
+	if v, _ := c.Get(context.Background(), "k", constant(3, &calls)); v != 2 {
+		t.Fatalf("a stale load must not overwrite fresh values, got %d", v)
+	}
+}
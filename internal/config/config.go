@@ -1,27 +1,122 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+
+	"desafiocotacaob3/internal/ratelimit"
 )
 
 type Config struct {
-	DBHost     string
-	DBPort     string
-	DBUser     string
-	DBPassword string
-	DBName     string
-	APIPort    string
+	DBHost       string
+	DBPort       string
+	DBUser       string
+	DBPassword   string
+	DBName       string
+	APIPort      string
+	RiskFreeRate float64
+
+	// GRPCPort is where the gRPC API listens. Empty, or APIPort, serves it
+	// on APIPort alongside HTTP.
+	GRPCPort string
+
+	LegacyDeprecation time.Time
+	LegacySunset      time.Time
+
+	// ReadinessTimeout bounds the dependency checks of /readyz.
+	ReadinessTimeout time.Duration
+	// StaleAfterDays is how many business days the latest ingested session
+	// may lag behind today before /readyz reports the data as stale.
+	StaleAfterDays int
+
+	// HTTP server limits. WriteTimeout must exceed QueryTimeout so a
+	// timed-out query can still be reported to the client.
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+	// QueryTimeout bounds the database work of a request; ExportTimeout
+	// replaces it, and WriteTimeout, for the streaming export endpoints.
+	// Zero leaves requests unbounded.
+	QueryTimeout  time.Duration
+	ExportTimeout time.Duration
+
+	// CacheMaxAge is how long clients may cache responses whose window is
+	// fully ingested, and RecentCacheMaxAge responses whose window includes
+	// sessions still to come.
+	CacheMaxAge       time.Duration
+	RecentCacheMaxAge time.Duration
+
+	// QueryCacheSize is how many aggregate query results the API keeps in
+	// memory, for up to QueryCacheTTL; zero disables the cache. It is also
+	// purged whenever ingest commits a session.
+	QueryCacheSize int
+	QueryCacheTTL  time.Duration
+
+	// CompressMinSize is the smallest response body, in bytes, the API
+	// compresses for clients that accept it.
+	CompressMinSize int
+
+	// GraphQLMaxComplexity caps the cost of a /graphql query, roughly the
+	// number of objects it may return plus a fixed cost per database query,
+	// checked before it runs; zero disables the limit.
+	GraphQLMaxComplexity int
+
+	// AuthRequired rejects requests to the data endpoints that carry no
+	// credential. Presented credentials are always checked.
+	AuthRequired bool
+	// JWKS is the URL or file path of the key set bearer JWTs are verified
+	// with; empty disables bearer tokens. Tokens must be issued by
+	// JWTIssuer for JWTAudience, and are checked for expiry with JWTLeeway
+	// of clock skew.
+	JWKS        string
+	JWTIssuer   string
+	JWTAudience string
+	JWTLeeway   time.Duration
+
+	// RateLimit is the default rate each client may call a data endpoint
+	// at, and RateLimitRoutes overrides it per route path without version
+	// prefix. A zero Rate disables limiting. Clients are identified by
+	// credential, or by address when anonymous, read from ClientIPHeader
+	// when the API runs behind a proxy that sets it.
+	RateLimit       ratelimit.Rate
+	RateLimitRoutes map[string]ratelimit.Rate
+	// RateLimitStore is "memory", limiting each replica on its own, or
+	// "postgres", sharing the limits between replicas.
+	RateLimitStore string
+	ClientIPHeader string
+
+	// ShutdownTimeout bounds how long the API waits for in-flight requests
+	// to finish once it is asked to stop.
+	ShutdownTimeout time.Duration
+
+	// IngestMetricsAddr is where ingest serves /metrics; empty disables it.
+	IngestMetricsAddr string
+	// IngestMetricsTextfile is a file ingest rewrites with its metrics after
+	// every run, for the node_exporter textfile collector; empty disables it.
+	IngestMetricsTextfile string
 }
 
+// Default lifecycle of the unversioned routes kept as aliases of /v1.
+var (
+	defaultLegacyDeprecation = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+	defaultLegacySunset      = time.Date(2027, time.April, 30, 0, 0, 0, 0, time.UTC)
+)
+
 func Load() (*Config, error) {
 	loadEnv()
 
 	logger := zerolog.New(os.Stdout).With().Timestamp().Logger()
 	log.Logger = logger
+	zerolog.DefaultContextLogger = &log.Logger
 
 	cfg := &Config{
 		DBHost:     os.Getenv("DB_HOST"),
@@ -30,11 +125,206 @@ func Load() (*Config, error) {
 		DBPassword: os.Getenv("DB_PASSWORD"),
 		DBName:     os.Getenv("DB_NAME"),
 		APIPort:    os.Getenv("API_PORT"),
+		GRPCPort:   os.Getenv("GRPC_PORT"),
+
+		JWKS:        os.Getenv("JWT_JWKS"),
+		JWTIssuer:   os.Getenv("JWT_ISSUER"),
+		JWTAudience: os.Getenv("JWT_AUDIENCE"),
+
+		ClientIPHeader: os.Getenv("CLIENT_IP_HEADER"),
+
+		IngestMetricsAddr:     os.Getenv("INGEST_METRICS_ADDR"),
+		IngestMetricsTextfile: os.Getenv("INGEST_METRICS_TEXTFILE"),
+	}
+
+	var err error
+	if cfg.RiskFreeRate, err = floatEnv("RISK_FREE_RATE", 0); err != nil {
+		return nil, err
+	}
+	if cfg.LegacyDeprecation, err = dateEnv("LEGACY_DEPRECATION", defaultLegacyDeprecation); err != nil {
+		return nil, err
+	}
+	if cfg.LegacySunset, err = dateEnv("LEGACY_SUNSET", defaultLegacySunset); err != nil {
+		return nil, err
+	}
+	if cfg.ReadinessTimeout, err = durationEnv("READINESS_TIMEOUT", 2*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.ReadHeaderTimeout, err = durationEnv("READ_HEADER_TIMEOUT", 5*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.ReadTimeout, err = durationEnv("READ_TIMEOUT", 10*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.WriteTimeout, err = durationEnv("WRITE_TIMEOUT", 30*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.IdleTimeout, err = durationEnv("IDLE_TIMEOUT", 2*time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.QueryTimeout, err = durationEnv("QUERY_TIMEOUT", 10*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.ExportTimeout, err = durationEnv("EXPORT_TIMEOUT", 10*time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.WriteTimeout > 0 && cfg.QueryTimeout >= cfg.WriteTimeout {
+		return nil, fmt.Errorf("QUERY_TIMEOUT (%s) must be shorter than WRITE_TIMEOUT (%s)", cfg.QueryTimeout, cfg.WriteTimeout)
+	}
+	if cfg.MaxHeaderBytes, err = intEnv("MAX_HEADER_BYTES", 16<<10); err != nil {
+		return nil, err
+	}
+	if cfg.CacheMaxAge, err = durationEnv("CACHE_MAX_AGE", 24*time.Hour); err != nil {
+		return nil, err
+	}
+	if cfg.RecentCacheMaxAge, err = durationEnv("RECENT_CACHE_MAX_AGE", time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.QueryCacheSize, err = intEnv("QUERY_CACHE_SIZE", 1024); err != nil {
+		return nil, err
+	}
+	if cfg.QueryCacheTTL, err = durationEnv("QUERY_CACHE_TTL", 10*time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.CompressMinSize, err = intEnv("COMPRESS_MIN_SIZE", 1024); err != nil {
+		return nil, err
+	}
+	if cfg.GraphQLMaxComplexity, err = intEnv("GRAPHQL_MAX_COMPLEXITY", 2000); err != nil {
+		return nil, err
+	}
+	if cfg.AuthRequired, err = boolEnv("AUTH_REQUIRED", false); err != nil {
+		return nil, err
+	}
+	if cfg.JWTLeeway, err = durationEnv("JWT_LEEWAY", 30*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.JWKS != "" && (cfg.JWTIssuer == "" || cfg.JWTAudience == "") {
+		return nil, fmt.Errorf("JWT_JWKS requires JWT_ISSUER and JWT_AUDIENCE")
+	}
+	if cfg.RateLimit, err = rateEnv("RATE_LIMIT", "120/m:30"); err != nil {
+		return nil, err
+	}
+	if cfg.RateLimitRoutes, err = routeRatesEnv("RATE_LIMIT_ROUTES"); err != nil {
+		return nil, err
+	}
+	switch cfg.RateLimitStore = os.Getenv("RATE_LIMIT_STORE"); cfg.RateLimitStore {
+	case "":
+		cfg.RateLimitStore = "memory"
+	case "memory", "postgres":
+	default:
+		return nil, fmt.Errorf("invalid RATE_LIMIT_STORE %q, must be memory or postgres", cfg.RateLimitStore)
+	}
+	if cfg.ShutdownTimeout, err = durationEnv("SHUTDOWN_TIMEOUT", 20*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.StaleAfterDays, err = intEnv("DATA_STALE_AFTER_DAYS", 3); err != nil {
+		return nil, err
 	}
 
 	return cfg, nil
 }
 
+func floatEnv(name string, def float64) (float64, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return f, nil
+}
+
+func boolEnv(name string, def bool) (bool, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return b, nil
+}
+
+func intEnv(name string, def int) (int, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return n, nil
+}
+
+func durationEnv(name string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return d, nil
+}
+
+func dateEnv(name string, def time.Time) (time.Time, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return t, nil
+}
+
+// parseRate parses a ratelimit.Rate, or "off" for the zero Rate.
+func parseRate(v string) (ratelimit.Rate, error) {
+	if v == "off" {
+		return ratelimit.Rate{}, nil
+	}
+	return ratelimit.ParseRate(v)
+}
+
+func rateEnv(name, def string) (ratelimit.Rate, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		v = def
+	}
+	r, err := parseRate(v)
+	if err != nil {
+		return ratelimit.Rate{}, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return r, nil
+}
+
+// routeRatesEnv parses a comma-separated list of PATH=RATE pairs.
+func routeRatesEnv(name string) (map[string]ratelimit.Rate, error) {
+	rates := make(map[string]ratelimit.Rate)
+	v := os.Getenv(name)
+	if v == "" {
+		return rates, nil
+	}
+	for _, pair := range strings.Split(v, ",") {
+		path, rate, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("invalid %s: %q is not PATH=RATE", name, pair)
+		}
+		r, err := parseRate(rate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", name, err)
+		}
+		rates[path] = r
+	}
+	return rates, nil
+}
+
 func loadEnv() {
 	paths := []string{".env", "../.env", "../../.env"}
 	for _, p := range paths {
@@ -0,0 +1,193 @@
+package export
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	"desafiocotacaob3/internal/repository"
+)
+
+// ManifestName is the file, at the dataset root, listing completed partitions.
+const ManifestName = "_manifest.json"
+
+// DatasetRow is a trade as stored in a partitioned dataset. Date and ticker are
+// encoded in the partition path, so they are not repeated in the file.
+type DatasetRow struct {
+	ID       string    `parquet:"id"`
+	Time     time.Time `parquet:"time,timestamp(millisecond)"`
+	Price    float64   `parquet:"price"`
+	Quantity float64   `parquet:"quantity"`
+}
+
+// ManifestFile describes one Parquet file written to the dataset.
+type ManifestFile struct {
+	Path   string `json:"path"`
+	Ticker string `json:"ticker"`
+	Rows   int64  `json:"rows"`
+	Bytes  int64  `json:"bytes"`
+}
+
+// ManifestDay records a session whose partitions were fully written.
+type ManifestDay struct {
+	Date        string         `json:"date"`
+	Files       []ManifestFile `json:"files"`
+	CompletedAt time.Time      `json:"completed_at"`
+}
+
+// Manifest lists every completed session of a dataset.
+type Manifest struct {
+	Days []ManifestDay `json:"days"`
+}
+
+// Dataset is a Hive-style partitioned Parquet directory laid out as
+// date=YYYY-MM-DD/ticker=XXXX/part-0.parquet. A session is the unit of work:
+// it is written to a temporary directory and renamed into place before being
+// added to the manifest, so an interrupted export can be resumed by skipping
+// the sessions already listed.
+type Dataset struct {
+	root     string
+	manifest Manifest
+	done     map[string]struct{}
+}
+
+// OpenDataset creates root if needed and loads its manifest.
+func OpenDataset(root string) (*Dataset, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	d := &Dataset{root: root, done: make(map[string]struct{})}
+	b, err := os.ReadFile(filepath.Join(root, ManifestName))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(b, &d.manifest); err != nil {
+			return nil, fmt.Errorf("invalid manifest: %w", err)
+		}
+	}
+	for _, day := range d.manifest.Days {
+		d.done[day.Date] = struct{}{}
+	}
+	return d, nil
+}
+
+// Manifest returns the sessions completed so far.
+func (d *Dataset) Manifest() Manifest {
+	return d.manifest
+}
+
+// Done reports whether day is already in the manifest.
+func (d *Dataset) Done(day time.Time) bool {
+	_, ok := d.done[day.Format("2006-01-02")]
+	return ok
+}
+
+// WriteDay writes the trades that stream emits, which must be ordered by
+// ticker, as the partitions of day and records them in the manifest. Any
+// partial output from a previous attempt at day is discarded first.
+func (d *Dataset) WriteDay(day time.Time, stream func(fn func(repository.Trade) error) error) (ManifestDay, error) {
+	date := day.Format("2006-01-02")
+	partition := "date=" + date
+	final := filepath.Join(d.root, partition)
+	tmp := filepath.Join(d.root, "."+partition+".tmp")
+	if err := os.RemoveAll(tmp); err != nil {
+		return ManifestDay{}, err
+	}
+
+	entry := ManifestDay{Date: date, Files: []ManifestFile{}}
+	var (
+		f       *os.File
+		w       *parquet.GenericWriter[DatasetRow]
+		current ManifestFile
+	)
+	closeFile := func() error {
+		if f == nil {
+			return nil
+		}
+		if err := w.Close(); err != nil {
+			f.Close()
+			return err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return err
+		}
+		current.Bytes = info.Size()
+		entry.Files = append(entry.Files, current)
+		err = f.Close()
+		f = nil
+		return err
+	}
+
+	err := stream(func(t repository.Trade) error {
+		if f == nil || t.Ticker != current.Ticker {
+			if err := closeFile(); err != nil {
+				return err
+			}
+			tickerDir := "ticker=" + url.PathEscape(t.Ticker)
+			dir := filepath.Join(tmp, tickerDir)
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				return err
+			}
+			var err error
+			if f, err = os.Create(filepath.Join(dir, "part-0.parquet")); err != nil {
+				return err
+			}
+			w = parquet.NewGenericWriter[DatasetRow](f, parquet.MaxRowsPerRowGroup(parquetRowGroupSize))
+			current = ManifestFile{Path: path.Join(partition, tickerDir, "part-0.parquet"), Ticker: t.Ticker}
+		}
+		current.Rows++
+		_, err := w.Write([]DatasetRow{{ID: t.ID, Time: t.Time, Price: t.Price, Quantity: t.Quantity}})
+		return err
+	})
+	if err == nil {
+		err = closeFile()
+	}
+	if err != nil {
+		if f != nil {
+			f.Close()
+		}
+		os.RemoveAll(tmp)
+		return ManifestDay{}, err
+	}
+
+	if err := os.MkdirAll(tmp, 0o755); err != nil {
+		return ManifestDay{}, err
+	}
+	if err := os.RemoveAll(final); err != nil {
+		return ManifestDay{}, err
+	}
+	if err := os.Rename(tmp, final); err != nil {
+		return ManifestDay{}, err
+	}
+
+	entry.CompletedAt = time.Now().UTC()
+	d.manifest.Days = append(d.manifest.Days, entry)
+	sort.Slice(d.manifest.Days, func(i, j int) bool { return d.manifest.Days[i].Date < d.manifest.Days[j].Date })
+	d.done[date] = struct{}{}
+	return entry, d.saveManifest()
+}
+
+// saveManifest replaces the manifest atomically.
+func (d *Dataset) saveManifest() error {
+	b, err := json.MarshalIndent(d.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	name := filepath.Join(d.root, ManifestName)
+	if err := os.WriteFile(name+".tmp", b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(name+".tmp", name)
+}
@@ -0,0 +1,89 @@
+package export
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	"desafiocotacaob3/internal/repository"
+)
+
+func tradeStream(trades ...repository.Trade) func(fn func(repository.Trade) error) error {
+	return func(fn func(repository.Trade) error) error {
+		for _, t := range trades {
+			if err := fn(t); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func TestDatasetWriteDay(t *testing.T) {
+	root := t.TempDir()
+	day := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+	at := day.Add(10 * time.Hour)
+
+	ds, err := OpenDataset(root)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	entry, err := ds.WriteDay(day, tradeStream(
+		repository.Trade{ID: "1", Ticker: "PETR4", Time: at, Price: 10, Quantity: 100},
+		repository.Trade{ID: "2", Ticker: "PETR4", Time: at.Add(time.Second), Price: 11, Quantity: 50},
+		repository.Trade{ID: "3", Ticker: "VALE3", Time: at, Price: 60, Quantity: 10},
+	))
+	if err != nil {
+		t.Fatalf("write day: %v", err)
+	}
+	if len(entry.Files) != 2 || entry.Files[0].Path != "date=2024-05-10/ticker=PETR4/part-0.parquet" || entry.Files[0].Rows != 2 {
+		t.Fatalf("unexpected manifest entry %+v", entry)
+	}
+
+	rows, err := parquet.ReadFile[DatasetRow](filepath.Join(root, entry.Files[0].Path))
+	if err != nil {
+		t.Fatalf("read partition: %v", err)
+	}
+	if len(rows) != 2 || rows[1].Price != 11 {
+		t.Fatalf("unexpected rows %+v", rows)
+	}
+
+	reopened, err := OpenDataset(root)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if !reopened.Done(day) || reopened.Done(day.AddDate(0, 0, 1)) {
+		t.Fatalf("manifest not resumed: %+v", reopened.Manifest())
+	}
+}
+
+func TestDatasetWriteDayFailureLeavesNoPartition(t *testing.T) {
+	root := t.TempDir()
+	day := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+	ds, err := OpenDataset(root)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+
+	boom := errors.New("connection reset")
+	_, err = ds.WriteDay(day, func(fn func(repository.Trade) error) error {
+		if err := fn(repository.Trade{ID: "1", Ticker: "PETR4", Time: day, Price: 10, Quantity: 1}); err != nil {
+			return err
+		}
+		return boom
+	})
+	if !errors.Is(err, boom) {
+		t.Fatalf("expected stream error, got %v", err)
+	}
+	entries, _ := os.ReadDir(root)
+	if len(entries) != 0 {
+		t.Fatalf("expected no leftovers, found %v", entries)
+	}
+	if ds.Done(day) {
+		t.Fatalf("failed day recorded as done")
+	}
+}
@@ -0,0 +1,272 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// Format is a serialization for row-oriented exports.
+type Format string
+
+const (
+	JSON    Format = "json"
+	CSV     Format = "csv"
+	NDJSON  Format = "ndjson"
+	Parquet Format = "parquet"
+)
+
+// ErrUnsupportedFormat is returned when neither the format param nor the
+// Accept header name a Format this package can produce.
+var ErrUnsupportedFormat = errors.New("unsupported export format")
+
+// parquetRowGroupSize bounds how many rows a Parquet writer buffers before
+// flushing a row group to the underlying writer.
+const parquetRowGroupSize = 64 * 1024
+
+var contentTypes = map[Format]string{
+	JSON:    "application/json",
+	CSV:     "text/csv",
+	NDJSON:  "application/x-ndjson",
+	Parquet: "application/vnd.apache.parquet",
+}
+
+var mediaTypes = map[string]Format{
+	"application/json":               JSON,
+	"text/csv":                       CSV,
+	"application/x-ndjson":           NDJSON,
+	"application/ndjson":             NDJSON,
+	"application/vnd.apache.parquet": Parquet,
+	"application/x-parquet":          Parquet,
+}
+
+// ContentType is the media type sent for f.
+func (f Format) ContentType() string {
+	return contentTypes[f]
+}
+
+// formats are the Formats in the order Negotiate prefers them when the Accept
+// header rates them equally.
+var formats = []Format{JSON, CSV, NDJSON, Parquet}
+
+// Negotiate picks the Format for r. An explicit format query param wins over
+// the Accept header; JSON is used when neither expresses a preference. Of
+// the Formats the Accept header allows, the one it rates highest is picked,
+// then the one it names most specifically.
+func Negotiate(r *http.Request) (Format, error) {
+	if s := strings.ToLower(r.URL.Query().Get("format")); s != "" {
+		if _, ok := contentTypes[Format(s)]; ok {
+			return Format(s), nil
+		}
+		return "", ErrUnsupportedFormat
+	}
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return JSON, nil
+	}
+	ranges := parseAccept(accept)
+	var best Format
+	bestQ, bestSpec := 0.0, -1
+	for _, f := range formats {
+		q, spec := quality(ranges, f)
+		if q > bestQ || (q > 0 && q == bestQ && spec > bestSpec) {
+			best, bestQ, bestSpec = f, q, spec
+		}
+	}
+	if best == "" {
+		return "", ErrUnsupportedFormat
+	}
+	return best, nil
+}
+
+// mediaRange is a media range of an Accept header and its quality.
+type mediaRange struct {
+	typ, subtype string
+	q            float64
+}
+
+// parseAccept parses the media ranges of an Accept header, skipping those
+// that are malformed or have an invalid quality.
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		typ, subtype, ok := strings.Cut(mt, "/")
+		if !ok {
+			continue
+		}
+		q := 1.0
+		if s, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(s, 64); err != nil || !(q >= 0 && q <= 1) {
+				continue
+			}
+		}
+		ranges = append(ranges, mediaRange{typ: typ, subtype: subtype, q: q})
+	}
+	return ranges
+}
+
+// specificity is how specifically rg names the media type typ/subtype: 2 for
+// the type itself, 1 for typ/* and 0 for */*, or -1 when it does not match.
+func (rg mediaRange) specificity(typ, subtype string) int {
+	switch {
+	case rg.typ == "*" && rg.subtype == "*":
+		return 0
+	case rg.typ != typ:
+		return -1
+	case rg.subtype == "*":
+		return 1
+	case rg.subtype == subtype:
+		return 2
+	}
+	return -1
+}
+
+// quality is the quality ranges give f under the best of its media types,
+// and how specifically they name it. A media type gets the quality of the
+// most specific range matching it, as RFC 9110 requires.
+func quality(ranges []mediaRange, f Format) (q float64, spec int) {
+	spec = -1
+	for mt, mf := range mediaTypes {
+		if mf != f {
+			continue
+		}
+		typ, subtype, _ := strings.Cut(mt, "/")
+		mtQ, mtSpec := 0.0, -1
+		for _, rg := range ranges {
+			if s := rg.specificity(typ, subtype); s > mtSpec {
+				mtQ, mtSpec = rg.q, s
+			}
+		}
+		if mtQ > q || (mtQ == q && mtSpec > spec) {
+			q, spec = mtQ, mtSpec
+		}
+	}
+	return q, spec
+}
+
+// Record is a row that can be written in every Format. JSON encodings use the
+// json struct tags and Parquet the parquet struct tags.
+type Record interface {
+	CSVHeader() []string
+	CSVRow() []string
+}
+
+// Writer streams records of type T. Nothing is written to the underlying
+// io.Writer before the first Write, so callers can still send an error
+// response when the source fails or is empty. Close finishes the document.
+type Writer[T Record] interface {
+	Write(rec T) error
+	Close() error
+}
+
+// NewWriter returns a Writer producing f on w.
+func NewWriter[T Record](f Format, w io.Writer) (Writer[T], error) {
+	switch f {
+	case JSON:
+		return &jsonWriter[T]{w: w}, nil
+	case NDJSON:
+		return &ndjsonWriter[T]{enc: json.NewEncoder(w)}, nil
+	case CSV:
+		return &csvWriter[T]{w: csv.NewWriter(w)}, nil
+	case Parquet:
+		return &parquetWriter[T]{w: parquet.NewGenericWriter[T](w, parquet.MaxRowsPerRowGroup(parquetRowGroupSize))}, nil
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+// jsonWriter streams a JSON array one element at a time.
+type jsonWriter[T Record] struct {
+	w       io.Writer
+	started bool
+}
+
+func (j *jsonWriter[T]) Write(rec T) error {
+	sep := ","
+	if !j.started {
+		sep = "["
+		j.started = true
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(j.w, sep); err != nil {
+		return err
+	}
+	_, err = j.w.Write(b)
+	return err
+}
+
+func (j *jsonWriter[T]) Close() error {
+	end := "]\n"
+	if !j.started {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(j.w, end)
+	return err
+}
+
+type ndjsonWriter[T Record] struct {
+	enc *json.Encoder
+}
+
+func (n *ndjsonWriter[T]) Write(rec T) error {
+	return n.enc.Encode(rec)
+}
+
+func (n *ndjsonWriter[T]) Close() error {
+	return nil
+}
+
+type csvWriter[T Record] struct {
+	w       *csv.Writer
+	started bool
+}
+
+func (c *csvWriter[T]) header(rec T) error {
+	if c.started {
+		return nil
+	}
+	c.started = true
+	return c.w.Write(rec.CSVHeader())
+}
+
+func (c *csvWriter[T]) Write(rec T) error {
+	if err := c.header(rec); err != nil {
+		return err
+	}
+	return c.w.Write(rec.CSVRow())
+}
+
+func (c *csvWriter[T]) Close() error {
+	var zero T
+	if err := c.header(zero); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type parquetWriter[T Record] struct {
+	w *parquet.GenericWriter[T]
+}
+
+func (p *parquetWriter[T]) Write(rec T) error {
+	_, err := p.w.Write([]T{rec})
+	return err
+}
+
+func (p *parquetWriter[T]) Close() error {
+	return p.w.Close()
+}
@@ -0,0 +1,127 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+var tradeFixture = []TradeRecord{
+	{ID: "a", Ticker: "PETR4", Time: time.Date(2024, 5, 10, 10, 0, 0, 0, time.UTC), Price: 10.5, Quantity: 100},
+	{ID: "b", Ticker: "PETR4", Time: time.Date(2024, 5, 10, 10, 0, 1, 0, time.UTC), Price: 10.55, Quantity: 200},
+}
+
+func writeAll(t *testing.T, f Format) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter[TradeRecord](f, &buf)
+	if err != nil {
+		t.Fatalf("new writer: %v", err)
+	}
+	for _, rec := range tradeFixture {
+		if err := w.Write(rec); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		url    string
+		accept string
+		want   Format
+		err    error
+	}{
+		{url: "/x", want: JSON},
+		{url: "/x", accept: "text/csv", want: CSV},
+		{url: "/x", accept: "application/x-ndjson;q=0.9, text/csv", want: CSV},
+		{url: "/x", accept: "application/x-ndjson, text/csv;q=0.5", want: NDJSON},
+		{url: "/x", accept: "*/*", want: JSON},
+		{url: "/x", accept: "application/*", want: JSON},
+		{url: "/x", accept: "text/csv;q=0, */*", want: JSON},
+		{url: "/x", accept: "*/*;q=0.1, text/csv;q=0.1", want: CSV},
+		{url: "/x", accept: "text/*;q=0.5, application/json;q=0.4", want: CSV},
+		{url: "/x", accept: "application/*;q=0.8, application/json;q=0.2", want: NDJSON},
+		{url: "/x", accept: "text/csv;q=0", err: ErrUnsupportedFormat},
+		{url: "/x", accept: "text/csv;q=2", err: ErrUnsupportedFormat},
+		{url: "/x?format=parquet", accept: "text/csv", want: Parquet},
+		{url: "/x?format=xml", err: ErrUnsupportedFormat},
+		{url: "/x", accept: "application/xml", err: ErrUnsupportedFormat},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.url, nil)
+		if tt.accept != "" {
+			r.Header.Set("Accept", tt.accept)
+		}
+		got, err := Negotiate(r)
+		if err != tt.err || got != tt.want {
+			t.Fatalf("Negotiate(%s, %q) = %q, %v; want %q, %v", tt.url, tt.accept, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestCSVWriter(t *testing.T) {
+	got := string(writeAll(t, CSV))
+	want := "id,ticker,time,price,quantity\n" +
+		"a,PETR4,2024-05-10T10:00:00Z,10.5,100\n" +
+		"b,PETR4,2024-05-10T10:00:01Z,10.55,200\n"
+	if got != want {
+		t.Fatalf("unexpected csv:\n%s", got)
+	}
+}
+
+func TestJSONAndNDJSONWriters(t *testing.T) {
+	var arr []TradeRecord
+	if err := json.Unmarshal(writeAll(t, JSON), &arr); err != nil {
+		t.Fatalf("decode json: %v", err)
+	}
+	if len(arr) != 2 || arr[1].Price != 10.55 {
+		t.Fatalf("unexpected json rows %+v", arr)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(writeAll(t, NDJSON)))
+	var n int
+	for scanner.Scan() {
+		var rec TradeRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("decode ndjson line: %v", err)
+		}
+		n++
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 ndjson lines, got %d", n)
+	}
+}
+
+func TestParquetWriter(t *testing.T) {
+	data := writeAll(t, Parquet)
+	rows, err := parquet.Read[TradeRecord](bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("read parquet: %v", err)
+	}
+	if len(rows) != 2 || rows[0].ID != "a" || !rows[1].Time.Equal(tradeFixture[1].Time) {
+		t.Fatalf("unexpected parquet rows %+v", rows)
+	}
+}
+
+func TestWriterIsLazy(t *testing.T) {
+	for _, f := range []Format{JSON, CSV, NDJSON, Parquet} {
+		var buf bytes.Buffer
+		if _, err := NewWriter[TradeRecord](f, &buf); err != nil {
+			t.Fatalf("new writer %s: %v", f, err)
+		}
+		if buf.Len() != 0 {
+			t.Fatalf("%s writer wrote %q before the first record", f, strings.TrimSpace(buf.String()))
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package export
+
+import (
+	"strconv"
+	"time"
+
+	"desafiocotacaob3/internal/repository"
+)
+
+// TradeRecord is the exported shape of a repository.Trade.
+type TradeRecord struct {
+	ID       string    `json:"id" parquet:"id"`
+	Ticker   string    `json:"ticker" parquet:"ticker,dict"`
+	Time     time.Time `json:"time" parquet:"time,timestamp(millisecond)"`
+	Price    float64   `json:"price" parquet:"price"`
+	Quantity float64   `json:"quantity" parquet:"quantity"`
+}
+
+// NewTradeRecord converts t for export.
+func NewTradeRecord(t repository.Trade) TradeRecord {
+	return TradeRecord(t)
+}
+
+func (TradeRecord) CSVHeader() []string {
+	return []string{"id", "ticker", "time", "price", "quantity"}
+}
+
+func (t TradeRecord) CSVRow() []string {
+	return []string{
+		t.ID,
+		t.Ticker,
+		t.Time.Format(time.RFC3339),
+		strconv.FormatFloat(t.Price, 'f', -1, 64),
+		strconv.FormatFloat(t.Quantity, 'f', -1, 64),
+	}
+}
+
+// BarRecord is the exported shape of a repository.Bar.
+type BarRecord struct {
+	Ticker string    `json:"ticker" parquet:"ticker,dict"`
+	Time   time.Time `json:"time" parquet:"time,timestamp(millisecond)"`
+	Open   float64   `json:"open" parquet:"open"`
+	High   float64   `json:"high" parquet:"high"`
+	Low    float64   `json:"low" parquet:"low"`
+	Close  float64   `json:"close" parquet:"close"`
+	Volume int64     `json:"volume" parquet:"volume"`
+	Trades int64     `json:"trades" parquet:"trades"`
+}
+
+// NewBarRecord converts b, a bar of ticker, for export.
+func NewBarRecord(ticker string, b repository.Bar) BarRecord {
+	return BarRecord{
+		Ticker: ticker,
+		Time:   b.Time,
+		Open:   b.Open,
+		High:   b.High,
+		Low:    b.Low,
+		Close:  b.Close,
+		Volume: b.Volume,
+		Trades: b.Trades,
+	}
+}
+
+func (BarRecord) CSVHeader() []string {
+	return []string{"ticker", "time", "open", "high", "low", "close", "volume", "trades"}
+}
+
+func (b BarRecord) CSVRow() []string {
+	return []string{
+		b.Ticker,
+		b.Time.Format(time.RFC3339),
+		strconv.FormatFloat(b.Open, 'f', -1, 64),
+		strconv.FormatFloat(b.High, 'f', -1, 64),
+		strconv.FormatFloat(b.Low, 'f', -1, 64),
+		strconv.FormatFloat(b.Close, 'f', -1, 64),
+		strconv.FormatInt(b.Volume, 10),
+		strconv.FormatInt(b.Trades, 10),
+	}
+}
@@ -0,0 +1,166 @@
+package indicators
+
+import "math"
+
+// All indicators return a slice aligned with their input. Entries that cannot
+// be computed yet (the warm-up) are NaN; the matching Warmup function reports
+// how many leading entries that is.
+
+// SMA is the simple moving average over period values.
+func SMA(values []float64, period int) []float64 {
+	out := nanSlice(len(values))
+	if period <= 0 {
+		return out
+	}
+	var sum float64
+	for i, v := range values {
+		sum += v
+		if i >= period {
+			sum -= values[i-period]
+		}
+		if i >= period-1 {
+			out[i] = sum / float64(period)
+		}
+	}
+	return out
+}
+
+// SMAWarmup is the number of leading NaN entries produced by SMA.
+func SMAWarmup(period int) int {
+	return period - 1
+}
+
+// EMA is the exponential moving average with smoothing 2/(period+1), seeded
+// with the simple average of the first period values.
+func EMA(values []float64, period int) []float64 {
+	out := nanSlice(len(values))
+	if period <= 0 || len(values) < period {
+		return out
+	}
+	var seed float64
+	for _, v := range values[:period] {
+		seed += v
+	}
+	prev := seed / float64(period)
+	out[period-1] = prev
+	k := 2 / float64(period+1)
+	for i := period; i < len(values); i++ {
+		prev = values[i]*k + prev*(1-k)
+		out[i] = prev
+	}
+	return out
+}
+
+// EMAWarmup is the number of leading NaN entries produced by EMA.
+func EMAWarmup(period int) int {
+	return period - 1
+}
+
+// RSI is Wilder's relative strength index over period changes.
+func RSI(values []float64, period int) []float64 {
+	out := nanSlice(len(values))
+	if period <= 0 || len(values) <= period {
+		return out
+	}
+	var gain, loss float64
+	for i := 1; i <= period; i++ {
+		g, l := change(values[i-1], values[i])
+		gain += g
+		loss += l
+	}
+	gain /= float64(period)
+	loss /= float64(period)
+	out[period] = rsi(gain, loss)
+	for i := period + 1; i < len(values); i++ {
+		g, l := change(values[i-1], values[i])
+		gain = (gain*float64(period-1) + g) / float64(period)
+		loss = (loss*float64(period-1) + l) / float64(period)
+		out[i] = rsi(gain, loss)
+	}
+	return out
+}
+
+// RSIWarmup is the number of leading NaN entries produced by RSI.
+func RSIWarmup(period int) int {
+	return period
+}
+
+// Bollinger returns the middle band (SMA over period) and the upper and lower
+// bands k population standard deviations away from it.
+func Bollinger(values []float64, period int, k float64) (upper, middle, lower []float64) {
+	middle = SMA(values, period)
+	upper = nanSlice(len(values))
+	lower = nanSlice(len(values))
+	for i := range values {
+		if math.IsNaN(middle[i]) {
+			continue
+		}
+		var sq float64
+		for _, v := range values[i-period+1 : i+1] {
+			sq += (v - middle[i]) * (v - middle[i])
+		}
+		sd := math.Sqrt(sq / float64(period))
+		upper[i] = middle[i] + k*sd
+		lower[i] = middle[i] - k*sd
+	}
+	return upper, middle, lower
+}
+
+// BollingerWarmup is the number of leading NaN entries produced by Bollinger.
+func BollingerWarmup(period int) int {
+	return SMAWarmup(period)
+}
+
+// MACD returns the difference between the fast and slow EMAs, its signal EMA
+// and the histogram (macd - signal).
+func MACD(values []float64, fast, slow, signal int) (macd, sig, hist []float64) {
+	fastEMA := EMA(values, fast)
+	slowEMA := EMA(values, slow)
+	macd = nanSlice(len(values))
+	for i := range values {
+		macd[i] = fastEMA[i] - slowEMA[i]
+	}
+	sig = nanSlice(len(values))
+	hist = nanSlice(len(values))
+	start := EMAWarmup(max(fast, slow))
+	if start < 0 || start >= len(values) {
+		return macd, sig, hist
+	}
+	signalEMA := EMA(macd[start:], signal)
+	for i, v := range signalEMA {
+		sig[start+i] = v
+		hist[start+i] = macd[start+i] - v
+	}
+	return macd, sig, hist
+}
+
+// MACDWarmup is the number of leading NaN entries in the signal and histogram
+// produced by MACD.
+func MACDWarmup(fast, slow, signal int) int {
+	return EMAWarmup(max(fast, slow)) + EMAWarmup(signal)
+}
+
+func change(prev, cur float64) (gain, loss float64) {
+	if d := cur - prev; d > 0 {
+		return d, 0
+	}
+	return 0, prev - cur
+}
+
+func rsi(gain, loss float64) float64 {
+	if loss == 0 {
+		if gain == 0 {
+			return 50
+		}
+		return 100
+	}
+	return 100 - 100/(1+gain/loss)
+}
+
+func nanSlice(n int) []float64 {
+	out := make([]float64, n)
+	for i := range out {
+		out[i] = math.NaN()
+	}
+	return out
+}
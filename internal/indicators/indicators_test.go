@@ -0,0 +1,67 @@
+package indicators
+
+import (
+	"math"
+	"testing"
+)
+
+func assertSeries(t *testing.T, name string, got []float64, warmup int, want []float64) {
+	t.Helper()
+	if len(got) != warmup+len(want) {
+		t.Fatalf("%s: expected %d values, got %d", name, warmup+len(want), len(got))
+	}
+	for i := 0; i < warmup; i++ {
+		if !math.IsNaN(got[i]) {
+			t.Fatalf("%s: expected NaN warm-up at %d, got %v", name, i, got[i])
+		}
+	}
+	for i, w := range want {
+		if math.Abs(got[warmup+i]-w) > 1e-9 {
+			t.Fatalf("%s: value %d = %v, want %v", name, warmup+i, got[warmup+i], w)
+		}
+	}
+}
+
+func TestSMA(t *testing.T) {
+	got := SMA([]float64{1, 2, 3, 4, 5}, 3)
+	assertSeries(t, "sma", got, SMAWarmup(3), []float64{2, 3, 4})
+}
+
+func TestEMA(t *testing.T) {
+	got := EMA([]float64{1, 2, 3, 4, 5, 6}, 3)
+	assertSeries(t, "ema", got, EMAWarmup(3), []float64{2, 3, 4, 5})
+}
+
+func TestRSI(t *testing.T) {
+	closes := []float64{
+		44.34, 44.09, 44.15, 43.61, 44.33, 44.83, 45.10, 45.42, 45.84, 46.08,
+		45.89, 46.03, 45.61, 46.28, 46.28, 46.00, 46.03, 46.41, 46.22, 45.64,
+	}
+	got := RSI(closes, 14)
+	assertSeries(t, "rsi", got, RSIWarmup(14), []float64{
+		70.46413502109705, 66.24961855355505, 66.48094183471265,
+		69.34685316290866, 66.29471265892624, 57.91502067008556,
+	})
+}
+
+func TestBollinger(t *testing.T) {
+	upper, middle, lower := Bollinger([]float64{2, 4, 4, 4, 5, 5, 7, 9}, 8, 2)
+	warmup := BollingerWarmup(8)
+	assertSeries(t, "middle", middle, warmup, []float64{5})
+	assertSeries(t, "upper", upper, warmup, []float64{9})
+	assertSeries(t, "lower", lower, warmup, []float64{1})
+}
+
+func TestMACD(t *testing.T) {
+	values := make([]float64, 10)
+	for i := range values {
+		values[i] = float64(i + 1)
+	}
+	macd, signal, hist := MACD(values, 2, 4, 3)
+	// With a linear series both EMAs lag by a constant, so MACD is flat at
+	// (slow-fast)/2 = 1 and the signal converges to it immediately.
+	assertSeries(t, "macd", macd, EMAWarmup(4), []float64{1, 1, 1, 1, 1, 1, 1})
+	warmup := MACDWarmup(2, 4, 3)
+	assertSeries(t, "signal", signal, warmup, []float64{1, 1, 1, 1, 1})
+	assertSeries(t, "hist", hist, warmup, []float64{0, 0, 0, 0, 0})
+}
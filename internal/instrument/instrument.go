@@ -0,0 +1,59 @@
+package instrument
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Class is the instrument category inferred from a B3 ticker symbol.
+type Class string
+
+const (
+	Stock      Class = "stock"
+	Unit       Class = "unit"
+	BDR        Class = "bdr"
+	Fractional Class = "fractional"
+	Option     Class = "option"
+	Future     Class = "future"
+	Other      Class = "other"
+)
+
+// Classes lists every Class in the order they are reported.
+var Classes = []Class{Stock, Unit, BDR, Fractional, Option, Future, Other}
+
+var patterns = []struct {
+	class Class
+	re    *regexp.Regexp
+}{
+	{Fractional, regexp.MustCompile(`^[A-Z0-9]{4}\d{1,2}F$`)},
+	{BDR, regexp.MustCompile(`^[A-Z0-9]{4}3[2-5]$`)},
+	{Unit, regexp.MustCompile(`^[A-Z0-9]{4}11$`)},
+	{Stock, regexp.MustCompile(`^[A-Z0-9]{4}[3-8]$`)},
+	{Option, regexp.MustCompile(`^[A-Z]{4}[A-X]\d{2,4}[A-Z]?$`)},
+	{Future, regexp.MustCompile(`^[A-Z]{3}[FGHJKMNQUVXZ]\d{2}$`)},
+}
+
+// Classify infers the Class of a ticker from B3's symbol conventions: a
+// four-character root followed by 3-8 for shares, 11 for units/ETFs/FIIs,
+// 32-35 for BDRs and an F suffix for the fractional market; options use a
+// series letter and strike code; futures a three-letter root, month code and
+// two-digit year.
+func Classify(ticker string) Class {
+	ticker = strings.ToUpper(strings.TrimSpace(ticker))
+	for _, p := range patterns {
+		if p.re.MatchString(ticker) {
+			return p.class
+		}
+	}
+	return Other
+}
+
+// ParseClass validates a class name, reporting whether it is known.
+func ParseClass(s string) (Class, bool) {
+	for _, c := range Classes {
+		if string(c) == strings.ToLower(s) {
+			return c, true
+		}
+	}
+	return "", false
+}
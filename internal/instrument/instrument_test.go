@@ -0,0 +1,32 @@
+package instrument
+
+import "testing"
+
+func TestClassify(t *testing.T) {
+	tests := map[string]Class{
+		"PETR4":     Stock,
+		"VALE3":     Stock,
+		"BOVA11":    Unit,
+		"AAPL34":    BDR,
+		"PETR4F":    Fractional,
+		"PETRE300":  Option,
+		"VALEF825W": Option,
+		"WINZ24":    Future,
+		"DOLF25":    Future,
+		"DIIF31F32": Other,
+	}
+	for ticker, want := range tests {
+		if got := Classify(ticker); got != want {
+			t.Fatalf("Classify(%q) = %s, want %s", ticker, got, want)
+		}
+	}
+}
+
+func TestParseClass(t *testing.T) {
+	if c, ok := ParseClass("Stock"); !ok || c != Stock {
+		t.Fatalf("expected stock, got %q %v", c, ok)
+	}
+	if _, ok := ParseClass("crypto"); ok {
+		t.Fatalf("expected unknown class to be rejected")
+	}
+}
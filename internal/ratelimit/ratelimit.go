@@ -0,0 +1,180 @@
+// Package ratelimit implements token bucket rate limiting.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rate lets Limit requests through every Per on average, with bursts of up
+// to Burst requests.
+type Rate struct {
+	Limit int
+	Per   time.Duration
+	Burst int
+}
+
+// PerMinute is a Rate of n requests a minute with bursts of burst.
+func PerMinute(n, burst int) Rate {
+	return Rate{Limit: n, Per: time.Minute, Burst: burst}
+}
+
+var units = map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}
+
+// ParseRate parses a rate written as LIMIT/UNIT[:BURST], where UNIT is s, m
+// or h: "120/m:30" lets 120 requests through a minute in bursts of up to 30.
+// The burst defaults to the limit.
+func ParseRate(s string) (Rate, error) {
+	spec, burstStr, hasBurst := strings.Cut(s, ":")
+	limitStr, unit, ok := strings.Cut(spec, "/")
+	per, known := units[unit]
+	if !ok || !known {
+		return Rate{}, fmt.Errorf("invalid rate %q, want LIMIT/UNIT[:BURST] with UNIT one of s, m, h", s)
+	}
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit <= 0 {
+		return Rate{}, fmt.Errorf("invalid rate %q: limit must be a positive integer", s)
+	}
+	burst := limit
+	if hasBurst {
+		if burst, err = strconv.Atoi(burstStr); err != nil || burst <= 0 {
+			return Rate{}, fmt.Errorf("invalid rate %q: burst must be a positive integer", s)
+		}
+	}
+	return Rate{Limit: limit, Per: per, Burst: burst}, nil
+}
+
+// interval is the time it takes to refill one token.
+func (r Rate) interval() time.Duration {
+	return r.Per / time.Duration(r.Limit)
+}
+
+// Decision is the outcome of a request against a bucket.
+type Decision struct {
+	Allowed bool
+	// Limit is the bucket capacity and Remaining the whole tokens left.
+	Limit     int
+	Remaining int
+	// Reset is how long until the bucket is full again, and RetryAfter how
+	// long until the next request would be allowed.
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// Store counts requests against buckets that may be shared between
+// processes.
+type Store interface {
+	Take(ctx context.Context, key string, rate Rate) (Decision, error)
+	// Peek reports whether Take would allow a request, without counting it.
+	Peek(ctx context.Context, key string, rate Rate) (Decision, error)
+}
+
+// capacity is how far ahead of now a bucket may be full: Burst tokens.
+func (r Rate) capacity() time.Duration {
+	return time.Duration(r.Burst) * r.interval()
+}
+
+// bucket stores the time at which it will be full again (GCRA), which is all
+// that is needed to know how many tokens it holds at any point.
+type bucket struct {
+	full time.Time
+}
+
+// take consumes a token from b at now if one is available.
+func (b *bucket) take(now time.Time, rate Rate) Decision {
+	full := b.full
+	if full.Before(now) {
+		full = now
+	}
+	allowed := false
+	if next := full.Add(rate.interval()); next.Sub(now) <= rate.capacity() {
+		b.full = next
+		allowed = true
+	}
+	return decide(now, b.full, allowed, rate)
+}
+
+// decide reports a request made at now to a bucket that is full at full once
+// the request is counted, which it was if allowed.
+func decide(now, full time.Time, allowed bool, rate Rate) Decision {
+	interval := rate.interval()
+	d := Decision{Allowed: allowed, Limit: rate.Burst, Reset: max(full.Sub(now), 0)}
+	if !allowed {
+		d.RetryAfter = d.Reset + interval - rate.capacity()
+	}
+	d.Remaining = int(math.Floor(float64(rate.capacity()-d.Reset) / float64(interval)))
+	return d
+}
+
+// peek reports a request made at now to a bucket that is full at full,
+// without counting it.
+func peek(now, full time.Time, rate Rate) Decision {
+	if full.Before(now) {
+		full = now
+	}
+	return decide(now, full, full.Add(rate.interval()).Sub(now) <= rate.capacity(), rate)
+}
+
+// sweepEvery is how many calls to Allow pass between sweeps of full buckets.
+const sweepEvery = 4096
+
+// Limiter keeps one in-memory bucket per key.
+type Limiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	calls   int
+	now     func() time.Time
+}
+
+// NewLimiter returns an empty Limiter.
+func NewLimiter() *Limiter {
+	return &Limiter{buckets: make(map[string]*bucket), now: time.Now}
+}
+
+// Allow takes a token from the bucket of key, refilled at rate.
+func (l *Limiter) Allow(key string, rate Rate) Decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.calls++
+	if l.calls%sweepEvery == 0 {
+		l.sweep(now)
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{}
+		l.buckets[key] = b
+	}
+	return b.take(now, rate)
+}
+
+// Take is Allow for the Store interface; it never fails.
+func (l *Limiter) Take(ctx context.Context, key string, rate Rate) (Decision, error) {
+	return l.Allow(key, rate), nil
+}
+
+// Peek reports whether Allow would take a token from the bucket of key; it
+// never fails.
+func (l *Limiter) Peek(ctx context.Context, key string, rate Rate) (Decision, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var full time.Time
+	if b, ok := l.buckets[key]; ok {
+		full = b.full
+	}
+	return peek(l.now(), full, rate), nil
+}
+
+// sweep drops the buckets that are full, which are the same as new ones.
+func (l *Limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if !b.full.After(now) {
+			delete(l.buckets, key)
+		}
+	}
+}
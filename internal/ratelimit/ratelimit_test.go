@@ -0,0 +1,85 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLimiterBurstAndRefill(t *testing.T) {
+	now := time.Date(2024, 5, 10, 10, 0, 0, 0, time.UTC)
+	l := NewLimiter()
+	l.now = func() time.Time { return now }
+	rate := PerMinute(60, 3)
+
+	for i := 2; i >= 0; i-- {
+		d := l.Allow("k", rate)
+		if !d.Allowed || d.Remaining != i || d.Limit != 3 {
+			t.Fatalf("request %d: unexpected decision %+v", 3-i, d)
+		}
+	}
+	d := l.Allow("k", rate)
+	if d.Allowed || d.RetryAfter != time.Second || d.Reset != 3*time.Second {
+		t.Fatalf("expected throttling, got %+v", d)
+	}
+	if other := l.Allow("other", rate); !other.Allowed {
+		t.Fatalf("buckets must be per key")
+	}
+
+	now = now.Add(time.Second)
+	if d := l.Allow("k", rate); !d.Allowed || d.Remaining != 0 {
+		t.Fatalf("expected one refilled token, got %+v", d)
+	}
+	now = now.Add(time.Minute)
+	if d := l.Allow("k", rate); !d.Allowed || d.Remaining != 2 {
+		t.Fatalf("expected a full bucket, got %+v", d)
+	}
+}
+
+func TestLimiterPeek(t *testing.T) {
+	now := time.Date(2024, 5, 10, 10, 0, 0, 0, time.UTC)
+	l := NewLimiter()
+	l.now = func() time.Time { return now }
+	rate := PerMinute(60, 1)
+
+	if d, _ := l.Peek(context.Background(), "k", rate); !d.Allowed || d.Remaining != 1 {
+		t.Fatalf("expected a full bucket, got %+v", d)
+	}
+	if d, _ := l.Peek(context.Background(), "k", rate); !d.Allowed || len(l.buckets) != 0 {
+		t.Fatalf("peeking must not take a token, got %+v", d)
+	}
+	taken := l.Allow("k", rate)
+	if d, _ := l.Peek(context.Background(), "k", rate); d.Allowed || d.RetryAfter != time.Second || d.Reset != taken.Reset {
+		t.Fatalf("expected the empty bucket to be reported, got %+v", d)
+	}
+}
+
+func TestLimiterSweep(t *testing.T) {
+	now := time.Date(2024, 5, 10, 10, 0, 0, 0, time.UTC)
+	l := NewLimiter()
+	l.now = func() time.Time { return now }
+	l.Allow("a", PerMinute(60, 1))
+	now = now.Add(time.Minute)
+	l.sweep(now)
+	if len(l.buckets) != 0 {
+		t.Fatalf("full buckets must be dropped")
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	tests := map[string]Rate{
+		"120/m":   {Limit: 120, Per: time.Minute, Burst: 120},
+		"10/s:25": {Limit: 10, Per: time.Second, Burst: 25},
+		"1000/h":  {Limit: 1000, Per: time.Hour, Burst: 1000},
+	}
+	for s, want := range tests {
+		if got, err := ParseRate(s); err != nil || got != want {
+			t.Fatalf("%s: got %+v, %v", s, got, err)
+		}
+	}
+	for _, s := range []string{"", "120", "120/d", "0/m", "-1/m", "10/m:0", "10/m:x"} {
+		if _, err := ParseRate(s); err == nil {
+			t.Fatalf("expected %q to be rejected", s)
+		}
+	}
+}
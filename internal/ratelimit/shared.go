@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Backend persists buckets where every replica of a service can reach them.
+type Backend interface {
+	// TakeToken atomically moves the time at which the bucket of key is
+	// full interval later, counting from now if it is already full, unless
+	// that puts it more than capacity past now. It returns the backend's
+	// clock, the full time after the call and whether the token was taken.
+	TakeToken(ctx context.Context, key string, interval, capacity time.Duration) (now, full time.Time, taken bool, err error)
+	// PeekToken returns the backend's clock and the time at which the
+	// bucket of key is full, which is not after now when it already is.
+	PeekToken(ctx context.Context, key string) (now, full time.Time, err error)
+	// SweepTokens deletes the buckets that are full.
+	SweepTokens(ctx context.Context) error
+}
+
+// Shared is a Store keeping its buckets in a Backend, so that replicas share
+// the same limits. The backend's clock is used throughout so replicas with
+// skewed clocks agree.
+type Shared struct {
+	backend Backend
+	calls   atomic.Int64
+}
+
+// NewShared returns a Store over backend.
+func NewShared(backend Backend) *Shared {
+	return &Shared{backend: backend}
+}
+
+// Take takes a token from the bucket of key, refilled at rate.
+func (s *Shared) Take(ctx context.Context, key string, rate Rate) (Decision, error) {
+	if s.calls.Add(1)%sweepEvery == 0 {
+		// A failed sweep only leaves full buckets behind for the next one.
+		_ = s.backend.SweepTokens(ctx)
+	}
+	now, full, taken, err := s.backend.TakeToken(ctx, key, rate.interval(), rate.capacity())
+	if err != nil {
+		return Decision{}, err
+	}
+	return decide(now, full, taken, rate), nil
+}
+
+// Peek reports whether Take would take a token from the bucket of key.
+func (s *Shared) Peek(ctx context.Context, key string, rate Rate) (Decision, error) {
+	now, full, err := s.backend.PeekToken(ctx, key)
+	if err != nil {
+		return Decision{}, err
+	}
+	return peek(now, full, rate), nil
+}
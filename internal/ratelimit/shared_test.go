@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// memoryBackend is a Backend over a map, with a settable clock.
+type memoryBackend struct {
+	now    time.Time
+	full   map[string]time.Time
+	sweeps int
+}
+
+func (m *memoryBackend) TakeToken(ctx context.Context, key string, interval, capacity time.Duration) (time.Time, time.Time, bool, error) {
+	full := m.full[key]
+	if full.Before(m.now) {
+		full = m.now
+	}
+	if next := full.Add(interval); next.Sub(m.now) <= capacity {
+		m.full[key] = next
+		return m.now, next, true, nil
+	}
+	return m.now, m.full[key], false, nil
+}
+
+func (m *memoryBackend) PeekToken(ctx context.Context, key string) (time.Time, time.Time, error) {
+	return m.now, m.full[key], nil
+}
+
+func (m *memoryBackend) SweepTokens(ctx context.Context) error {
+	m.sweeps++
+	return nil
+}
+
+func TestSharedMatchesLimiter(t *testing.T) {
+	now := time.Date(2024, 5, 10, 10, 0, 0, 0, time.UTC)
+	backend := &memoryBackend{now: now, full: make(map[string]time.Time)}
+	shared := NewShared(backend)
+	local := NewLimiter()
+	local.now = func() time.Time { return backend.now }
+	rate := PerMinute(60, 3)
+
+	for i := 0; i < 6; i++ {
+		peeked, _ := shared.Peek(context.Background(), "k", rate)
+		if want, _ := local.Peek(context.Background(), "k", rate); peeked != want {
+			t.Fatalf("request %d: shared peeked %+v, in-memory %+v", i, peeked, want)
+		}
+		got, err := shared.Take(context.Background(), "k", rate)
+		if err != nil {
+			t.Fatalf("take: %v", err)
+		}
+		if want := local.Allow("k", rate); got != want {
+			t.Fatalf("request %d: shared decided %+v, in-memory %+v", i, got, want)
+		}
+		backend.now = backend.now.Add(300 * time.Millisecond)
+	}
+}
+
+func TestSharedSweeps(t *testing.T) {
+	backend := &memoryBackend{now: time.Now(), full: make(map[string]time.Time)}
+	shared := NewShared(backend)
+	for i := 0; i < sweepEvery; i++ {
+		_, _ = shared.Take(context.Background(), "k", PerMinute(60, 1))
+	}
+	if backend.sweeps != 1 {
+		t.Fatalf("expected one sweep every %d calls, got %d", sweepEvery, backend.sweeps)
+	}
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrTimeout means a query ran past its deadline or the server's
+	// statement timeout.
+	ErrTimeout = errors.New("query timed out")
+	// ErrUnavailable means the database could not be reached or refused the
+	// connection.
+	ErrUnavailable = errors.New("database unavailable")
+)
+
+// unavailableCodes are the SQLSTATEs, besides the connection_exception class,
+// of a server that is shutting down, starting up or out of connections.
+var unavailableCodes = map[pq.ErrorCode]bool{
+	"53300": true, // too_many_connections
+	"57P01": true, // admin_shutdown
+	"57P02": true, // crash_shutdown
+	"57P03": true, // cannot_connect_now
+}
+
+// Classify wraps err with ErrTimeout or ErrUnavailable when the driver error
+// means one of them, so callers can tell them apart with errors.Is without
+// knowing the driver. Other errors are returned unchanged.
+func Classify(err error) error {
+	switch {
+	case err == nil, errors.Is(err, ErrTimeout), errors.Is(err, ErrUnavailable):
+		return err
+	case errors.Is(err, context.DeadlineExceeded):
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, sql.ErrConnDone):
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch {
+		case pqErr.Code == "57014": // query_canceled, raised by statement_timeout
+			return fmt.Errorf("%w: %w", ErrTimeout, err)
+		case pqErr.Code.Class() == "08", unavailableCodes[pqErr.Code]:
+			return fmt.Errorf("%w: %w", ErrUnavailable, err)
+		}
+		return err
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	return err
+}
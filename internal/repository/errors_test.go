@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		err  error
+		want error
+	}{
+		{fmt.Errorf("query: %w", context.DeadlineExceeded), ErrTimeout},
+		{&pq.Error{Code: "57014"}, ErrTimeout},
+		{&pq.Error{Code: "08006"}, ErrUnavailable},
+		{&pq.Error{Code: "57P03"}, ErrUnavailable},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, ErrUnavailable},
+	}
+	for _, tt := range tests {
+		if got := Classify(tt.err); !errors.Is(got, tt.want) || !errors.Is(got, tt.err) {
+			t.Fatalf("Classify(%v) = %v, want it to wrap %v", tt.err, got, tt.want)
+		}
+	}
+
+	syntax := &pq.Error{Code: "42601"}
+	if got := Classify(syntax); got != syntax {
+		t.Fatalf("unexpected classification of %v: %v", syntax, got)
+	}
+	if Classify(nil) != nil {
+		t.Fatalf("nil must stay nil")
+	}
+}
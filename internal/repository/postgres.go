@@ -9,13 +9,17 @@ import (
 	"time"
 
 	"github.com/google/uuid"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
 
 	"desafiocotacaob3/internal/config"
 )
 
 type PostgresRepository struct {
-	db *sql.DB
+	db      *sql.DB
+	dsn     string
+	name    string
+	queries *prometheus.HistogramVec
 }
 
 func NewPostgres(cfg *config.Config) (*PostgresRepository, error) {
@@ -27,15 +31,22 @@ func NewPostgres(cfg *config.Config) (*PostgresRepository, error) {
 	if err := db.Ping(); err != nil {
 		return nil, err
 	}
-	repo := &PostgresRepository{db: db}
+	repo := &PostgresRepository{db: db, dsn: dsn, name: cfg.DBName, queries: newQueryHistogram()}
 	if err := repo.migrate(context.Background()); err != nil {
 		return nil, err
 	}
 	return repo, nil
 }
 
-func (r *PostgresRepository) migrate(ctx context.Context) error {
-	const stmt = `CREATE TABLE IF NOT EXISTS quotes (
+// Close closes the connection pool.
+func (r *PostgresRepository) Close() error {
+	return r.db.Close()
+}
+
+// migrations are applied in order; the version of a migration is its index
+// plus one. Append new migrations, never edit applied ones.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS quotes (
         id UUID PRIMARY KEY,
         date DATE NOT NULL,
         ticker TEXT NOT NULL,
@@ -45,9 +56,73 @@ func (r *PostgresRepository) migrate(ctx context.Context) error {
 );
 
 CREATE INDEX IF NOT EXISTS idx_quotes_ticker ON quotes (ticker);
-CREATE INDEX IF NOT EXISTS idx_quotes_date ON quotes (date);`
-	_, err := r.db.ExecContext(ctx, stmt)
-	return err
+CREATE INDEX IF NOT EXISTS idx_quotes_date ON quotes (date);`,
+	`CREATE TABLE api_keys (
+        id UUID PRIMARY KEY,
+        name TEXT NOT NULL,
+        prefix TEXT NOT NULL UNIQUE,
+        hash BYTEA NOT NULL UNIQUE,
+        scopes TEXT[] NOT NULL,
+        rate_per_minute INTEGER NOT NULL,
+        burst INTEGER NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+        revoked_at TIMESTAMPTZ
+);`,
+	`CREATE UNLOGGED TABLE rate_limits (
+        key TEXT PRIMARY KEY,
+        full_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_rate_limits_full_at ON rate_limits (full_at);`,
+	`CREATE INDEX idx_quotes_ticker_date ON quotes (ticker, date);`,
+	`CREATE TABLE ingests (
+        seq BIGSERIAL PRIMARY KEY,
+        date DATE NOT NULL,
+        committed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_ingests_date ON ingests (date);
+
+INSERT INTO ingests (date) SELECT DISTINCT date FROM quotes ORDER BY date;`,
+}
+
+// SchemaVersion is the migration version this build expects.
+var SchemaVersion = len(migrations)
+
+// migrationLock is the advisory lock key serializing migrations between the
+// API and ingest processes starting at the same time.
+const migrationLock = 0x6d696772
+
+func (r *PostgresRepository) migrate(ctx context.Context) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", migrationLock); err != nil {
+		return err
+	}
+	const table = `CREATE TABLE IF NOT EXISTS schema_migrations (
+        version INTEGER PRIMARY KEY,
+        applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`
+	if _, err := tx.ExecContext(ctx, table); err != nil {
+		return err
+	}
+	var current int
+	if err := tx.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current); err != nil {
+		return err
+	}
+	for i := current; i < len(migrations); i++ {
+		if _, err := tx.ExecContext(ctx, migrations[i]); err != nil {
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", i+1); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
 func parseLine(line string) (ticker string, price float64, qty float64, t time.Time, ok bool, err error) {
@@ -85,6 +160,7 @@ func parseLine(line string) (ticker string, price float64, qty float64, t time.T
 	return ticker, price, qty, t, true, nil
 }
 func (r *PostgresRepository) DayExists(ctx context.Context, day string) (bool, error) {
+	defer r.observe("day_exists", time.Now())
 	const query = "SELECT EXISTS (SELECT 1 FROM quotes WHERE date = $1)"
 	var exists bool
 	if err := r.db.QueryRowContext(ctx, query, day).Scan(&exists); err != nil {
@@ -93,36 +169,98 @@ func (r *PostgresRepository) DayExists(ctx context.Context, day string) (bool, e
 	return exists, nil
 }
 func (r *PostgresRepository) InsertBatch(ctx context.Context, day string, lines []string) error {
+	return r.InsertDay(ctx, day, func(insert func(lines []string) error) error {
+		return insert(lines)
+	})
+}
+
+// InsertDay inserts the trades of day that fill passes to insert within a
+// single transaction, so the day is either loaded completely or not at all:
+// if fill or an insert fails, or ctx is canceled, nothing is committed.
+// The commit is recorded in ingests and listeners of IngestChannel are
+// notified once it is done.
+func (r *PostgresRepository) InsertDay(ctx context.Context, day string, fill func(insert func(lines []string) error) error) error {
+	defer r.observe("insert_day", time.Now())
 	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 	stmt, err := tx.PrepareContext(ctx, `INSERT INTO quotes (id, date, ticker, price, quantity, time) VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (id) DO NOTHING`)
 	if err != nil {
-		tx.Rollback()
 		return err
 	}
 	defer stmt.Close()
 
-	for _, line := range lines {
-		ticker, price, qty, t, ok, err := parseLine(line)
-		if err != nil {
-			tx.Rollback()
-			return err
-		}
-		if !ok {
-			continue
-		}
+	err = fill(func(lines []string) error {
+		for _, line := range lines {
+			ticker, price, qty, t, ok, err := parseLine(line)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
 
-		id := uuid.New()
-		if _, err := stmt.ExecContext(ctx, id, day, ticker, price, qty, t); err != nil {
-			tx.Rollback()
-			return err
+			id := uuid.New()
+			if _, err := stmt.ExecContext(ctx, id, day, ticker, price, qty, t); err != nil {
+				return err
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO ingests (date) VALUES ($1)", day); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "SELECT pg_notify($1, $2)", IngestChannel, day); err != nil {
+		return err
 	}
 	return tx.Commit()
 }
+
+// Summary is the highest price and the largest daily volume of a ticker
+// since a start date.
+type Summary struct {
+	MaxPrice       float64
+	MaxDailyVolume int64
+}
+
+// QuoteSummaries is QuoteSummary for several tickers in one query. Tickers
+// without trades since startDate are left out of the map.
+func (r *PostgresRepository) QuoteSummaries(ctx context.Context, tickers []string, startDate time.Time) (map[string]Summary, error) {
+	defer r.observe("quote_summaries", time.Now())
+	const query = `SELECT ticker, MAX(max_price), MAX(volume)::BIGINT
+FROM (
+        SELECT ticker, date, MAX(price) AS max_price, SUM(quantity) AS volume
+        FROM quotes
+        WHERE ticker = ANY($1)
+          AND ($2::DATE IS NULL OR date >= $2)
+        GROUP BY ticker, date
+) t
+GROUP BY ticker`
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(tickers), nullDate(startDate))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := make(map[string]Summary, len(tickers))
+	for rows.Next() {
+		var ticker string
+		var s Summary
+		if err := rows.Scan(&ticker, &s.MaxPrice, &s.MaxDailyVolume); err != nil {
+			return nil, err
+		}
+		summaries[ticker] = s
+	}
+	return summaries, rows.Err()
+}
+
 func (r *PostgresRepository) QuoteSummary(ctx context.Context, ticker string, startDate time.Time) (float64, int64, bool, error) {
+	defer r.observe("quote_summary", time.Now())
 	condition := "WHERE ticker = $1"
 	args := []any{ticker}
 	if !startDate.IsZero() {
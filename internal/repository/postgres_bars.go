@@ -0,0 +1,171 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Bar is an OHLCV aggregate of the trades stored in quotes.
+type Bar struct {
+	Time   time.Time
+	Open   float64
+	High   float64
+	Low    float64
+	Close  float64
+	Volume int64
+	Trades int64
+}
+
+// Day is the width of a daily bar.
+const Day = 24 * time.Hour
+
+// Intervals maps the accepted interval names to bar widths.
+var Intervals = map[string]time.Duration{
+	"1m":  time.Minute,
+	"5m":  5 * time.Minute,
+	"15m": 15 * time.Minute,
+	"30m": 30 * time.Minute,
+	"1h":  time.Hour,
+	"1d":  Day,
+}
+
+// DailyBars aggregates the trades of ticker into one bar per session between
+// from and to (inclusive). A zero from or to leaves that side of the range open.
+func (r *PostgresRepository) DailyBars(ctx context.Context, ticker string, from, to time.Time) ([]Bar, error) {
+	return r.Candles(ctx, ticker, Day, from, to, 0)
+}
+
+// Candles aggregates the trades of ticker into bars of the given width for the
+// sessions between from and to (inclusive). When warmup is positive, up to that
+// many bars preceding from are returned as well so that indicators computed
+// over the series are already valid at from.
+func (r *PostgresRepository) Candles(ctx context.Context, ticker string, interval time.Duration, from, to time.Time, warmup int) ([]Bar, error) {
+	var bars []Bar
+	err := r.StreamCandles(ctx, ticker, interval, from, to, warmup, func(b Bar) error {
+		bars = append(bars, b)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return bars, nil
+}
+
+// StreamCandles is Candles calling fn for each bar as it is read from the
+// cursor instead of collecting them.
+func (r *PostgresRepository) StreamCandles(ctx context.Context, ticker string, interval time.Duration, from, to time.Time, warmup int, fn func(Bar) error) error {
+	defer r.observe("candles", time.Now())
+	// A bar never spans sessions, so the warmup bars lie in the last warmup
+	// sessions before from; bounding the scan there keeps the rest of the
+	// ticker's history out of the aggregation.
+	const query = `WITH warmup_start AS (
+        SELECT MIN(date) AS date FROM (
+                SELECT DISTINCT date FROM quotes
+                WHERE ticker = $1 AND date < $3
+                ORDER BY date DESC
+                LIMIT $5
+        ) sessions
+), bars AS (
+        SELECT date + FLOOR(EXTRACT(EPOCH FROM time) / $2) * $2 * INTERVAL '1 second' AS bucket,
+                (ARRAY_AGG(price ORDER BY time ASC))[1] AS open,
+                MAX(price) AS high,
+                MIN(price) AS low,
+                (ARRAY_AGG(price ORDER BY time DESC))[1] AS close,
+                SUM(quantity)::BIGINT AS volume,
+                COUNT(*) AS trades
+        FROM quotes
+        WHERE ticker = $1
+          AND ($3::DATE IS NULL OR date >= COALESCE((SELECT date FROM warmup_start), $3))
+          AND ($4::DATE IS NULL OR date <= $4)
+        GROUP BY 1
+)
+SELECT * FROM (
+        SELECT * FROM bars WHERE $3::DATE IS NOT NULL AND bucket < $3 ORDER BY bucket DESC LIMIT $5
+) warmup
+UNION ALL
+SELECT * FROM bars WHERE $3::DATE IS NULL OR bucket >= $3
+ORDER BY bucket`
+	rows, err := r.db.QueryContext(ctx, query, ticker, int64(interval/time.Second), nullDate(from), nullDate(to), warmup)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var b Bar
+		if err := rows.Scan(&b.Time, &b.Open, &b.High, &b.Low, &b.Close, &b.Volume, &b.Trades); err != nil {
+			return err
+		}
+		if err := fn(b); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func nullDate(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.Format("2006-01-02")
+}
+
+// LatestCandles returns, for each of tickers, its last limit bars of the
+// given width in the sessions between from and to (inclusive), in time order.
+// Tickers without trades in the range are left out of the map.
+func (r *PostgresRepository) LatestCandles(ctx context.Context, tickers []string, interval time.Duration, from, to time.Time, limit int) (map[string][]Bar, error) {
+	defer r.observe("latest_candles", time.Now())
+	// A session holds at least one bar, so the last limit bars of a ticker
+	// lie in its last limit sessions of the range; bounding the scan there
+	// keeps the rest of the range out of the aggregation.
+	const query = `WITH sessions AS (
+        SELECT t.ticker, MIN(s.date) AS start
+        FROM UNNEST($1::TEXT[]) AS t(ticker)
+        CROSS JOIN LATERAL (
+                SELECT DISTINCT date FROM quotes
+                WHERE quotes.ticker = t.ticker
+                  AND ($3::DATE IS NULL OR date >= $3)
+                  AND ($4::DATE IS NULL OR date <= $4)
+                ORDER BY date DESC
+                LIMIT $5
+        ) s
+        GROUP BY t.ticker
+), bars AS (
+        SELECT q.ticker,
+                q.date + FLOOR(EXTRACT(EPOCH FROM q.time) / $2) * $2 * INTERVAL '1 second' AS bucket,
+                (ARRAY_AGG(q.price ORDER BY q.time ASC))[1] AS open,
+                MAX(q.price) AS high,
+                MIN(q.price) AS low,
+                (ARRAY_AGG(q.price ORDER BY q.time DESC))[1] AS close,
+                SUM(q.quantity)::BIGINT AS volume,
+                COUNT(*) AS trades
+        FROM quotes q
+        JOIN sessions s ON q.ticker = s.ticker AND q.date >= s.start
+        WHERE $4::DATE IS NULL OR q.date <= $4
+        GROUP BY 1, 2
+)
+SELECT ticker, bucket, open, high, low, close, volume, trades
+FROM (
+        SELECT *, ROW_NUMBER() OVER (PARTITION BY ticker ORDER BY bucket DESC) AS n FROM bars
+) ranked
+WHERE n <= $5
+ORDER BY ticker, bucket`
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(tickers), int64(interval/time.Second), nullDate(from), nullDate(to), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bars := make(map[string][]Bar, len(tickers))
+	for rows.Next() {
+		var ticker string
+		var b Bar
+		if err := rows.Scan(&ticker, &b.Time, &b.Open, &b.High, &b.Low, &b.Close, &b.Volume, &b.Trades); err != nil {
+			return nil, err
+		}
+		bars[ticker] = append(bars[ticker], b)
+	}
+	return bars, rows.Err()
+}
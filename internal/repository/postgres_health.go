@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Ping checks that the database is reachable.
+func (r *PostgresRepository) Ping(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
+
+// MigrationVersion is the latest migration applied to the database.
+func (r *PostgresRepository) MigrationVersion(ctx context.Context) (int, error) {
+	defer r.observe("migration_version", time.Now())
+	var version int
+	err := r.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	return version, err
+}
+
+// LatestSession is the most recent date with ingested trades. ok is false
+// when quotes is empty.
+func (r *PostgresRepository) LatestSession(ctx context.Context) (day time.Time, ok bool, err error) {
+	defer r.observe("latest_session", time.Now())
+	var latest sql.NullTime
+	if err := r.db.QueryRowContext(ctx, "SELECT MAX(date) FROM quotes").Scan(&latest); err != nil {
+		return time.Time{}, false, err
+	}
+	return latest.Time, latest.Valid, nil
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Generation identifies the data of the sessions up to a day. Ingest may
+// load a session after later ones, when it retries a day that failed, so the
+// latest session covered is not enough: Seq changes whenever any of them is
+// loaded.
+type Generation struct {
+	// Latest is the latest session ingested, whatever the day.
+	Latest time.Time
+	// Seq is the last ingest of a session up to the day, committed at At.
+	// Seq is 0 when none was ingested.
+	Seq int64
+	At  time.Time
+}
+
+// IngestGeneration is the Generation of the sessions up to through. ok is
+// false when nothing was ingested yet.
+func (r *PostgresRepository) IngestGeneration(ctx context.Context, through time.Time) (gen Generation, ok bool, err error) {
+	defer r.observe("ingest_generation", time.Now())
+	const query = `SELECT (SELECT MAX(date) FROM ingests), MAX(seq), MAX(committed_at)
+FROM ingests
+WHERE date <= $1`
+	var latest, at sql.NullTime
+	var seq sql.NullInt64
+	if err := r.db.QueryRowContext(ctx, query, through.Format("2006-01-02")).Scan(&latest, &seq, &at); err != nil {
+		return Generation{}, false, err
+	}
+	return Generation{Latest: latest.Time, Seq: seq.Int64, At: at.Time}, latest.Valid, nil
+}
+
+// Ingest is the commit of a session by ingest. Seq orders commits, whatever
+// the session: a day loaded late comes after the later ones loaded before.
+type Ingest struct {
+	Seq  int64
+	Date time.Time
+	At   time.Time
+}
+
+// IngestsAfter lists the ingests committed after seq, in commit order.
+func (r *PostgresRepository) IngestsAfter(ctx context.Context, seq int64) ([]Ingest, error) {
+	defer r.observe("ingests_after", time.Now())
+	const query = "SELECT seq, date, committed_at FROM ingests WHERE seq > $1 ORDER BY seq"
+	rows, err := r.db.QueryContext(ctx, query, seq)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ingests []Ingest
+	for rows.Next() {
+		var in Ingest
+		if err := rows.Scan(&in.Seq, &in.Date, &in.At); err != nil {
+			return nil, err
+		}
+		ingests = append(ingests, in)
+	}
+	return ingests, rows.Err()
+}
+
+// LatestIngest is the Seq of the last ingest committed, 0 when there was
+// none.
+func (r *PostgresRepository) LatestIngest(ctx context.Context) (int64, error) {
+	defer r.observe("latest_ingest", time.Now())
+	var seq int64
+	if err := r.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(seq), 0) FROM ingests").Scan(&seq); err != nil {
+		return 0, err
+	}
+	return seq, nil
+}
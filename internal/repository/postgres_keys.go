@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// ErrKeyNotFound is returned when no active API key has the given prefix.
+var ErrKeyNotFound = errors.New("api key not found")
+
+// APIKey is a client credential. Only a hash of the secret is stored; Prefix
+// identifies the key in listings, logs and revocations.
+type APIKey struct {
+	ID            string
+	Name          string
+	Prefix        string
+	Scopes        []string
+	RatePerMinute int
+	Burst         int
+	CreatedAt     time.Time
+	RevokedAt     *time.Time
+}
+
+// CreateAPIKey stores a key whose secret hashes to hash.
+func (r *PostgresRepository) CreateAPIKey(ctx context.Context, key APIKey, hash []byte) (APIKey, error) {
+	defer r.observe("create_api_key", time.Now())
+	const query = `INSERT INTO api_keys (id, name, prefix, hash, scopes, rate_per_minute, burst)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING created_at`
+	key.ID = uuid.NewString()
+	err := r.db.QueryRowContext(ctx, query, key.ID, key.Name, key.Prefix, hash, pq.Array(key.Scopes), key.RatePerMinute, key.Burst).Scan(&key.CreatedAt)
+	return key, err
+}
+
+// RevokeAPIKey revokes the active key with prefix.
+func (r *PostgresRepository) RevokeAPIKey(ctx context.Context, prefix string) error {
+	defer r.observe("revoke_api_key", time.Now())
+	res, err := r.db.ExecContext(ctx, "UPDATE api_keys SET revoked_at = now() WHERE prefix = $1 AND revoked_at IS NULL", prefix)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrKeyNotFound
+	}
+	return nil
+}
+
+// ListAPIKeys returns every key, revoked ones included, oldest first.
+func (r *PostgresRepository) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	defer r.observe("list_api_keys", time.Now())
+	rows, err := r.db.QueryContext(ctx, "SELECT id, name, prefix, scopes, rate_per_minute, burst, created_at, revoked_at FROM api_keys ORDER BY created_at")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []APIKey
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// APIKeyByHash looks up the active key whose secret hashes to hash. ok is
+// false when there is none or it was revoked.
+func (r *PostgresRepository) APIKeyByHash(ctx context.Context, hash []byte) (key APIKey, ok bool, err error) {
+	defer r.observe("api_key_by_hash", time.Now())
+	row := r.db.QueryRowContext(ctx, "SELECT id, name, prefix, scopes, rate_per_minute, burst, created_at, revoked_at FROM api_keys WHERE hash = $1 AND revoked_at IS NULL", hash)
+	key, err = scanAPIKey(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return APIKey{}, false, nil
+	}
+	if err != nil {
+		return APIKey{}, false, err
+	}
+	return key, true, nil
+}
+
+func scanAPIKey(row interface{ Scan(...any) error }) (APIKey, error) {
+	var (
+		k       APIKey
+		revoked sql.NullTime
+	)
+	if err := row.Scan(&k.ID, &k.Name, &k.Prefix, pq.Array(&k.Scopes), &k.RatePerMinute, &k.Burst, &k.CreatedAt, &revoked); err != nil {
+		return APIKey{}, err
+	}
+	if revoked.Valid {
+		k.RevokedAt = &revoked.Time
+	}
+	return k, nil
+}
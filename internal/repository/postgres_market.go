@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// SessionStats summarizes one ticker's trading in a session. PrevClose is the
+// ticker's last price in the preceding session with data, or zero if it did
+// not trade then.
+type SessionStats struct {
+	Ticker    string
+	Open      float64
+	High      float64
+	Low       float64
+	Close     float64
+	PrevClose float64
+	Volume    int64
+	Notional  float64
+	Trades    int64
+}
+
+// SessionStats aggregates every ticker traded on day.
+func (r *PostgresRepository) SessionStats(ctx context.Context, day time.Time) ([]SessionStats, error) {
+	defer r.observe("session_stats", time.Now())
+	const query = `WITH day AS (
+        SELECT ticker,
+                (ARRAY_AGG(price ORDER BY time ASC))[1] AS open,
+                MAX(price) AS high,
+                MIN(price) AS low,
+                (ARRAY_AGG(price ORDER BY time DESC))[1] AS close,
+                SUM(quantity)::BIGINT AS volume,
+                SUM(price * quantity) AS notional,
+                COUNT(*) AS trades
+        FROM quotes
+        WHERE date = $1
+        GROUP BY ticker
+), prev AS (
+        SELECT DISTINCT ON (ticker) ticker, price AS close
+        FROM quotes
+        WHERE date = (SELECT MAX(date) FROM quotes WHERE date < $1)
+        ORDER BY ticker, time DESC
+)
+SELECT d.ticker, d.open, d.high, d.low, d.close, p.close, d.volume, d.notional, d.trades
+FROM day d
+LEFT JOIN prev p ON p.ticker = d.ticker`
+	rows, err := r.db.QueryContext(ctx, query, day.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []SessionStats
+	for rows.Next() {
+		var s SessionStats
+		var prev sql.NullFloat64
+		if err := rows.Scan(&s.Ticker, &s.Open, &s.High, &s.Low, &s.Close, &prev, &s.Volume, &s.Notional, &s.Trades); err != nil {
+			return nil, err
+		}
+		s.PrevClose = prev.Float64
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
@@ -0,0 +1,28 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+func newQueryHistogram() *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "quotes",
+		Subsystem: "db",
+		Name:      "query_duration_seconds",
+		Help:      "Duration of database queries, including streaming the rows to the caller.",
+		Buckets:   []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"query"})
+}
+
+// observe records how long query took since start.
+func (r *PostgresRepository) observe(query string, start time.Time) {
+	r.queries.WithLabelValues(query).Observe(time.Since(start).Seconds())
+}
+
+// Collectors exposes query durations and the sql.DB connection pool stats.
+func (r *PostgresRepository) Collectors() []prometheus.Collector {
+	return []prometheus.Collector{r.queries, collectors.NewDBStatsCollector(r.db, r.name)}
+}
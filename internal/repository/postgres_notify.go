@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// IngestChannel is the channel InsertDay notifies, with the day as payload,
+// when a session is committed.
+const IngestChannel = "quotes_ingested"
+
+// listenPing is how often an idle listener checks its connection.
+const listenPing = time.Minute
+
+// ListenIngest calls fn with the day of every session committed by ingest,
+// from any process, until ctx is done. Notifications sent while the
+// connection is down are lost, so fn is also called with an empty day every
+// time it is re-established. It only returns early if it cannot listen.
+func (r *PostgresRepository) ListenIngest(ctx context.Context, fn func(day string)) error {
+	l := pq.NewListener(r.dsn, time.Second, time.Minute, nil)
+	defer l.Close()
+	if err := l.Listen(IngestChannel); err != nil {
+		return err
+	}
+	ping := time.NewTicker(listenPing)
+	defer ping.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-l.Notify:
+			if n == nil {
+				// Reconnected.
+				fn("")
+				continue
+			}
+			fn(n.Extra)
+		case <-ping.C:
+			// A failed ping makes the listener reconnect.
+			_ = l.Ping()
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// TakeToken implements ratelimit.Backend over the rate_limits table, using
+// the database clock. The table is unlogged: losing buckets in a crash only
+// resets the limits.
+func (r *PostgresRepository) TakeToken(ctx context.Context, key string, interval, capacity time.Duration) (now, full time.Time, taken bool, err error) {
+	defer r.observe("take_token", time.Now())
+	const take = `INSERT INTO rate_limits AS b (key, full_at) VALUES ($1, now() + make_interval(secs => $2))
+ON CONFLICT (key) DO UPDATE SET full_at = GREATEST(b.full_at, now()) + make_interval(secs => $2)
+WHERE GREATEST(b.full_at, now()) + make_interval(secs => $2) <= now() + make_interval(secs => $3)
+RETURNING now(), full_at`
+	err = r.db.QueryRowContext(ctx, take, key, interval.Seconds(), capacity.Seconds()).Scan(&now, &full)
+	if err == nil {
+		return now, full, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, time.Time{}, false, err
+	}
+	// The bucket is empty and was left untouched; report when it refills.
+	err = r.db.QueryRowContext(ctx, "SELECT now(), full_at FROM rate_limits WHERE key = $1", key).Scan(&now, &full)
+	return now, full, false, err
+}
+
+// PeekToken implements ratelimit.Backend over the rate_limits table. A
+// missing bucket is full as of now.
+func (r *PostgresRepository) PeekToken(ctx context.Context, key string) (now, full time.Time, err error) {
+	defer r.observe("peek_token", time.Now())
+	err = r.db.QueryRowContext(ctx, "SELECT now(), COALESCE((SELECT full_at FROM rate_limits WHERE key = $1), now())", key).Scan(&now, &full)
+	return now, full, err
+}
+
+// SweepTokens deletes the buckets that are full, which are the same as
+// missing ones.
+func (r *PostgresRepository) SweepTokens(ctx context.Context) error {
+	defer r.observe("sweep_tokens", time.Now())
+	_, err := r.db.ExecContext(ctx, "DELETE FROM rate_limits WHERE full_at <= now()")
+	return err
+}
@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Trade is a single row of quotes. Time combines the session date and the
+// trade time.
+type Trade struct {
+	ID       string
+	Ticker   string
+	Time     time.Time
+	Price    float64
+	Quantity float64
+}
+
+// StreamTrades calls fn for every trade of ticker between from and to
+// (inclusive) in time order. Rows are read from the cursor one at a time so
+// the result set is never held in memory; iteration stops at the first error
+// returned by fn.
+func (r *PostgresRepository) StreamTrades(ctx context.Context, ticker string, from, to time.Time, fn func(Trade) error) error {
+	defer r.observe("trades", time.Now())
+	const query = `SELECT id, ticker, date + time, price, quantity
+FROM quotes
+WHERE ticker = $1
+  AND ($2::DATE IS NULL OR date >= $2)
+  AND ($3::DATE IS NULL OR date <= $3)
+ORDER BY date, time`
+	rows, err := r.db.QueryContext(ctx, query, ticker, nullDate(from), nullDate(to))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t Trade
+		if err := rows.Scan(&t.ID, &t.Ticker, &t.Time, &t.Price, &t.Quantity); err != nil {
+			return err
+		}
+		if err := fn(t); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// StreamSession calls fn for every trade on day, ordered by ticker and time.
+func (r *PostgresRepository) StreamSession(ctx context.Context, day time.Time, fn func(Trade) error) error {
+	defer r.observe("session_trades", time.Now())
+	const query = `SELECT id, ticker, date + time, price, quantity
+FROM quotes
+WHERE date = $1
+ORDER BY ticker, time`
+	rows, err := r.db.QueryContext(ctx, query, day.Format("2006-01-02"))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t Trade
+		if err := rows.Scan(&t.ID, &t.Ticker, &t.Time, &t.Price, &t.Quantity); err != nil {
+			return err
+		}
+		if err := fn(t); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Sessions lists the dates between from and to (inclusive) that have trades.
+func (r *PostgresRepository) Sessions(ctx context.Context, from, to time.Time) ([]time.Time, error) {
+	defer r.observe("sessions", time.Now())
+	const query = `SELECT DISTINCT date FROM quotes WHERE date >= $1 AND date <= $2 ORDER BY date`
+	rows, err := r.db.QueryContext(ctx, query, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var days []time.Time
+	for rows.Next() {
+		var d time.Time
+		if err := rows.Scan(&d); err != nil {
+			return nil, err
+		}
+		days = append(days, d)
+	}
+	return days, rows.Err()
+}
+
+// SessionTrades returns up to limit trades of tickers on day in time order,
+// starting after the trade at after with id afterID; a zero after starts at
+// the open. Replays page through a session with it, rather than holding a
+// cursor open for as long as the session lasts.
+func (r *PostgresRepository) SessionTrades(ctx context.Context, day time.Time, tickers []string, after time.Time, afterID string, limit int) ([]Trade, error) {
+	defer r.observe("session_trades_page", time.Now())
+	const query = `SELECT id, ticker, date + time, price, quantity
+FROM quotes
+WHERE date = $1
+  AND ticker = ANY($2)
+  AND ($3::TIMESTAMP IS NULL OR (date + time, id) > ($3, $4::UUID))
+ORDER BY date + time, id
+LIMIT $5`
+	var from any
+	if !after.IsZero() {
+		// Trade times are session wall clock, read back as UTC.
+		from = after.UTC().Format("2006-01-02 15:04:05.999999")
+	}
+	if afterID == "" {
+		afterID = "00000000-0000-0000-0000-000000000000"
+	}
+	rows, err := r.db.QueryContext(ctx, query, day.Format("2006-01-02"), pq.Array(tickers), from, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var trades []Trade
+	for rows.Next() {
+		var t Trade
+		if err := rows.Scan(&t.ID, &t.Ticker, &t.Time, &t.Price, &t.Quantity); err != nil {
+			return nil, err
+		}
+		trades = append(trades, t)
+	}
+	return trades, rows.Err()
+}
+
+// LatestTrades returns, for each of tickers, its last limit trades on day in
+// time order. Tickers that did not trade on day are left out of the map.
+func (r *PostgresRepository) LatestTrades(ctx context.Context, tickers []string, day time.Time, limit int) (map[string][]Trade, error) {
+	defer r.observe("latest_trades", time.Now())
+	const query = `SELECT id, ticker, date + time, price, quantity
+FROM (
+        SELECT *, ROW_NUMBER() OVER (PARTITION BY ticker ORDER BY time DESC, id DESC) AS n
+        FROM quotes
+        WHERE date = $1
+          AND ticker = ANY($2)
+) ranked
+WHERE n <= $3
+ORDER BY ticker, time, id`
+	rows, err := r.db.QueryContext(ctx, query, day.Format("2006-01-02"), pq.Array(tickers), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	trades := make(map[string][]Trade, len(tickers))
+	for rows.Next() {
+		var t Trade
+		if err := rows.Scan(&t.ID, &t.Ticker, &t.Time, &t.Price, &t.Quantity); err != nil {
+			return nil, err
+		}
+		trades[t.Ticker] = append(trades[t.Ticker], t)
+	}
+	return trades, rows.Err()
+}
@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// VWAPPoint is the volume-weighted average price of one intraday bucket and
+// the cumulative VWAP of the session up to the end of that bucket.
+type VWAPPoint struct {
+	Time           time.Time
+	VWAP           float64
+	CumulativeVWAP float64
+	Volume         int64
+}
+
+// PriceLevel is the traded volume at prices in [Price, Price+bucket).
+type PriceLevel struct {
+	Price  float64
+	Volume int64
+	Trades int64
+}
+
+// VWAP computes the intraday VWAP curve of ticker on day, bucketed by interval.
+func (r *PostgresRepository) VWAP(ctx context.Context, ticker string, day time.Time, interval time.Duration) ([]VWAPPoint, error) {
+	defer r.observe("vwap", time.Now())
+	const query = `SELECT bucket,
+        SUM(price * quantity) / NULLIF(SUM(quantity), 0),
+        SUM(SUM(price * quantity)) OVER w / NULLIF(SUM(SUM(quantity)) OVER w, 0),
+        SUM(quantity)::BIGINT
+FROM (
+        SELECT date + FLOOR(EXTRACT(EPOCH FROM time) / $3) * $3 * INTERVAL '1 second' AS bucket, price, quantity
+        FROM quotes
+        WHERE ticker = $1 AND date = $2
+) t
+GROUP BY bucket
+WINDOW w AS (ORDER BY bucket)
+ORDER BY bucket`
+	rows, err := r.db.QueryContext(ctx, query, ticker, day.Format("2006-01-02"), int64(interval/time.Second))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var points []VWAPPoint
+	for rows.Next() {
+		var p VWAPPoint
+		if err := rows.Scan(&p.Time, &p.VWAP, &p.CumulativeVWAP, &p.Volume); err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+	return points, rows.Err()
+}
+
+// VolumeProfile sums the volume traded by ticker between from and to
+// (inclusive) per price level of width bucket.
+func (r *PostgresRepository) VolumeProfile(ctx context.Context, ticker string, from, to time.Time, bucket float64) ([]PriceLevel, error) {
+	defer r.observe("volume_profile", time.Now())
+	const query = `SELECT FLOOR(price / $4::NUMERIC) * $4::NUMERIC AS level,
+        SUM(quantity)::BIGINT,
+        COUNT(*)
+FROM quotes
+WHERE ticker = $1 AND date >= $2 AND date <= $3
+GROUP BY level
+ORDER BY level`
+	rows, err := r.db.QueryContext(ctx, query, ticker, from.Format("2006-01-02"), to.Format("2006-01-02"), strconv.FormatFloat(bucket, 'f', -1, 64))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var levels []PriceLevel
+	for rows.Next() {
+		var l PriceLevel
+		if err := rows.Scan(&l.Price, &l.Volume, &l.Trades); err != nil {
+			return nil, err
+		}
+		levels = append(levels, l)
+	}
+	return levels, rows.Err()
+}
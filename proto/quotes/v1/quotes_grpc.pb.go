@@ -0,0 +1,262 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: quotes/v1/quotes.proto
+
+// Package quotes.v1 mirrors the /v1 HTTP API for gRPC clients. Fields, defaults
+// and errors are those of the HTTP endpoints each RPC names; dates are
+// YYYY-MM-DD strings, as in the HTTP query parameters.
+
+package quotesv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	QuotesService_GetSummary_FullMethodName    = "/quotes.v1.QuotesService/GetSummary"
+	QuotesService_StreamCandles_FullMethodName = "/quotes.v1.QuotesService/StreamCandles"
+	QuotesService_StreamTrades_FullMethodName  = "/quotes.v1.QuotesService/StreamTrades"
+	QuotesService_ListTickers_FullMethodName   = "/quotes.v1.QuotesService/ListTickers"
+)
+
+// QuotesServiceClient is the client API for QuotesService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// QuotesService serves the quotes ingested from B3. Failures carry a
+// google.rpc.ErrorInfo whose reason is the error ID the HTTP API reports,
+// such as ERR_TICKER_NOT_FOUND, in the quotes domain.
+type QuotesServiceClient interface {
+	// GetSummary is GET /v1/quotes/summary.
+	GetSummary(ctx context.Context, in *GetSummaryRequest, opts ...grpc.CallOption) (*Summary, error)
+	// StreamCandles is GET /v1/quotes/candles, one message per bar.
+	StreamCandles(ctx context.Context, in *StreamCandlesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Candle], error)
+	// StreamTrades is GET /v1/quotes/trades, one message per trade.
+	StreamTrades(ctx context.Context, in *StreamTradesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Trade], error)
+	// ListTickers lists the tickers traded in a session with their class.
+	ListTickers(ctx context.Context, in *ListTickersRequest, opts ...grpc.CallOption) (*ListTickersResponse, error)
+}
+
+type quotesServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewQuotesServiceClient(cc grpc.ClientConnInterface) QuotesServiceClient {
+	return &quotesServiceClient{cc}
+}
+
+func (c *quotesServiceClient) GetSummary(ctx context.Context, in *GetSummaryRequest, opts ...grpc.CallOption) (*Summary, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Summary)
+	err := c.cc.Invoke(ctx, QuotesService_GetSummary_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *quotesServiceClient) StreamCandles(ctx context.Context, in *StreamCandlesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Candle], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &QuotesService_ServiceDesc.Streams[0], QuotesService_StreamCandles_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamCandlesRequest, Candle]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type QuotesService_StreamCandlesClient = grpc.ServerStreamingClient[Candle]
+
+func (c *quotesServiceClient) StreamTrades(ctx context.Context, in *StreamTradesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Trade], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &QuotesService_ServiceDesc.Streams[1], QuotesService_StreamTrades_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamTradesRequest, Trade]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type QuotesService_StreamTradesClient = grpc.ServerStreamingClient[Trade]
+
+func (c *quotesServiceClient) ListTickers(ctx context.Context, in *ListTickersRequest, opts ...grpc.CallOption) (*ListTickersResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListTickersResponse)
+	err := c.cc.Invoke(ctx, QuotesService_ListTickers_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// QuotesServiceServer is the server API for QuotesService service.
+// All implementations must embed UnimplementedQuotesServiceServer
+// for forward compatibility.
+//
+// QuotesService serves the quotes ingested from B3. Failures carry a
+// google.rpc.ErrorInfo whose reason is the error ID the HTTP API reports,
+// such as ERR_TICKER_NOT_FOUND, in the quotes domain.
+type QuotesServiceServer interface {
+	// GetSummary is GET /v1/quotes/summary.
+	GetSummary(context.Context, *GetSummaryRequest) (*Summary, error)
+	// StreamCandles is GET /v1/quotes/candles, one message per bar.
+	StreamCandles(*StreamCandlesRequest, grpc.ServerStreamingServer[Candle]) error
+	// StreamTrades is GET /v1/quotes/trades, one message per trade.
+	StreamTrades(*StreamTradesRequest, grpc.ServerStreamingServer[Trade]) error
+	// ListTickers lists the tickers traded in a session with their class.
+	ListTickers(context.Context, *ListTickersRequest) (*ListTickersResponse, error)
+	mustEmbedUnimplementedQuotesServiceServer()
+}
+
+// UnimplementedQuotesServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedQuotesServiceServer struct{}
+
+func (UnimplementedQuotesServiceServer) GetSummary(context.Context, *GetSummaryRequest) (*Summary, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSummary not implemented")
+}
+func (UnimplementedQuotesServiceServer) StreamCandles(*StreamCandlesRequest, grpc.ServerStreamingServer[Candle]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamCandles not implemented")
+}
+func (UnimplementedQuotesServiceServer) StreamTrades(*StreamTradesRequest, grpc.ServerStreamingServer[Trade]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamTrades not implemented")
+}
+func (UnimplementedQuotesServiceServer) ListTickers(context.Context, *ListTickersRequest) (*ListTickersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListTickers not implemented")
+}
+func (UnimplementedQuotesServiceServer) mustEmbedUnimplementedQuotesServiceServer() {}
+func (UnimplementedQuotesServiceServer) testEmbeddedByValue()                       {}
+
+// UnsafeQuotesServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to QuotesServiceServer will
+// result in compilation errors.
+type UnsafeQuotesServiceServer interface {
+	mustEmbedUnimplementedQuotesServiceServer()
+}
+
+func RegisterQuotesServiceServer(s grpc.ServiceRegistrar, srv QuotesServiceServer) {
+	// If the following call pancis, it indicates UnimplementedQuotesServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&QuotesService_ServiceDesc, srv)
+}
+
+func _QuotesService_GetSummary_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetSummaryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QuotesServiceServer).GetSummary(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: QuotesService_GetSummary_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QuotesServiceServer).GetSummary(ctx, req.(*GetSummaryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _QuotesService_StreamCandles_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamCandlesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(QuotesServiceServer).StreamCandles(m, &grpc.GenericServerStream[StreamCandlesRequest, Candle]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type QuotesService_StreamCandlesServer = grpc.ServerStreamingServer[Candle]
+
+func _QuotesService_StreamTrades_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamTradesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(QuotesServiceServer).StreamTrades(m, &grpc.GenericServerStream[StreamTradesRequest, Trade]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type QuotesService_StreamTradesServer = grpc.ServerStreamingServer[Trade]
+
+func _QuotesService_ListTickers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListTickersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QuotesServiceServer).ListTickers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: QuotesService_ListTickers_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QuotesServiceServer).ListTickers(ctx, req.(*ListTickersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// QuotesService_ServiceDesc is the grpc.ServiceDesc for QuotesService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var QuotesService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "quotes.v1.QuotesService",
+	HandlerType: (*QuotesServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetSummary",
+			Handler:    _QuotesService_GetSummary_Handler,
+		},
+		{
+			MethodName: "ListTickers",
+			Handler:    _QuotesService_ListTickers_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamCandles",
+			Handler:       _QuotesService_StreamCandles_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "StreamTrades",
+			Handler:       _QuotesService_StreamTrades_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "quotes/v1/quotes.proto",
+}